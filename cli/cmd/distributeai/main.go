@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
@@ -28,7 +30,13 @@ func main() {
 		submitJobCmd(),
 		listJobsCmd(),
 		getJobCmd(),
+		cancelJobCmd(),
 		listNodesCmd(),
+		cordonCmd(),
+		uncordonCmd(),
+		drainCmd(),
+		maintenanceCmd(),
+		queueCmd(),
 		statsCmd(),
 	)
 
@@ -46,6 +54,33 @@ func submitJobCmd() *cobra.Command {
 		command     []string
 		cpu         int
 		memory      int
+		diskQuota   int
+		timeout     int
+		deadline    string
+		outputFile  string
+		normalize   []string
+		comparator  string
+		absTol      float64
+		relTol      float64
+		compFormat  string
+		redundancy  int
+		consensus   int
+		weight      float64
+		adaptive    bool
+		maxRedund   int
+		trustLevel  string
+		spread      []string
+		noSpread    bool
+		spreadMode  string
+		relaxAfter  int
+		placement   string
+		priority    int
+		submitter   string
+		noPreempt   bool
+		selectors   []string
+		affinity    []string
+		prefer      []string
+		tolerations []string
 	)
 
 	cmd := &cobra.Command{
@@ -61,6 +96,117 @@ func submitJobCmd() *cobra.Command {
 				"required_memory": memory,
 			}
 
+			if priority != 0 {
+				job["priority"] = priority
+			}
+			if submitter != "" {
+				job["submitted_by"] = submitter
+			}
+			if noPreempt {
+				job["non_preemptible"] = true
+			}
+			if diskQuota > 0 {
+				job["disk_quota_gb"] = diskQuota
+			}
+			if timeout > 0 {
+				job["timeout_seconds"] = timeout
+			}
+			if outputFile != "" {
+				job["output_file"] = outputFile
+			}
+			if len(normalize) > 0 {
+				job["normalize"] = parseNormalizeRules(normalize)
+			}
+			if comparator != "" {
+				job["comparator"] = map[string]interface{}{
+					"type":          comparator,
+					"abs_tolerance": absTol,
+					"rel_tolerance": relTol,
+					"format":        compFormat,
+				}
+			}
+			if deadline != "" {
+				at, err := parseDeadline(deadline)
+				if err != nil {
+					return err
+				}
+				job["deadline"] = at.Format(time.RFC3339)
+			}
+
+			// Only send verification settings that were set, so the coordinator defaults apply otherwise
+			if trustLevel != "" {
+				job["trust_level"] = trustLevel
+			}
+			if cmd.Flags().Changed("redundancy") {
+				job["redundancy"] = redundancy
+			}
+			if cmd.Flags().Changed("consensus") {
+				job["consensus"] = consensus
+			}
+			if weight > 0 {
+				job["consensus_weight"] = weight
+			}
+			if adaptive {
+				job["adaptive"] = true
+			}
+			if maxRedund > 0 {
+				job["max_redundancy"] = maxRedund
+			}
+
+			if placement != "" {
+				job["placement"] = placement
+			}
+
+			if len(selectors) > 0 {
+				job["node_selector"] = parseSelector(selectors)
+			}
+			if len(affinity) > 0 || len(prefer) > 0 {
+				nodeAffinity := map[string]interface{}{}
+				var required []map[string]interface{}
+				for _, value := range affinity {
+					expr, err := parseLabelExpression(value)
+					if err != nil {
+						return err
+					}
+					required = append(required, expr)
+				}
+				var preferred []map[string]interface{}
+				for _, value := range prefer {
+					expr, err := parseLabelExpression(value)
+					if err != nil {
+						return err
+					}
+					preferred = append(preferred, map[string]interface{}{"weight": 1, "expression": expr})
+				}
+				if len(required) > 0 {
+					nodeAffinity["required"] = required
+				}
+				if len(preferred) > 0 {
+					nodeAffinity["preferred"] = preferred
+				}
+				job["affinity"] = nodeAffinity
+			}
+			if len(tolerations) > 0 {
+				job["tolerations"] = parseTolerations(tolerations)
+			}
+
+			// Without spread flags the coordinator spreads over owner and region
+			if noSpread {
+				job["spread"] = map[string]interface{}{"domains": []string{}}
+			} else if len(spread) > 0 || spreadMode != "" || relaxAfter > 0 {
+				policy := map[string]interface{}{}
+				if len(spread) > 0 {
+					policy["domains"] = spread
+				}
+				if spreadMode != "" {
+					policy["mode"] = spreadMode
+				}
+				if relaxAfter > 0 {
+					policy["relax_after_seconds"] = relaxAfter
+				}
+				job["spread"] = policy
+			}
+
 			data, _ := json.Marshal(job)
 			resp, err := http.Post(
 				coordinatorURL+"/api/v1/jobs",
@@ -84,6 +230,7 @@ func submitJobCmd() *cobra.Command {
 			fmt.Printf("   ID: %s\n", result["id"])
 			fmt.Printf("   Name: %s\n", result["name"])
 			fmt.Printf("   Status: %s\n", result["status"])
+			fmt.Printf("   Verification: %v of %v nodes must agree\n", result["consensus"], result["redundancy"])
 			fmt.Printf("\nMonitor progress with: distributeai get %s\n", result["id"])
 
 			return nil
@@ -96,6 +243,33 @@ func submitJobCmd() *cobra.Command {
 	cmd.Flags().StringArrayVar(&command, "cmd", []string{}, "Command to run (can specify multiple times)")
 	cmd.Flags().IntVar(&cpu, "cpu", 1, "Required CPU cores")
 	cmd.Flags().IntVar(&memory, "memory", 1, "Required memory (GB)")
+	cmd.Flags().IntVar(&priority, "priority", 0, "Priority among your own pending jobs, -10 to 10")
+	cmd.Flags().BoolVar(&noPreempt, "non-preemptible", false, "Never revoke this job's executions for higher-priority jobs")
+	cmd.Flags().StringVar(&submitter, "submitter", "", "Name to submit as for fair-share scheduling (default \"user\")")
+	cmd.Flags().IntVar(&diskQuota, "disk-quota", 0, "Container disk quota (GB), 0 for none")
+	cmd.Flags().IntVar(&timeout, "timeout", 0, "Per-execution timeout in seconds (default 300)")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "File in the container holding the result (default: stdout)")
+	cmd.Flags().StringArrayVar(&normalize, "normalize", []string{}, "Output normalization rule, type or type=pattern (can specify multiple times)")
+	cmd.Flags().StringVar(&comparator, "comparator", "", "Result comparator: exact, canonical_json, numeric_tolerance, set")
+	cmd.Flags().Float64Var(&absTol, "abs-tolerance", 0, "numeric_tolerance: allowed absolute difference")
+	cmd.Flags().Float64Var(&relTol, "rel-tolerance", 0, "numeric_tolerance: allowed relative difference")
+	cmd.Flags().StringVar(&compFormat, "compare-format", "", "numeric_tolerance: json (default) or csv")
+	cmd.Flags().StringVar(&deadline, "deadline", "", "Finish by this time: RFC 3339 timestamp or duration from now (e.g. 2h)")
+	cmd.Flags().IntVar(&redundancy, "redundancy", 0, "Number of nodes to run the job on")
+	cmd.Flags().IntVar(&consensus, "consensus", 0, "Number of nodes that must agree on the result")
+	cmd.Flags().Float64Var(&weight, "consensus-weight", 0, "Use reputation-weighted voting; total vote weight required (a trusted veteran node counts 1)")
+	cmd.Flags().BoolVar(&adaptive, "adaptive", false, "Start with only as many replicas as must agree when nodes are trusted, escalate on disagreement")
+	cmd.Flags().IntVar(&maxRedund, "max-redundancy", 0, "Most nodes the job may grow to through tie-breakers and escalation")
+	cmd.Flags().StringArrayVar(&spread, "spread", []string{}, "Keep replicas on distinct owner, region or host (can specify multiple times, in priority order)")
+	cmd.Flags().BoolVar(&noSpread, "no-spread", false, "Don't spread replicas across owners and regions")
+	cmd.Flags().StringVar(&spreadMode, "spread-mode", "", "strict (wait for enough distinct nodes) or relax (default)")
+	cmd.Flags().IntVar(&relaxAfter, "relax-after", 0, "relax mode: seconds to wait for distinct nodes before relaxing the spread")
+	cmd.Flags().StringVar(&placement, "placement", "", "Node ranking: reputation, least_loaded, bin_packing, random_weighted, cost")
+	cmd.Flags().StringArrayVar(&selectors, "selector", []string{}, "Node label the job requires, key=value (can specify multiple times)")
+	cmd.Flags().StringArrayVar(&affinity, "affinity", []string{}, "Required label expression: \"key in a,b\", \"key not_in a,b\", \"key exists\", \"key does_not_exist\", \"key gt N\", \"key lt N\" (can specify multiple times)")
+	cmd.Flags().StringArrayVar(&prefer, "prefer", []string{}, "Preferred label expression, same form as --affinity (can specify multiple times)")
+	cmd.Flags().StringArrayVar(&tolerations, "toleration", []string{}, "Taint the job tolerates: key=value[:effect], or key[:effect] for any value (can specify multiple times)")
+	cmd.Flags().StringVar(&trustLevel, "trust", "", "Verification preset: minimal (1/1), standard (2/3), high (3/5), critical (5/7)")
 
 	cmd.MarkFlagRequired("name")
 	cmd.MarkFlagRequired("image")
@@ -181,12 +355,30 @@ func getJobCmd() *cobra.Command {
 			fmt.Printf("   Description: %s\n", job["description"])
 			fmt.Printf("   Status:      %s\n", job["status"])
 			fmt.Printf("   Image:       %s\n", job["docker_image"])
+			fmt.Printf("   Consensus:   %v of %v\n", job["consensus"], job["redundancy"])
+			if job["tie_breakers"] != nil {
+				fmt.Printf("   Tie-breaks:  %v\n", job["tie_breakers"])
+			}
+			fmt.Printf("   Timeout:     %vs\n", job["timeout_seconds"])
+			if job["deadline"] != nil {
+				fmt.Printf("   Deadline:    %s\n", job["deadline"])
+			}
 			fmt.Printf("   Submitted:   %s\n", job["submitted_at"])
 
 			if job["completed_at"] != nil {
 				fmt.Printf("   Completed:   %s\n", job["completed_at"])
 			}
 
+			if verification, ok := job["verification"].(map[string]interface{}); ok && verification["required_weight"] != nil {
+				fmt.Printf("   Vote weight: %.2f of %.2f required\n",
+					verification["consensus_weight"], verification["required_weight"])
+				if weights, ok := verification["node_weights"].(map[string]interface{}); ok {
+					for nodeID, w := range weights {
+						fmt.Printf("     %-20s %.2f\n", truncate(nodeID, 20), w)
+					}
+				}
+			}
+
 			if job["result"] != nil && job["result"] != "" {
 				fmt.Printf("\n📤 Result:\n%s\n", job["result"])
 			}
@@ -213,6 +405,9 @@ func getJobCmd() *cobra.Command {
 						for _, exec := range execResult.Executions {
 							nodeID := truncate(fmt.Sprintf("%v", exec["node_id"]), 20)
 							status := fmt.Sprintf("%v", exec["status"])
+							if class, ok := exec["error_class"].(string); ok && class != "" {
+								status += " (" + class + ")"
+							}
 							hash := truncate(fmt.Sprintf("%v", exec["result_hash"]), 16)
 
 							table.Append([]string{nodeID, status, hash})
@@ -229,6 +424,40 @@ func getJobCmd() *cobra.Command {
 	}
 }
 
+func cancelJobCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cancel [job-id]",
+		Short: "Cancel a job that hasn't finished",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobID := args[0]
+
+			resp, err := http.Post(coordinatorURL+"/api/v1/jobs/"+jobID+"/cancel", "application/json", nil)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			switch resp.StatusCode {
+			case http.StatusOK:
+			case http.StatusNotFound:
+				return fmt.Errorf("job not found")
+			default:
+				body, _ := io.ReadAll(resp.Body)
+				return fmt.Errorf("failed to cancel job: %s - %s", resp.Status, string(body))
+			}
+
+			var result map[string]interface{}
+			json.NewDecoder(resp.Body).Decode(&result)
+
+			fmt.Printf("🛑 Job %s cancelled\n", jobID)
+			fmt.Printf("   Executions stopped: %v\n", result["cancelled_executions"])
+
+			return nil
+		},
+	}
+}
+
 func listNodesCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "nodes",
@@ -257,19 +486,259 @@ func listNodesCmd() *cobra.Command {
 			}
 
 			table := tablewriter.NewWriter(os.Stdout)
-			table.SetHeader([]string{"ID", "Name", "Status", "CPU", "Memory", "Reputation", "Jobs"})
+			table.SetHeader([]string{"ID", "Name", "Owner", "Region", "Status", "CPU", "Memory", "Reputation", "Jobs", "Labels"})
 			table.SetBorder(false)
 
 			for _, node := range result.Nodes {
 				id := truncate(fmt.Sprintf("%v", node["id"]), 20)
 				name := truncate(fmt.Sprintf("%v", node["name"]), 25)
+				owner, _ := node["owner"].(string)
+				if owner == "" {
+					owner = "-"
+				}
+				region := fmt.Sprintf("%v", node["region"])
 				status := fmt.Sprintf("%v", node["status"])
+				if draining, _ := node["draining"].(bool); draining {
+					status += " (draining)"
+				} else if cordoned, _ := node["cordoned"].(bool); cordoned {
+					status += " (cordoned)"
+				}
 				cpu := fmt.Sprintf("%v cores", node["cpu_cores"])
 				memory := fmt.Sprintf("%v GB", node["memory_gb"])
 				reputation := fmt.Sprintf("%.1f", node["reputation_score"])
 				jobs := fmt.Sprintf("%v", node["total_jobs_run"])
+				labels := formatLabels(node["labels"])
+
+				table.Append([]string{id, name, owner, region, status, cpu, memory, reputation, jobs, labels})
+			}
+
+			table.Render()
+			return nil
+		},
+	}
+}
+
+func cordonCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cordon [node-id]",
+		Short: "Stop scheduling new executions on a node",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := adminNode(http.MethodPost, args[0], "cordon", nil); err != nil {
+				return err
+			}
+			fmt.Printf("🚧 Node %s cordoned, running executions carry on\n", args[0])
+			return nil
+		},
+	}
+}
+
+func uncordonCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "uncordon [node-id]",
+		Short: "Put a cordoned or drained node back into rotation",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := adminNode(http.MethodPost, args[0], "uncordon", nil); err != nil {
+				return err
+			}
+			fmt.Printf("✅ Node %s uncordoned\n", args[0])
+			return nil
+		},
+	}
+}
+
+func drainCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "drain [node-id]",
+		Short: "Cordon a node and take it offline once its executions finish",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result, err := adminNode(http.MethodPost, args[0], "drain", nil)
+			if err != nil {
+				return err
+			}
+			moved, _ := result["rescheduled_jobs"].([]interface{})
+			fmt.Printf("🚰 Node %s draining\n", args[0])
+			fmt.Printf("   Unclaimed executions moved: %d\n", len(moved))
+			return nil
+		},
+	}
+}
+
+func maintenanceCmd() *cobra.Command {
+	var start, end string
+	var duration time.Duration
+	var cancel bool
+
+	cmd := &cobra.Command{
+		Use:   "maintenance [node-id]",
+		Short: "Schedule a window during which a node may go silent without penalty",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			nodeID := args[0]
+
+			if cancel {
+				if _, err := adminNode(http.MethodDelete, nodeID, "maintenance", nil); err != nil {
+					return err
+				}
+				fmt.Printf("✅ Maintenance window of node %s cancelled\n", nodeID)
+				return nil
+			}
+
+			from := time.Now()
+			if start != "" {
+				at, err := parseDeadline(start)
+				if err != nil {
+					return fmt.Errorf("invalid --start: %w", err)
+				}
+				from = at
+			}
+			var until time.Time
+			switch {
+			case end != "" && duration > 0:
+				return fmt.Errorf("use either --end or --duration")
+			case end != "":
+				at, err := parseDeadline(end)
+				if err != nil {
+					return fmt.Errorf("invalid --end: %w", err)
+				}
+				until = at
+			case duration > 0:
+				until = from.Add(duration)
+			default:
+				return fmt.Errorf("--end or --duration is required")
+			}
+
+			req := map[string]interface{}{"start": from, "end": until}
+			if _, err := adminNode(http.MethodPut, nodeID, "maintenance", req); err != nil {
+				return err
+			}
+
+			fmt.Printf("🔧 Node %s in maintenance\n", nodeID)
+			fmt.Printf("   From:  %s\n", from.Format(time.RFC3339))
+			fmt.Printf("   Until: %s\n", until.Format(time.RFC3339))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&start, "start", "", "Window start: RFC 3339 timestamp or duration from now (default: now)")
+	cmd.Flags().StringVar(&end, "end", "", "Window end: RFC 3339 timestamp or duration from now")
+	cmd.Flags().DurationVar(&duration, "duration", 0, "Window length (e.g. 2h), instead of --end")
+	cmd.Flags().BoolVar(&cancel, "cancel", false, "Cancel the node's maintenance window")
+
+	return cmd
+}
+
+// adminNode calls one of the coordinator's admin actions on a node and
+// returns the decoded response
+func adminNode(method, nodeID, action string, body interface{}) (map[string]interface{}, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(method, coordinatorURL+"/api/v1/admin/nodes/"+nodeID+"/"+action, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("node not found")
+	default:
+		data, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to %s node: %s - %s", action, resp.Status, string(data))
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func queueCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "queue",
+		Short: "Show pending jobs and each submitter's fair share",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := http.Get(coordinatorURL + "/api/v1/queue")
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			var queue struct {
+				WindowSeconds int                      `json:"window_seconds"`
+				Tenants       []map[string]interface{} `json:"tenants"`
+				Jobs          []map[string]interface{} `json:"jobs"`
+			}
+
+			if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
+				return err
+			}
+
+			window := time.Duration(queue.WindowSeconds) * time.Second
+			fmt.Printf("⚖️  Fair share over the last %s\n\n", window)
+
+			if len(queue.Tenants) == 0 {
+				fmt.Println("No pending jobs or recent usage.")
+				return nil
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Submitter", "Weight", "Usage", "Share", "Target", "Pending", "Next"})
+			table.SetBorder(false)
+
+			for _, tenant := range queue.Tenants {
+				usage := time.Duration(tenant["usage_node_seconds"].(float64)) * time.Second
+				next := "-"
+				if position, ok := tenant["next_position"].(float64); ok {
+					next = fmt.Sprintf("#%.0f", position)
+				}
+				table.Append([]string{
+					fmt.Sprintf("%v", tenant["submitted_by"]),
+					fmt.Sprintf("%.2f", tenant["weight"]),
+					usage.String(),
+					fmt.Sprintf("%.0f%%", tenant["share"].(float64)*100),
+					fmt.Sprintf("%.0f%%", tenant["target_share"].(float64)*100),
+					fmt.Sprintf("%v", tenant["pending_jobs"]),
+					next,
+				})
+			}
+
+			table.Render()
+
+			if len(queue.Jobs) == 0 {
+				return nil
+			}
 
-				table.Append([]string{id, name, status, cpu, memory, reputation, jobs})
+			fmt.Println()
+			table = tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"#", "Job ID", "Name", "Submitter", "Priority"})
+			table.SetBorder(false)
+
+			for _, job := range queue.Jobs {
+				table.Append([]string{
+					fmt.Sprintf("%v", job["position"]),
+					truncate(fmt.Sprintf("%v", job["job_id"]), 20),
+					truncate(fmt.Sprintf("%v", job["name"]), 30),
+					fmt.Sprintf("%v", job["submitted_by"]),
+					fmt.Sprintf("%v", job["priority"]),
+				})
 			}
 
 			table.Render()
@@ -304,6 +773,7 @@ func statsCmd() *cobra.Command {
 			fmt.Printf("   Total:  %v\n", nodes["total"])
 			fmt.Printf("   Online: %v\n", nodes["online"])
 			fmt.Printf("   Busy:   %v\n", nodes["busy"])
+			fmt.Printf("   Faulty: %v\n", nodes["faulty"])
 			fmt.Println()
 			fmt.Printf("⚡ Resources:\n")
 			fmt.Printf("   CPU Cores: %v\n", resources["total_cpu_cores"])
@@ -314,12 +784,97 @@ func statsCmd() *cobra.Command {
 			fmt.Printf("   Completed: %v\n", jobs["completed"])
 			fmt.Printf("   Running:   %v\n", jobs["running"])
 			fmt.Printf("   Failed:    %v\n", jobs["failed"])
+			fmt.Printf("   Cancelled: %v\n", jobs["cancelled"])
+			fmt.Printf("   Timed out: %v\n", jobs["timed_out"])
 
 			return nil
 		},
 	}
 }
 
+// parseNormalizeRules turns "type" or "type=pattern" flags into rule objects
+func parseNormalizeRules(values []string) []map[string]string {
+	var rules []map[string]string
+	for _, value := range values {
+		ruleType, pattern, hasPattern := strings.Cut(value, "=")
+		rule := map[string]string{"type": ruleType}
+		if hasPattern {
+			rule["pattern"] = pattern
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// parseSelector turns key=value flags into a node selector
+func parseSelector(values []string) map[string]string {
+	selector := make(map[string]string)
+	for _, value := range values {
+		key, label, _ := strings.Cut(value, "=")
+		selector[key] = label
+	}
+	return selector
+}
+
+// parseLabelExpression turns "key operator [v1,v2]" into an expression object
+func parseLabelExpression(value string) (map[string]interface{}, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("invalid label expression %q: use \"key operator [values]\"", value)
+	}
+	expr := map[string]interface{}{"key": fields[0], "operator": fields[1]}
+	if len(fields) == 3 {
+		expr["values"] = strings.Split(fields[2], ",")
+	}
+	return expr, nil
+}
+
+// parseTolerations turns key=value[:effect] and key[:effect] flags into
+// toleration objects; without a value any value of the key is tolerated
+func parseTolerations(values []string) []map[string]string {
+	var tolerations []map[string]string
+	for _, value := range values {
+		keyValue, effect, _ := strings.Cut(value, ":")
+		key, label, hasValue := strings.Cut(keyValue, "=")
+		toleration := map[string]string{"key": key, "operator": "exists"}
+		if hasValue {
+			toleration["operator"] = "equal"
+			toleration["value"] = label
+		}
+		if effect != "" {
+			toleration["effect"] = effect
+		}
+		tolerations = append(tolerations, toleration)
+	}
+	return tolerations
+}
+
+// parseDeadline accepts an RFC 3339 timestamp or a duration from now
+func parseDeadline(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(d), nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deadline %q: use RFC 3339 or a duration like 2h", value)
+	}
+	return at, nil
+}
+
+// formatLabels renders a node's labels as sorted key=value pairs
+func formatLabels(value interface{}) string {
+	labels, _ := value.(map[string]interface{})
+	if len(labels) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(labels))
+	for key, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, label))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+)
+
+const migrateUsage = `usage: coordinator migrate <command>
+
+Commands:
+  up        apply every pending migration
+  down [n]  revert the latest n applied migrations (default 1)
+  status    list migrations and when they were applied`
+
+// runMigrate implements "coordinator migrate", which manages the schema of
+// the database DATABASE_URL names without starting the coordinator
+func runMigrate(databaseURL string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	steps := 1
+	switch {
+	case args[0] == "down" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("migrate down: %q is not a positive number of migrations", args[1])
+		}
+		steps = n
+	case len(args) > 1:
+		return errors.New(migrateUsage)
+	}
+
+	db, err := repository.Connect(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		count, err := db.MigrateUp()
+		if err == nil || count > 0 {
+			fmt.Printf("Applied %d migration(s)\n", count)
+		}
+		return err
+	case "down":
+		count, err := db.MigrateDown(steps)
+		if err == nil || count > 0 {
+			fmt.Printf("Reverted %d migration(s)\n", count)
+		}
+		return err
+	case "status":
+		return printMigrations(db)
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func printMigrations(db *repository.Database) error {
+	migrations, err := db.Migrations()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, m := range migrations {
+		applied := "pending"
+		if m.AppliedAt != nil {
+			applied = m.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if m.Unknown {
+			applied += " (unknown to this coordinator)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", m.Version, m.Name, applied)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/HildaPosada/distributeai/coordinator/internal/api"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// newRouter registers the coordinator's HTTP API on a Gin router
+func newRouter(handler *api.Handler) *gin.Engine {
+	router := gin.Default()
+
+	// Enable CORS for dashboard
+	router.Use(corsMiddleware())
+
+	// Health check
+	router.GET("/health", handler.HealthCheck)
+	router.GET("/stats", handler.GetStats)
+
+	// Job endpoints
+	jobs := router.Group("/api/v1/jobs")
+	{
+		jobs.POST("", handler.SubmitJob)
+		jobs.GET("", handler.ListJobs)
+		jobs.GET("/:id", handler.GetJob)
+		jobs.GET("/:id/executions", handler.GetJobExecutions)
+		jobs.POST("/:id/cancel", handler.CancelJob)
+	}
+
+	// Fair-share queue
+	router.GET("/api/v1/queue", handler.GetQueue)
+
+	// Node endpoints
+	nodes := router.Group("/api/v1/nodes")
+	{
+		nodes.POST("/register", handler.RegisterNode)
+		nodes.GET("", handler.ListNodes)
+		nodes.GET("/:id", handler.GetNode)
+		nodes.POST("/:id/heartbeat", handler.NodeHeartbeat)
+		nodes.POST("/:id/drain", handler.NodeDrain)
+		nodes.GET("/:id/pending-jobs", handler.GetPendingJobs)
+	}
+
+	// Worker endpoints
+	worker := router.Group("/api/v1/worker")
+	{
+		worker.POST("/result", handler.SubmitJobResult)
+		worker.POST("/executions/:id/claim", handler.ClaimExecution)
+		worker.POST("/executions/:id/renew", handler.RenewExecutionLease)
+		worker.POST("/executions/:id/start", handler.StartExecution)
+	}
+
+	// Admin endpoints
+	admin := router.Group("/api/v1/admin")
+	{
+		admin.GET("/canaries", handler.ListCanaries)
+		admin.POST("/canaries", handler.CreateCanary)
+		admin.DELETE("/canaries/:id", handler.DisableCanary)
+		admin.GET("/flags", handler.ListNodeFlags)
+		admin.POST("/nodes/:id/reinstate", handler.ReinstateNode)
+		admin.POST("/nodes/:id/cordon", handler.CordonNode)
+		admin.POST("/nodes/:id/uncordon", handler.UncordonNode)
+		admin.POST("/nodes/:id/drain", handler.DrainNode)
+		admin.PUT("/nodes/:id/maintenance", handler.SetNodeMaintenance)
+		admin.DELETE("/nodes/:id/maintenance", handler.ClearNodeMaintenance)
+		admin.PUT("/shares/:submitter", handler.SetShareWeight)
+	}
+
+	// Prometheus metrics
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	return router
+}
+
+func corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	}
+}
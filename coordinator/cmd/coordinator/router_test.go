@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/api"
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+type pendingJobsResponse struct {
+	PendingJobs []struct {
+		ExecutionID string      `json:"execution_id"`
+		Job         *models.Job `json:"job"`
+	} `json:"pending_jobs"`
+	Count int `json:"count"`
+}
+
+// TestScheduledExecutionReachesWorker follows an execution from the
+// scheduler's write to the worker's poll and claim, through the same routes
+// the worker calls
+func TestScheduledExecutionReachesWorker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := repository.NewMemoryStore()
+	router := newRouter(api.NewHandler(db, models.VerificationPolicy{Redundancy: 1, Consensus: 1}, time.Hour))
+
+	now := time.Now()
+	for _, id := range []string{"node-a", "node-b"} {
+		err := db.RegisterNode(&models.Node{
+			ID: id, Name: id, CPUCores: 4, MemoryGB: 8, Status: models.NodeStatusOnline,
+			ReputationScore: 100, LastHeartbeat: now, RegisteredAt: now, MaxSlots: 2,
+		})
+		if err != nil {
+			t.Fatalf("RegisterNode(%s): %v", id, err)
+		}
+	}
+
+	job := &models.Job{
+		ID: "job-1", Name: "hello", DockerImage: "alpine:3", Command: []string{"echo", "hello"},
+		RequiredCPU: 1, RequiredMemory: 1, Redundancy: 1, Consensus: 1,
+		Status: models.JobStatusPending, SubmittedAt: now,
+	}
+	if err := db.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	deadline := now.Add(time.Minute)
+	exec := &models.JobExecution{
+		ID: "exec-1", JobID: job.ID, NodeID: "node-a", Status: models.JobStatusScheduled,
+		StartedAt: now, LeaseExpiresAt: &deadline,
+	}
+	if err := db.ScheduleJob(job.ID, []*models.JobExecution{exec}); err != nil {
+		t.Fatalf("ScheduleJob: %v", err)
+	}
+
+	pending := pollPendingJobs(t, router, "node-a")
+	if pending.Count != 1 || len(pending.PendingJobs) != 1 {
+		t.Fatalf("node-a has %d pending jobs, want 1", pending.Count)
+	}
+	got := pending.PendingJobs[0]
+	if got.ExecutionID != exec.ID || got.Job == nil || got.Job.ID != job.ID || got.Job.DockerImage != job.DockerImage {
+		t.Fatalf("node-a pending job = %+v, want execution %s of job %s", got, exec.ID, job.ID)
+	}
+
+	if other := pollPendingJobs(t, router, "node-b"); other.Count != 0 {
+		t.Errorf("node-b has %d pending jobs, want none", other.Count)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/worker/executions/"+got.ExecutionID+"/claim",
+		strings.NewReader(`{"node_id": "node-a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("claim returned %d: %s", w.Code, w.Body)
+	}
+
+	if after := pollPendingJobs(t, router, "node-a"); after.Count != 0 {
+		t.Errorf("node-a still has %d pending jobs after claiming", after.Count)
+	}
+}
+
+func pollPendingJobs(t *testing.T, router http.Handler, nodeID string) pendingJobsResponse {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/nodes/"+nodeID+"/pending-jobs", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("pending-jobs for %s returned %d: %s", nodeID, w.Code, w.Body)
+	}
+
+	var resp pendingJobsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding pending-jobs for %s: %v", nodeID, err)
+	}
+	return resp
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/normalize"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListCanaries returns the spot-check catalog
+func (h *Handler) ListCanaries(c *gin.Context) {
+	canaries, err := h.db.GetAllCanaries()
+	if err != nil {
+		log.Errorf("Failed to get canaries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve canaries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"canaries": canaries,
+		"count":    len(canaries),
+	})
+}
+
+// CreateCanary adds a known-answer workload to the spot-check catalog
+func (h *Handler) CreateCanary(c *gin.Context) {
+	var req models.CanaryRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	timeout, err := resolveTimeout(&models.JobSubmitRequest{TimeoutSeconds: req.TimeoutSeconds}, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.OutputFile != "" && !path.IsAbs(req.OutputFile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "output_file must be an absolute path"})
+		return
+	}
+
+	if err := normalize.Validate(req.Normalize); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expectedHash, err := resolveExpectedHash(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	canary := &models.Canary{
+		ID:             uuid.New().String(),
+		Name:           req.Name,
+		Description:    req.Description,
+		DockerImage:    req.DockerImage,
+		Command:        req.Command,
+		Environment:    req.Environment,
+		InputData:      req.InputData,
+		RequiredCPU:    maxInt(req.RequiredCPU, 1),
+		RequiredMemory: maxInt(req.RequiredMemory, 1),
+		TimeoutSeconds: timeout,
+		OutputFile:     req.OutputFile,
+		Normalize:      req.Normalize,
+		ExpectedHash:   expectedHash,
+		Enabled:        true,
+		CreatedAt:      time.Now(),
+	}
+
+	if err := h.db.CreateCanary(canary); err != nil {
+		log.Errorf("Failed to create canary: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create canary"})
+		return
+	}
+
+	log.Infof("Canary %s added to the spot-check catalog: %s", canary.ID, canary.Name)
+
+	c.JSON(http.StatusCreated, canary)
+}
+
+// resolveExpectedHash returns the hash a correct run of the canary produces,
+// from either its expected output or an explicit hash
+func resolveExpectedHash(req *models.CanaryRequest) (string, error) {
+	if (req.ExpectedOutput == nil) == (req.ExpectedHash == "") {
+		return "", fmt.Errorf("give exactly one of expected_output and expected_hash")
+	}
+
+	if req.ExpectedOutput != nil {
+		normalized, err := normalize.Apply(*req.ExpectedOutput, req.Normalize)
+		if err != nil {
+			return "", fmt.Errorf("expected_output: %w", err)
+		}
+		return normalize.Hash(normalized), nil
+	}
+
+	hash := strings.ToLower(req.ExpectedHash)
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+		return "", fmt.Errorf("expected_hash must be a hex SHA256")
+	}
+	return hash, nil
+}
+
+// DisableCanary takes a workload out of the spot-check rotation
+func (h *Handler) DisableCanary(c *gin.Context) {
+	canaryID := c.Param("id")
+
+	err := h.db.DisableCanary(canaryID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canary not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to disable canary %s: %v", canaryID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable canary"})
+		return
+	}
+
+	log.Infof("Canary %s disabled", canaryID)
+
+	c.JSON(http.StatusOK, gin.H{"canary_id": canaryID, "enabled": false})
+}
+
+// ListNodeFlags returns the nodes flagged by collusion detection and why,
+// optionally filtered with ?node_id=
+func (h *Handler) ListNodeFlags(c *gin.Context) {
+	flags, err := h.db.GetNodeFlags(c.Query("node_id"))
+	if err != nil {
+		log.Errorf("Failed to get node flags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve flags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"flags": flags,
+		"count": len(flags),
+	})
+}
+
+// SetShareWeight sets how much of the network a submitter is entitled to
+// relative to others; submitters without a weight have 1. Submitters are the
+// unauthenticated submitted_by clients set on their jobs, so a client can
+// claim another's share, or a fresh one, by naming itself.
+func (h *Handler) SetShareWeight(c *gin.Context) {
+	submitter := c.Param("submitter")
+
+	var req models.ShareWeightRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Weight <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "weight must be positive"})
+		return
+	}
+
+	if err := h.db.SetShareWeight(submitter, req.Weight); err != nil {
+		log.Errorf("Failed to set share weight of %s: %v", submitter, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set share weight"})
+		return
+	}
+
+	log.Infof("Fair-share weight of %s set to %.2f", submitter, req.Weight)
+
+	c.JSON(http.StatusOK, gin.H{"submitted_by": submitter, "weight": req.Weight})
+}
+
+// ReinstateNode lifts the quarantine of a node that failed a spot check or was
+// flagged by collusion detection, and marks its flags as reviewed. Its
+// reputation is left as it is.
+func (h *Handler) ReinstateNode(c *gin.Context) {
+	nodeID := c.Param("id")
+
+	node, err := h.db.GetNode(nodeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	cleared, err := h.db.ClearNodeFlags(nodeID)
+	if err != nil {
+		log.Errorf("Failed to clear flags of node %s: %v", nodeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reinstate node"})
+		return
+	}
+
+	status := node.Status
+	err = h.db.ReinstateNode(nodeID)
+	if err == sql.ErrNoRows {
+		if cleared == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Node is not quarantined or flagged"})
+			return
+		}
+	} else if err != nil {
+		log.Errorf("Failed to reinstate node %s: %v", nodeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reinstate node"})
+		return
+	} else {
+		status = models.NodeStatusOffline
+	}
+
+	log.Infof("Node %s reinstated (%d flags cleared)", nodeID, cleared)
+
+	c.JSON(http.StatusOK, gin.H{"node_id": nodeID, "status": status, "cleared_flags": cleared})
+}
+
+// CordonNode stops new executions going to a node. Its running executions
+// carry on.
+func (h *Handler) CordonNode(c *gin.Context) {
+	h.setCordoned(c, true)
+}
+
+// UncordonNode puts a cordoned or drained node back into rotation
+func (h *Handler) UncordonNode(c *gin.Context) {
+	h.setCordoned(c, false)
+}
+
+func (h *Handler) setCordoned(c *gin.Context, cordoned bool) {
+	nodeID := c.Param("id")
+
+	err := h.db.SetNodeCordoned(nodeID, cordoned)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to update node %s: %v", nodeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update node"})
+		return
+	}
+
+	if cordoned {
+		log.Infof("Node %s cordoned", nodeID)
+	} else {
+		log.Infof("Node %s uncordoned", nodeID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"node_id": nodeID, "cordoned": cordoned})
+}
+
+// DrainNode cordons a node and lets its claimed executions finish, after
+// which it goes offline. It stays out of rotation until uncordoned.
+func (h *Handler) DrainNode(c *gin.Context) {
+	h.drain(c, true)
+}
+
+// NodeDrain lets a worker that is shutting down finish its claimed
+// executions without being sent new ones. It is back in rotation once it
+// registers again.
+func (h *Handler) NodeDrain(c *gin.Context) {
+	h.drain(c, false)
+}
+
+func (h *Handler) drain(c *gin.Context, cordon bool) {
+	nodeID := c.Param("id")
+
+	jobIDs, err := h.db.DrainNode(nodeID, cordon)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+	if errors.Is(err, repository.ErrLocked) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Node is being updated, try again"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to drain node %s: %v", nodeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to drain node"})
+		return
+	}
+	if jobIDs == nil {
+		jobIDs = []string{}
+	}
+
+	log.Infof("Node %s draining, %d unclaimed executions moved elsewhere", nodeID, len(jobIDs))
+
+	c.JSON(http.StatusOK, gin.H{"node_id": nodeID, "draining": true, "rescheduled_jobs": jobIDs})
+}
+
+// SetNodeMaintenance schedules a window during which a node may go silent
+// without losing reputation. No executions are placed on it that couldn't
+// finish before the window starts.
+func (h *Handler) SetNodeMaintenance(c *gin.Context) {
+	nodeID := c.Param("id")
+
+	var req models.MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	start := now
+	if req.Start != nil {
+		start = *req.Start
+	}
+	if !req.End.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end must be after start"})
+		return
+	}
+	if !req.End.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end must be in the future"})
+		return
+	}
+
+	err := h.db.SetNodeMaintenance(nodeID, &start, &req.End)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to set maintenance of node %s: %v", nodeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set maintenance window"})
+		return
+	}
+
+	log.Infof("Node %s maintenance scheduled from %s to %s",
+		nodeID, start.Format(time.RFC3339), req.End.Format(time.RFC3339))
+
+	c.JSON(http.StatusOK, gin.H{"node_id": nodeID, "maintenance_start": start, "maintenance_end": req.End})
+}
+
+// ClearNodeMaintenance cancels a node's maintenance window
+func (h *Handler) ClearNodeMaintenance(c *gin.Context) {
+	nodeID := c.Param("id")
+
+	err := h.db.SetNodeMaintenance(nodeID, nil, nil)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to clear maintenance of node %s: %v", nodeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear maintenance window"})
+		return
+	}
+
+	log.Infof("Node %s maintenance window cleared", nodeID)
+
+	c.JSON(http.StatusOK, gin.H{"node_id": nodeID})
+}
@@ -1,22 +1,37 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"path"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/HildaPosada/distributeai/coordinator/internal/fairshare"
 	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/normalize"
 	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+	"github.com/HildaPosada/distributeai/coordinator/internal/scheduler"
+	"github.com/HildaPosada/distributeai/coordinator/internal/selector"
+	"github.com/HildaPosada/distributeai/coordinator/internal/verification"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
+// leaseDuration is how long a claimed execution stays with a worker without renewal
+const leaseDuration = 60 * time.Second
+
 type Handler struct {
-	db *repository.Database
+	db              repository.Store
+	defaultPolicy   models.VerificationPolicy
+	fairShareWindow time.Duration
 }
 
-func NewHandler(db *repository.Database) *Handler {
-	return &Handler{db: db}
+// NewHandler creates a handler; defaultPolicy applies to jobs that don't
+// request one, and fairShareWindow is how far back the queue counts usage
+func NewHandler(db repository.Store, defaultPolicy models.VerificationPolicy, fairShareWindow time.Duration) *Handler {
+	return &Handler{db: db, defaultPolicy: defaultPolicy, fairShareWindow: fairShareWindow}
 }
 
 // maxInt returns the larger of two integers
@@ -44,23 +59,131 @@ func (h *Handler) SubmitJob(c *gin.Context) {
 		return
 	}
 
+	policy, err := resolveVerificationPolicy(&req, h.defaultPolicy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	maxRedundancy, err := resolveMaxRedundancy(&req, policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	timeout, err := resolveTimeout(&req, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	spread, err := resolveSpread(req.Spread)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.DiskQuotaGB < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "disk_quota_gb must not be negative"})
+		return
+	}
+
+	if req.OutputFile != "" && !path.IsAbs(req.OutputFile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "output_file must be an absolute path"})
+		return
+	}
+
+	if err := normalize.Validate(req.Normalize); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateConsensusWeight(&req, policy, maxRedundancy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := verification.NewComparator(req.Comparator); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Placement != "" {
+		if _, err := scheduler.NewPlacement(req.Placement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.Priority < models.MinJobPriority || req.Priority > models.MaxJobPriority {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("priority must be between %d and %d",
+			models.MinJobPriority, models.MaxJobPriority)})
+		return
+	}
+
+	if err := selector.ValidateJob(req.NodeSelector, req.Affinity, req.Tolerations); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	submittedBy := req.SubmittedBy
+	if submittedBy == "" {
+		submittedBy = "user"
+	}
+
+	requiredCPU := maxInt(req.RequiredCPU, 1)
+	requiredMemory := maxInt(req.RequiredMemory, 1)
+
+	// Reject jobs that could never gather enough independent nodes
+	nodes, err := h.db.GetEligibleNodes(requiredCPU, requiredMemory, req.RequiredGPU)
+	if err != nil {
+		log.Errorf("Failed to get eligible nodes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create job"})
+		return
+	}
+	constraints := &models.Job{NodeSelector: req.NodeSelector, Affinity: req.Affinity, Tolerations: req.Tolerations}
+	eligible := len(selector.Filter(constraints, nodes))
+	if eligible < policy.Redundancy {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": fmt.Sprintf("job needs %d eligible nodes but only %d registered nodes meet its requirements",
+				policy.Redundancy, eligible),
+		})
+		return
+	}
+
 	// Create job with defaults
 	job := &models.Job{
-		ID:             uuid.New().String(),
-		Name:           req.Name,
-		Description:    req.Description,
-		DockerImage:    req.DockerImage,
-		Command:        req.Command,
-		Environment:    req.Environment,
-		InputData:      req.InputData,
-		RequiredCPU:    maxInt(req.RequiredCPU, 1),
-		RequiredMemory: maxInt(req.RequiredMemory, 1),
-		RequiredGPU:    req.RequiredGPU,
-		Redundancy:     3, // Default k-of-n: 3 nodes
-		Consensus:      2, // Need 2 to agree
-		Status:         models.JobStatusPending,
-		SubmittedBy:    "user", // TODO: Add authentication
-		SubmittedAt:    time.Now(),
+		ID:              uuid.New().String(),
+		Name:            req.Name,
+		Description:     req.Description,
+		DockerImage:     req.DockerImage,
+		Command:         req.Command,
+		Environment:     req.Environment,
+		InputData:       req.InputData,
+		RequiredCPU:     requiredCPU,
+		RequiredMemory:  requiredMemory,
+		RequiredGPU:     req.RequiredGPU,
+		DiskQuotaGB:     req.DiskQuotaGB,
+		TimeoutSeconds:  timeout,
+		Deadline:        req.Deadline,
+		OutputFile:      req.OutputFile,
+		Normalize:       req.Normalize,
+		Comparator:      req.Comparator,
+		Spread:          spread,
+		Placement:       req.Placement,
+		Priority:        req.Priority,
+		NonPreemptible:  req.NonPreemptible,
+		NodeSelector:    req.NodeSelector,
+		Affinity:        req.Affinity,
+		Tolerations:     req.Tolerations,
+		ConsensusWeight: req.ConsensusWeight,
+		Adaptive:        req.Adaptive,
+		MaxRedundancy:   maxRedundancy,
+		Redundancy:      policy.Redundancy,
+		Consensus:       policy.Consensus,
+		Status:          models.JobStatusPending,
+		SubmittedBy:     submittedBy, // TODO: Add authentication; submitters name themselves for now
+		SubmittedAt:     time.Now(),
 		CreditsRequired: 1,
 	}
 
@@ -70,11 +193,25 @@ func (h *Handler) SubmitJob(c *gin.Context) {
 		return
 	}
 
-	log.Infof("Job %s submitted: %s", job.ID, job.Name)
+	log.Infof("Job %s submitted: %s (%d-of-%d)", job.ID, job.Name, job.Consensus, job.Redundancy)
 
 	c.JSON(http.StatusCreated, job)
 }
 
+// GetQueue returns pending jobs in the order they will be offered to nodes,
+// and each submitter's position and fair share. Shares are keyed on the
+// submitted_by jobs name themselves with, which nothing authenticates yet.
+func (h *Handler) GetQueue(c *gin.Context) {
+	_, queue, err := fairshare.Snapshot(h.db, h.fairShareWindow)
+	if err != nil {
+		log.Errorf("Failed to build queue: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve queue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, queue)
+}
+
 // GetJob retrieves a specific job by ID
 func (h *Handler) GetJob(c *gin.Context) {
 	jobID := c.Param("id")
@@ -103,6 +240,41 @@ func (h *Handler) ListJobs(c *gin.Context) {
 	})
 }
 
+// CancelJob stops a job that hasn't finished yet. Workers learn about it on
+// their next heartbeat or lease renewal and kill the container.
+func (h *Handler) CancelJob(c *gin.Context) {
+	jobID := c.Param("id")
+
+	job, err := h.db.GetJob(jobID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	nodeIDs, err := h.db.CancelJob(jobID)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Job already %s", job.Status)})
+		return
+	}
+	if errors.Is(err, repository.ErrLocked) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Job is being updated, try again"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to cancel job %s: %v", jobID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel job"})
+		return
+	}
+
+	log.Infof("Job %s cancelled (%d executions stopped)", jobID, len(nodeIDs))
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":               jobID,
+		"status":               models.JobStatusCancelled,
+		"cancelled_executions": len(nodeIDs),
+	})
+}
+
 // GetJobExecutions returns all executions for a job
 func (h *Handler) GetJobExecutions(c *gin.Context) {
 	jobID := c.Param("id")
@@ -129,14 +301,34 @@ func (h *Handler) RegisterNode(c *gin.Context) {
 		return
 	}
 
+	if req.Price < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price must not be negative"})
+		return
+	}
+
+	if err := selector.ValidateNode(req.Labels, req.Taints); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	price := req.Price
+	if price == 0 {
+		price = 1
+	}
+
 	node := &models.Node{
 		ID:              req.ID,
 		Name:            req.Name,
 		Region:          req.Region,
+		Owner:           req.Owner,
+		Host:            req.Host,
+		Price:           price,
+		Labels:          req.Labels,
+		Taints:          req.Taints,
 		CPUCores:        req.CPUCores,
 		MemoryGB:        req.MemoryGB,
 		GPUEnabled:      req.GPUEnabled,
 		GPUModel:        req.GPUModel,
+		MaxSlots:        maxInt(req.MaxSlots, 1),
 		Status:          models.NodeStatusOnline,
 		ReputationScore: 100.0, // Start with perfect reputation
 		LastHeartbeat:   time.Now(),
@@ -149,7 +341,7 @@ func (h *Handler) RegisterNode(c *gin.Context) {
 		return
 	}
 
-	log.Infof("Node registered: %s (%s)", node.ID, node.Name)
+	log.Infof("Node registered: %s (%s) with %d slots", node.ID, node.Name, node.MaxSlots)
 
 	c.JSON(http.StatusCreated, node)
 }
@@ -172,7 +364,16 @@ func (h *Handler) NodeHeartbeat(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	// Tell the worker which of its running executions it should stop
+	cancelled, err := h.db.GetRevokedExecutions(nodeID, heartbeat.ActiveExecutions)
+	if err != nil {
+		log.Warnf("Failed to check executions of node %s: %v", nodeID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":               "ok",
+		"cancelled_executions": cancelled,
+	})
 }
 
 // GetNode retrieves a specific node by ID
@@ -203,76 +404,150 @@ func (h *Handler) ListNodes(c *gin.Context) {
 	})
 }
 
-// GetPendingJobs returns jobs waiting for a worker (for workers to poll)
+// GetPendingJobs returns the executions scheduled on a node that it hasn't
+// claimed yet, with their jobs, most urgent first (for workers to poll)
 func (h *Handler) GetPendingJobs(c *gin.Context) {
-	nodeID := c.Param("nodeId")
+	nodeID := c.Param("id")
 
-	// Get all scheduled executions for this node
-	executions, err := h.db.GetJobExecutions("")
+	pending, err := h.db.GetScheduledExecutions(nodeID)
 	if err != nil {
+		log.Errorf("Failed to get scheduled executions for node %s: %v", nodeID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get executions"})
 		return
 	}
 
-	// Filter for this node and scheduled status
-	var pendingJobs []map[string]interface{}
+	pendingJobs := make([]map[string]interface{}, 0, len(pending))
+	for _, p := range pending {
+		pendingJobs = append(pendingJobs, map[string]interface{}{
+			"execution_id": p.Execution.ID,
+			"job":          p.Job,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pending_jobs": pendingJobs,
+		"count":        len(pendingJobs),
+	})
+}
+
+// ClaimExecution lets a worker atomically take ownership of an execution
+// scheduled on it. The worker must renew the returned lease until it reports a
+// result, otherwise the scheduler hands the execution to another node.
+func (h *Handler) ClaimExecution(c *gin.Context) {
+	executionID := c.Param("id")
 
-	for _, exec := range executions {
-		if exec.NodeID == nodeID && exec.Status == models.JobStatusScheduled {
-			job, err := h.db.GetJob(exec.JobID)
-			if err != nil {
-				continue
-			}
+	var req models.ExecutionLeaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-			pendingJobs = append(pendingJobs, map[string]interface{}{
-				"execution_id": exec.ID,
-				"job":          job,
-			})
+	execution, err := h.db.ClaimJobExecution(executionID, req.NodeID, leaseDuration)
+	if err != nil {
+		if errors.Is(err, repository.ErrLeaseNotHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Execution is not claimable by this node"})
+			return
+		}
+		if errors.Is(err, repository.ErrLocked) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Execution is being updated, try again"})
+			return
 		}
+		log.Errorf("Failed to claim execution %s: %v", executionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim execution"})
+		return
 	}
 
+	job, err := h.db.GetJob(execution.JobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job"})
+		return
+	}
+
+	log.Infof("Execution %s claimed by node %s", execution.ID, req.NodeID)
+
 	c.JSON(http.StatusOK, gin.H{
-		"pending_jobs": pendingJobs,
-		"count":        len(pendingJobs),
+		"execution_id":     execution.ID,
+		"lease_expires_at": execution.LeaseExpiresAt,
+		"lease_seconds":    int(leaseDuration.Seconds()),
+		"job":              job,
 	})
 }
 
-// SubmitJobResult handles job result submission from workers
-func (h *Handler) SubmitJobResult(c *gin.Context) {
-	var result models.JobResultSubmission
+// RenewExecutionLease extends the lease on a running execution
+func (h *Handler) RenewExecutionLease(c *gin.Context) {
+	executionID := c.Param("id")
 
-	if err := c.ShouldBindJSON(&result); err != nil {
+	var req models.ExecutionLeaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get the execution
-	executions, err := h.db.GetJobExecutions(result.JobID)
+	expiresAt, err := h.db.RenewJobExecutionLease(executionID, req.NodeID, leaseDuration)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get execution"})
+		if errors.Is(err, repository.ErrLeaseNotHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Lease lost"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew lease"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"execution_id":     executionID,
+		"lease_expires_at": expiresAt,
+	})
+}
+
+// StartExecution records that a worker's container started, so the
+// execution's timeout is enforced from then rather than from the claim
+func (h *Handler) StartExecution(c *gin.Context) {
+	executionID := c.Param("id")
+
+	var req models.ExecutionLeaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var execution *models.JobExecution
-	for _, exec := range executions {
-		if exec.ID == result.ExecutionID {
-			execution = exec
-			break
+	if err := h.db.StartJobExecution(executionID, req.NodeID); err != nil {
+		if errors.Is(err, repository.ErrLeaseNotHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Lease lost"})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record start"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"execution_id": executionID})
+}
+
+// SubmitJobResult handles job result submission from workers
+func (h *Handler) SubmitJobResult(c *gin.Context) {
+	var result models.JobResultSubmission
+
+	if err := c.ShouldBindJSON(&result); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if execution == nil {
+	execution, err := h.db.GetJobExecution(result.ExecutionID)
+	if err != nil || execution.JobID != result.JobID {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Execution not found"})
 		return
 	}
 
 	// Update execution
 	now := time.Now()
+	execution.NodeID = result.NodeID
 	execution.CompletedAt = &now
 	execution.Result = result.Result
 	execution.ResultHash = result.ResultHash
 	execution.ErrorMessage = result.ErrorMessage
-	execution.Logs = result.Logs
+	execution.ErrorClass = reportedErrorClass(result.ErrorClass)
+	execution.Stdout = result.Stdout
+	execution.Stderr = result.Stderr
+	execution.LeaseExpiresAt = nil
 
 	if result.ErrorMessage != "" {
 		execution.Status = models.JobStatusFailed
@@ -280,29 +555,40 @@ func (h *Handler) SubmitJobResult(c *gin.Context) {
 		execution.Status = models.JobStatusCompleted
 	}
 
-	if err := h.db.UpdateJobExecution(execution); err != nil {
+	// Only the current lease holder may report a result
+	if err := h.db.FinishJobExecution(execution); err != nil {
+		if errors.Is(err, repository.ErrLeaseNotHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Execution is not leased to this node"})
+			return
+		}
 		log.Errorf("Failed to update execution: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update execution"})
 		return
 	}
 
-	// Mark node as online again
-	if err := h.db.UpdateNodeStatus(result.NodeID, models.NodeStatusOnline); err != nil {
-		log.Warnf("Failed to update node status: %v", err)
-	}
-
 	log.Infof("Job result submitted: execution=%s, job=%s, node=%s",
 		result.ExecutionID, result.JobID, result.NodeID)
 
 	c.JSON(http.StatusOK, gin.H{"status": "accepted"})
 }
 
+// reportedErrorClass keeps the error classes a worker may report itself.
+// Anything else (including node_lost, which only the coordinator assigns) is dropped.
+func reportedErrorClass(class models.ErrorClass) models.ErrorClass {
+	switch class {
+	case models.ErrorClassOOMKilled, models.ErrorClassTimedOut, models.ErrorClassInternal:
+		return class
+	default:
+		return ""
+	}
+}
+
 // GetStats returns system statistics
 func (h *Handler) GetStats(c *gin.Context) {
 	nodes, _ := h.db.GetAllNodes()
 	jobs, _ := h.db.GetAllJobs()
 
-	var onlineNodes, busyNodes int
+	var onlineNodes, busyNodes, faultyNodes int
 	var totalCPU, totalMemory int
 
 	for _, node := range nodes {
@@ -310,12 +596,14 @@ func (h *Handler) GetStats(c *gin.Context) {
 			onlineNodes++
 		} else if node.Status == models.NodeStatusBusy {
 			busyNodes++
+		} else if node.Status == models.NodeStatusFaulty {
+			faultyNodes++
 		}
 		totalCPU += node.CPUCores
 		totalMemory += node.MemoryGB
 	}
 
-	var completedJobs, runningJobs, failedJobs int
+	var completedJobs, runningJobs, failedJobs, cancelledJobs, timedOutJobs int
 
 	for _, job := range jobs {
 		switch job.Status {
@@ -325,6 +613,10 @@ func (h *Handler) GetStats(c *gin.Context) {
 			runningJobs++
 		case models.JobStatusFailed:
 			failedJobs++
+		case models.JobStatusCancelled:
+			cancelledJobs++
+		case models.JobStatusTimedOut:
+			timedOutJobs++
 		}
 	}
 
@@ -333,6 +625,7 @@ func (h *Handler) GetStats(c *gin.Context) {
 			"total":  len(nodes),
 			"online": onlineNodes,
 			"busy":   busyNodes,
+			"faulty": faultyNodes,
 		},
 		"resources": gin.H{
 			"total_cpu_cores": totalCPU,
@@ -343,6 +636,8 @@ func (h *Handler) GetStats(c *gin.Context) {
 			"completed": completedJobs,
 			"running":   runningJobs,
 			"failed":    failedJobs,
+			"cancelled": cancelledJobs,
+			"timed_out": timedOutJobs,
 		},
 	})
-}
\ No newline at end of file
+}
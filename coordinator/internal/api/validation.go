@@ -0,0 +1,157 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/verification"
+)
+
+// Per-execution timeout bounds, in seconds
+const (
+	defaultTimeoutSeconds = 5 * 60
+	maxTimeoutSeconds     = 24 * 60 * 60
+)
+
+// resolveVerificationPolicy derives a job's k-of-n policy from the request.
+// Explicit redundancy/consensus values override the trust level preset, which
+// in turn overrides the coordinator default.
+func resolveVerificationPolicy(req *models.JobSubmitRequest, defaults models.VerificationPolicy) (models.VerificationPolicy, error) {
+	policy := defaults
+
+	if req.TrustLevel != "" {
+		preset, ok := models.TrustLevelPolicies[req.TrustLevel]
+		if !ok {
+			return policy, fmt.Errorf("unknown trust_level %q", req.TrustLevel)
+		}
+		policy = preset
+	}
+
+	if req.Redundancy < 0 || req.Consensus < 0 {
+		return policy, fmt.Errorf("redundancy and consensus must not be negative")
+	}
+
+	switch {
+	case req.Redundancy > 0 && req.Consensus > 0:
+		policy = models.VerificationPolicy{Redundancy: req.Redundancy, Consensus: req.Consensus}
+	case req.Redundancy > 0:
+		// Simple majority of the requested replicas
+		policy = models.VerificationPolicy{Redundancy: req.Redundancy, Consensus: req.Redundancy/2 + 1}
+	case req.Consensus > 0:
+		policy = models.VerificationPolicy{Redundancy: maxInt(policy.Redundancy, req.Consensus), Consensus: req.Consensus}
+	}
+
+	if policy.Consensus < 1 {
+		return policy, fmt.Errorf("consensus must be at least 1")
+	}
+	if policy.Consensus > policy.Redundancy {
+		return policy, fmt.Errorf("consensus (%d) cannot exceed redundancy (%d)", policy.Consensus, policy.Redundancy)
+	}
+	if policy.Redundancy > models.MaxRedundancy {
+		return policy, fmt.Errorf("redundancy cannot exceed %d", models.MaxRedundancy)
+	}
+
+	return policy, nil
+}
+
+// resolveMaxRedundancy validates how far a job may grow through tie-breakers
+// and adaptive escalation. Adaptive jobs default to their requested redundancy;
+// other jobs default to 0, which leaves the limit to the coordinator.
+func resolveMaxRedundancy(req *models.JobSubmitRequest, policy models.VerificationPolicy) (int, error) {
+	if req.MaxRedundancy == 0 {
+		if req.Adaptive {
+			return policy.Redundancy, nil
+		}
+		return 0, nil
+	}
+	if req.MaxRedundancy < policy.Redundancy {
+		return 0, fmt.Errorf("max_redundancy (%d) cannot be below redundancy (%d)", req.MaxRedundancy, policy.Redundancy)
+	}
+	if req.MaxRedundancy > models.MaxRedundancy {
+		return 0, fmt.Errorf("max_redundancy cannot exceed %d", models.MaxRedundancy)
+	}
+	return req.MaxRedundancy, nil
+}
+
+// validateConsensusWeight rejects a weighted-consensus threshold that the job
+// could never reach: every vote weighs at most verification.MaxVoteWeight,
+// and the job runs on at most maxRedundancy nodes, or its redundancy when
+// that is left to the coordinator.
+func validateConsensusWeight(req *models.JobSubmitRequest, policy models.VerificationPolicy, maxRedundancy int) error {
+	if req.ConsensusWeight < 0 {
+		return fmt.Errorf("consensus_weight must not be negative")
+	}
+
+	nodes := maxInt(maxRedundancy, policy.Redundancy)
+	if reachable := verification.MaxVoteWeight * float64(nodes); req.ConsensusWeight > reachable {
+		return fmt.Errorf("consensus_weight (%g) cannot exceed %g, the weight of %d nodes at %g each",
+			req.ConsensusWeight, reachable, nodes, verification.MaxVoteWeight)
+	}
+	return nil
+}
+
+// resolveTimeout returns the per-execution timeout for a job. A deadline must
+// leave room for at least one full run, or the job could never finish in time.
+func resolveTimeout(req *models.JobSubmitRequest, now time.Time) (int, error) {
+	timeout := req.TimeoutSeconds
+	if timeout < 0 {
+		return 0, fmt.Errorf("timeout_seconds must not be negative")
+	}
+	if timeout == 0 {
+		timeout = defaultTimeoutSeconds
+	}
+	if timeout > maxTimeoutSeconds {
+		return 0, fmt.Errorf("timeout_seconds cannot exceed %d", maxTimeoutSeconds)
+	}
+
+	if req.Deadline != nil && req.Deadline.Before(now.Add(time.Duration(timeout)*time.Second)) {
+		return 0, fmt.Errorf("deadline must be at least timeout_seconds (%d) in the future", timeout)
+	}
+
+	return timeout, nil
+}
+
+// resolveSpread validates a job's anti-affinity policy. Jobs that don't give
+// one, or give one without domains, spread over the default domains and relax
+// them when needed; an empty domain list turns spreading off.
+func resolveSpread(spread *models.SpreadPolicy) (models.SpreadPolicy, error) {
+	if spread == nil {
+		return models.DefaultSpread(), nil
+	}
+
+	policy := *spread
+	if policy.Domains == nil {
+		policy.Domains = models.DefaultSpreadDomains
+	}
+
+	seen := make(map[models.SpreadDomain]bool)
+	for _, domain := range policy.Domains {
+		switch domain {
+		case models.SpreadOwner, models.SpreadRegion, models.SpreadHost:
+		default:
+			return policy, fmt.Errorf("unknown spread domain %q", domain)
+		}
+		if seen[domain] {
+			return policy, fmt.Errorf("spread domain %q listed twice", domain)
+		}
+		seen[domain] = true
+	}
+
+	switch policy.Mode {
+	case "":
+		policy.Mode = models.SpreadRelax
+	case models.SpreadRelax, models.SpreadStrict:
+	default:
+		return policy, fmt.Errorf("unknown spread mode %q", policy.Mode)
+	}
+
+	if policy.RelaxAfterSeconds < 0 {
+		return policy, fmt.Errorf("relax_after_seconds must not be negative")
+	}
+	if policy.Mode == models.SpreadStrict && policy.RelaxAfterSeconds > 0 {
+		return policy, fmt.Errorf("relax_after_seconds only applies to relax mode")
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,476 @@
+package collusion
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+	"github.com/HildaPosada/distributeai/coordinator/internal/verification"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// historyWindow is how far back votes on disputed jobs are considered
+	historyWindow = 30 * 24 * time.Hour
+	// Two nodes are suspected of colluding once they have voted on at least
+	// minSharedDisputes of the same disputed jobs, agreed on at least
+	// minAgreementRate of them and lost together on at least minLosingRate.
+	// Honest nodes rarely end up on the losing side, let alone together.
+	minSharedDisputes = 5
+	minAgreementRate  = 0.9
+	minLosingRate     = 0.5
+	// Nodes with the same region and capacity registered at most
+	// registrationGap apart form a registration cluster once there are
+	// minRegistrationGroup of them
+	registrationGap      = 10 * time.Minute
+	minRegistrationGroup = 3
+)
+
+// Detector periodically mines verification history for nodes that collude,
+// flags them with an explanation and quarantines them
+type Detector struct {
+	db       repository.Store
+	interval time.Duration
+	stopChan chan struct{}
+}
+
+// NewDetector creates a detector that scans every interval; 0 disables it
+func NewDetector(db repository.Store, interval time.Duration) *Detector {
+	return &Detector{
+		db:       db,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start runs scans until Stop is called
+func (d *Detector) Start() {
+	if d.interval <= 0 {
+		log.Info("Collusion detection disabled")
+		return
+	}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	log.Info("Collusion detection started")
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.Scan(); err != nil {
+				log.Errorf("Collusion scan failed: %v", err)
+			}
+		case <-d.stopChan:
+			log.Info("Collusion detection stopped")
+			return
+		}
+	}
+}
+
+// Stop halts the detector
+func (d *Detector) Stop() {
+	close(d.stopChan)
+}
+
+// flagState indexes the flags raised by earlier scans
+type flagState struct {
+	// Outstanding signals of each node, and whether any of those flags quarantined it
+	active    map[string]map[models.CollusionSignal]bool
+	clearedAt map[string]time.Time // Latest review of each node; older votes are forgiven
+	dismissed map[string]bool      // Nodes whose registration flag was reviewed and cleared
+}
+
+func newFlagState(flags []*models.NodeFlag) *flagState {
+	state := &flagState{
+		active:    make(map[string]map[models.CollusionSignal]bool),
+		clearedAt: make(map[string]time.Time),
+		dismissed: make(map[string]bool),
+	}
+	for _, flag := range flags {
+		if flag.ClearedAt == nil {
+			if state.active[flag.NodeID] == nil {
+				state.active[flag.NodeID] = make(map[models.CollusionSignal]bool)
+			}
+			state.active[flag.NodeID][flag.Signal] = state.active[flag.NodeID][flag.Signal] || flag.Quarantined
+			continue
+		}
+		if flag.ClearedAt.After(state.clearedAt[flag.NodeID]) {
+			state.clearedAt[flag.NodeID] = *flag.ClearedAt
+		}
+		if flag.Signal == models.SignalRegistrationPattern {
+			state.dismissed[flag.NodeID] = true
+		}
+	}
+	return state
+}
+
+// Scan analyses the history once and flags new suspects
+func (d *Detector) Scan() error {
+	now := time.Now()
+
+	flags, err := d.db.GetNodeFlags("")
+	if err != nil {
+		return fmt.Errorf("failed to get flags: %w", err)
+	}
+	state := newFlagState(flags)
+
+	pairs, err := d.votingPairs(now.Add(-historyWindow), state.clearedAt)
+	if err != nil {
+		return err
+	}
+
+	// Nodes suspected on voting grounds, or already faulty, make the nodes
+	// registered alongside them suspect too
+	implicated := make(map[string]bool)
+	for nodeID, signals := range state.active {
+		_, agreement := signals[models.SignalMinorityAgreement]
+		_, bloc := signals[models.SignalVotingBloc]
+		if agreement || bloc {
+			implicated[nodeID] = true
+		}
+	}
+
+	raised := 0
+	for _, flag := range votingFlags(pairs, now) {
+		implicated[flag.NodeID] = true
+		if d.raise(flag, state) {
+			raised++
+		}
+	}
+
+	nodes, err := d.db.GetAllNodes()
+	if err != nil {
+		return fmt.Errorf("failed to get nodes: %w", err)
+	}
+	for _, node := range nodes {
+		if node.Status == models.NodeStatusFaulty {
+			implicated[node.ID] = true
+		}
+	}
+	for _, flag := range registrationFlags(nodes, implicated, now) {
+		if state.dismissed[flag.NodeID] {
+			continue
+		}
+		if d.raise(flag, state) {
+			raised++
+		}
+	}
+
+	log.Infof("Collusion scan: %d node pairs compared, %d new flags", len(pairs), raised)
+	return nil
+}
+
+// raise records a flag unless the node already has an outstanding one for the
+// same signal that went at least as far, and quarantines the node if the flag
+// calls for it
+func (d *Detector) raise(flag *models.NodeFlag, state *flagState) bool {
+	quarantined, flagged := state.active[flag.NodeID][flag.Signal]
+	if flagged && (quarantined || !flag.Quarantined) {
+		return false
+	}
+
+	// The scheduler replaces the executions a quarantine fails on other nodes
+	if _, err := d.db.FlagNode(flag); err != nil {
+		log.Errorf("Failed to flag node %s: %v", flag.NodeID, err)
+		return false
+	}
+	log.Warnf("Node %s flagged for %s: %s", flag.NodeID, flag.Signal, flag.Explanation)
+	if flag.Quarantined {
+		log.Warnf("Node %s quarantined", flag.NodeID)
+	}
+	return true
+}
+
+// nodePair is a pair of node IDs with a < b
+type nodePair struct {
+	a, b string
+}
+
+// pairStats counts how two nodes voted on the disputed jobs they both ran
+type pairStats struct {
+	shared int // Disputed jobs both completed
+	agreed int // ... where their results were equivalent
+	losing int // ... where they agreed on a result other than the consensus
+}
+
+func (p pairStats) suspicious() bool {
+	return p.shared >= minSharedDisputes &&
+		float64(p.agreed) >= minAgreementRate*float64(p.shared) &&
+		float64(p.losing) >= minLosingRate*float64(p.shared)
+}
+
+// votingPairs compares every two nodes that voted on the same disputed jobs
+// since the given time. Votes cast before a node was last reviewed are skipped.
+func (d *Detector) votingPairs(since time.Time, clearedAt map[string]time.Time) (map[nodePair]*pairStats, error) {
+	executions, err := d.db.GetDisputedExecutions(since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disputed executions: %w", err)
+	}
+
+	byJob := make(map[string][]*models.JobExecution)
+	var jobIDs []string
+	for _, exec := range executions {
+		if byJob[exec.JobID] == nil {
+			jobIDs = append(jobIDs, exec.JobID)
+		}
+		byJob[exec.JobID] = append(byJob[exec.JobID], exec)
+	}
+
+	pairs := make(map[nodePair]*pairStats)
+	if len(jobIDs) == 0 {
+		return pairs, nil
+	}
+
+	jobs, err := d.db.GetJobs(jobIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jobs: %w", err)
+	}
+
+	for _, job := range jobs {
+		groups, err := verification.ResultGroups(job, byJob[job.ID])
+		if err != nil {
+			log.Warnf("Skipping job %s in collusion scan: %v", job.ID, err)
+			continue
+		}
+		// Results that only differed in their hash aren't a dispute
+		if len(groups) < 2 {
+			continue
+		}
+		winner := consensusGroup(job, groups)
+
+		// Each node's result group
+		votes := make(map[string]int)
+		for i, group := range groups {
+			for _, exec := range group {
+				if _, seen := votes[exec.NodeID]; seen || exec.CompletedAt == nil {
+					continue
+				}
+				if exec.CompletedAt.Before(clearedAt[exec.NodeID]) {
+					continue
+				}
+				votes[exec.NodeID] = i
+			}
+		}
+
+		for x, vx := range votes {
+			for y, vy := range votes {
+				if x >= y {
+					continue
+				}
+				key := nodePair{a: x, b: y}
+				stats := pairs[key]
+				if stats == nil {
+					stats = &pairStats{}
+					pairs[key] = stats
+				}
+				stats.shared++
+				if vx == vy {
+					stats.agreed++
+					if winner >= 0 && vx != winner {
+						stats.losing++
+					}
+				}
+			}
+		}
+	}
+
+	return pairs, nil
+}
+
+// consensusGroup returns the index of the group that won job's consensus: the
+// one its verification agreed with, or else a strictly largest group. It
+// returns -1 if there is no winner.
+func consensusGroup(job *models.Job, groups [][]*models.JobExecution) int {
+	if job.Verification != nil && job.Verification.ConsensusReached && len(job.Verification.AgreementNodes) > 0 {
+		agreed := job.Verification.AgreementNodes[0]
+		for i, group := range groups {
+			for _, exec := range group {
+				if exec.NodeID == agreed {
+					return i
+				}
+			}
+		}
+	}
+
+	winner, best, tied := -1, 0, false
+	for i, group := range groups {
+		switch {
+		case len(group) > best:
+			winner, best, tied = i, len(group), false
+		case len(group) == best:
+			tied = true
+		}
+	}
+	if tied {
+		return -1
+	}
+	return winner
+}
+
+// votingFlags turns suspicious pairs into flags. Nodes linked by suspicious
+// pairs into a group of three or more are flagged as a voting bloc, the rest
+// for agreeing with their partner.
+func votingFlags(pairs map[nodePair]*pairStats, now time.Time) []*models.NodeFlag {
+	partners := make(map[string][]string)
+	totals := make(map[string]*pairStats)
+	for key, stats := range pairs {
+		if !stats.suspicious() {
+			continue
+		}
+		partners[key.a] = append(partners[key.a], key.b)
+		partners[key.b] = append(partners[key.b], key.a)
+		for _, nodeID := range []string{key.a, key.b} {
+			if totals[nodeID] == nil {
+				totals[nodeID] = &pairStats{}
+			}
+			totals[nodeID].shared += stats.shared
+			totals[nodeID].agreed += stats.agreed
+			totals[nodeID].losing += stats.losing
+		}
+	}
+
+	var flags []*models.NodeFlag
+	for _, bloc := range components(partners) {
+		for _, nodeID := range bloc {
+			others := without(bloc, nodeID)
+			total := totals[nodeID]
+			flag := &models.NodeFlag{
+				ID:           uuid.New().String(),
+				NodeID:       nodeID,
+				RelatedNodes: others,
+				Quarantined:  true,
+				FlaggedAt:    now,
+			}
+			if len(bloc) > 2 {
+				flag.Signal = models.SignalVotingBloc
+				flag.Explanation = fmt.Sprintf(
+					"Votes as a bloc with nodes %s: agreed with them on %d of %d shared disputed jobs, %d against consensus",
+					strings.Join(others, ", "), total.agreed, total.shared, total.losing)
+			} else {
+				flag.Signal = models.SignalMinorityAgreement
+				flag.Explanation = fmt.Sprintf(
+					"Agreed with node %s on %d of %d shared disputed jobs, %d against consensus",
+					others[0], total.agreed, total.shared, total.losing)
+			}
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// components returns the connected groups of nodes in a partner graph, each
+// sorted by node ID
+func components(partners map[string][]string) [][]string {
+	var nodeIDs []string
+	for nodeID := range partners {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+
+	visited := make(map[string]bool)
+	var groups [][]string
+	for _, start := range nodeIDs {
+		if visited[start] {
+			continue
+		}
+		visited[start] = true
+		group := []string{}
+		queue := []string{start}
+		for len(queue) > 0 {
+			nodeID := queue[0]
+			queue = queue[1:]
+			group = append(group, nodeID)
+			for _, partner := range partners[nodeID] {
+				if !visited[partner] {
+					visited[partner] = true
+					queue = append(queue, partner)
+				}
+			}
+		}
+		sort.Strings(group)
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// registrationFlags flags nodes that registered in quick succession with the
+// same region and capacity. Such a cluster alone may just be one operator's
+// fleet, so it is only quarantined if one of its nodes is implicated.
+func registrationFlags(nodes []*models.Node, implicated map[string]bool, now time.Time) []*models.NodeFlag {
+	profiles := make(map[string][]*models.Node)
+	for _, node := range nodes {
+		key := fmt.Sprintf("%s|%d|%d|%t|%s|%d", node.Region, node.CPUCores, node.MemoryGB,
+			node.GPUEnabled, node.GPUModel, node.MaxSlots)
+		profiles[key] = append(profiles[key], node)
+	}
+
+	var flags []*models.NodeFlag
+	for _, profile := range profiles {
+		sort.Slice(profile, func(i, j int) bool {
+			return profile[i].RegisteredAt.Before(profile[j].RegisteredAt)
+		})
+
+		start := 0
+		for i := 1; i <= len(profile); i++ {
+			if i < len(profile) && profile[i].RegisteredAt.Sub(profile[i-1].RegisteredAt) <= registrationGap {
+				continue
+			}
+			if cluster := profile[start:i]; len(cluster) >= minRegistrationGroup {
+				flags = append(flags, clusterFlags(cluster, implicated, now)...)
+			}
+			start = i
+		}
+	}
+	return flags
+}
+
+func clusterFlags(cluster []*models.Node, implicated map[string]bool, now time.Time) []*models.NodeFlag {
+	var ids, suspects []string
+	for _, node := range cluster {
+		ids = append(ids, node.ID)
+		if implicated[node.ID] {
+			suspects = append(suspects, node.ID)
+		}
+	}
+	sort.Strings(ids)
+
+	first, last := cluster[0], cluster[len(cluster)-1]
+	var flags []*models.NodeFlag
+	for _, node := range cluster {
+		others := without(ids, node.ID)
+		explanation := fmt.Sprintf(
+			"Registered within %s of nodes %s, all in region %q with %d CPU, %d GB memory and %d slots",
+			last.RegisteredAt.Sub(first.RegisteredAt).Round(time.Second), strings.Join(others, ", "),
+			node.Region, node.CPUCores, node.MemoryGB, node.MaxSlots)
+		if len(suspects) > 0 {
+			explanation += fmt.Sprintf("; already suspected: %s", strings.Join(suspects, ", "))
+		}
+
+		flags = append(flags, &models.NodeFlag{
+			ID:           uuid.New().String(),
+			NodeID:       node.ID,
+			Signal:       models.SignalRegistrationPattern,
+			Explanation:  explanation,
+			RelatedNodes: others,
+			Quarantined:  len(suspects) > 0,
+			FlaggedAt:    now,
+		})
+	}
+	return flags
+}
+
+// without returns ids minus one of them
+func without(ids []string, id string) []string {
+	var rest []string
+	for _, other := range ids {
+		if other != id {
+			rest = append(rest, other)
+		}
+	}
+	return rest
+}
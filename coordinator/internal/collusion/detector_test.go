@@ -0,0 +1,303 @@
+package collusion
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/normalize"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+)
+
+// registerNodes registers single-slot nodes of the same profile, each
+// registered gap after the previous one
+func registerNodes(t *testing.T, db repository.Store, start time.Time, gap time.Duration, ids ...string) {
+	t.Helper()
+	for i, id := range ids {
+		err := db.RegisterNode(&models.Node{
+			ID: id, Name: id, Region: "us-west", CPUCores: 4, MemoryGB: 8, Status: models.NodeStatusOnline,
+			ReputationScore: 100, LastHeartbeat: time.Now(), RegisteredAt: start.Add(time.Duration(i) * gap),
+			MaxSlots: 1,
+		})
+		if err != nil {
+			t.Fatalf("RegisterNode(%s): %v", id, err)
+		}
+	}
+}
+
+// vote runs a job on the nodes in results, each completing with its result
+func vote(t *testing.T, db repository.Store, jobID string, results map[string]string) {
+	t.Helper()
+	now := time.Now()
+	job := &models.Job{
+		ID: jobID, Name: jobID, DockerImage: "alpine:3", Command: []string{"echo", jobID},
+		RequiredCPU: 1, RequiredMemory: 1, Redundancy: len(results), Consensus: len(results)/2 + 1,
+		Status: models.JobStatusPending, SubmittedAt: now,
+	}
+	if err := db.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob(%s): %v", jobID, err)
+	}
+
+	deadline := now.Add(time.Minute)
+	var executions []*models.JobExecution
+	for nodeID := range results {
+		executions = append(executions, &models.JobExecution{
+			ID: jobID + "-" + nodeID, JobID: jobID, NodeID: nodeID, Status: models.JobStatusScheduled,
+			StartedAt: now, LeaseExpiresAt: &deadline,
+		})
+	}
+	if err := db.ScheduleJob(jobID, executions); err != nil {
+		t.Fatalf("ScheduleJob(%s): %v", jobID, err)
+	}
+
+	for _, exec := range executions {
+		if _, err := db.ClaimJobExecution(exec.ID, exec.NodeID, time.Minute); err != nil {
+			t.Fatalf("ClaimJobExecution(%s): %v", exec.ID, err)
+		}
+		completed := time.Now()
+		exec.Status, exec.CompletedAt = models.JobStatusCompleted, &completed
+		exec.Result = results[exec.NodeID]
+		exec.ResultHash = normalize.Hash(exec.Result)
+		if err := db.FinishJobExecution(exec); err != nil {
+			t.Fatalf("FinishJobExecution(%s): %v", exec.ID, err)
+		}
+	}
+}
+
+// flagsBySignal returns the flagged node IDs for each signal, sorted
+func flagsBySignal(t *testing.T, db repository.Store) map[models.CollusionSignal][]string {
+	t.Helper()
+	flags, err := db.GetNodeFlags("")
+	if err != nil {
+		t.Fatalf("GetNodeFlags: %v", err)
+	}
+	bySignal := make(map[models.CollusionSignal][]string)
+	for _, flag := range flags {
+		bySignal[flag.Signal] = append(bySignal[flag.Signal], flag.NodeID)
+	}
+	for _, ids := range bySignal {
+		sort.Strings(ids)
+	}
+	return bySignal
+}
+
+func TestPairStatsSuspicious(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats pairStats
+		want  bool
+	}{
+		{"at every threshold", pairStats{shared: 5, agreed: 5, losing: 5}, true},
+		{"too few shared disputes", pairStats{shared: 4, agreed: 4, losing: 4}, false},
+		{"agreement on the boundary", pairStats{shared: 10, agreed: 9, losing: 5}, true},
+		{"agreement below 0.9", pairStats{shared: 10, agreed: 8, losing: 8}, false},
+		{"losing on the boundary", pairStats{shared: 10, agreed: 10, losing: 5}, true},
+		{"losing below 0.5", pairStats{shared: 10, agreed: 10, losing: 4}, false},
+		{"agreeing with consensus", pairStats{shared: 20, agreed: 20, losing: 0}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.stats.suspicious(); got != tt.want {
+			t.Errorf("%s: %+v suspicious = %t, want %t", tt.name, tt.stats, got, tt.want)
+		}
+	}
+}
+
+func TestScanFlagsPairsLosingTogether(t *testing.T) {
+	tests := []struct {
+		name     string
+		disputes int
+		flagged  bool
+	}{
+		{"below the shared dispute threshold", minSharedDisputes - 1, false},
+		{"at the shared dispute threshold", minSharedDisputes, true},
+	}
+
+	for _, tt := range tests {
+		db := repository.NewMemoryStore()
+		// Registered far apart, so no registration pattern
+		registerNodes(t, db, time.Now().Add(-48*time.Hour), time.Hour, "bad-a", "bad-b", "good-a", "good-b", "good-c")
+
+		for i := 0; i < tt.disputes; i++ {
+			vote(t, db, fmt.Sprintf("job-%d", i), map[string]string{
+				"bad-a": "wrong", "bad-b": "wrong", "good-a": "right", "good-b": "right", "good-c": "right",
+			})
+		}
+		if err := NewDetector(db, 0).Scan(); err != nil {
+			t.Fatalf("%s: Scan: %v", tt.name, err)
+		}
+
+		var want []string
+		if tt.flagged {
+			want = []string{"bad-a", "bad-b"}
+		}
+		if got := flagsBySignal(t, db); !reflect.DeepEqual(got[models.SignalMinorityAgreement], want) || len(got) > 1 {
+			t.Errorf("%s: flags %v, want %v for %s only", tt.name, got, want, models.SignalMinorityAgreement)
+		}
+		for _, id := range []string{"bad-a", "bad-b", "good-a"} {
+			node, _ := db.GetNode(id)
+			quarantined := node.Status == models.NodeStatusFaulty
+			if want := tt.flagged && id != "good-a"; quarantined != want {
+				t.Errorf("%s: node %s is %s, quarantined = %t, want %t", tt.name, id, node.Status, quarantined, want)
+			}
+		}
+	}
+}
+
+func TestScanDoesNotReflagOutstandingSuspects(t *testing.T) {
+	db := repository.NewMemoryStore()
+	registerNodes(t, db, time.Now().Add(-48*time.Hour), time.Hour, "bad-a", "bad-b", "good-a", "good-b", "good-c")
+	for i := 0; i < minSharedDisputes; i++ {
+		vote(t, db, fmt.Sprintf("job-%d", i), map[string]string{
+			"bad-a": "wrong", "bad-b": "wrong", "good-a": "right", "good-b": "right", "good-c": "right",
+		})
+	}
+
+	detector := NewDetector(db, 0)
+	for i := 0; i < 2; i++ {
+		if err := detector.Scan(); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+	}
+	if got := flagsBySignal(t, db)[models.SignalMinorityAgreement]; len(got) != 2 {
+		t.Errorf("flagged %v after two scans, want each suspect flagged once", got)
+	}
+}
+
+func TestVotingFlagsGroupsBlocs(t *testing.T) {
+	suspicious := &pairStats{shared: 5, agreed: 5, losing: 5}
+	pairs := map[nodePair]*pairStats{
+		// a-b-c are linked through b, though a and c never met
+		{a: "a", b: "b"}: suspicious,
+		{a: "b", b: "c"}: suspicious,
+		{a: "d", b: "e"}: suspicious,
+		// Not suspicious, so it doesn't join the two groups
+		{a: "c", b: "d"}: {shared: 5, agreed: 5, losing: 0},
+	}
+
+	signals := make(map[string]models.CollusionSignal)
+	related := make(map[string][]string)
+	for _, flag := range votingFlags(pairs, time.Now()) {
+		if !flag.Quarantined {
+			t.Errorf("flag on %s doesn't quarantine it", flag.NodeID)
+		}
+		signals[flag.NodeID] = flag.Signal
+		related[flag.NodeID] = flag.RelatedNodes
+	}
+
+	wantSignals := map[string]models.CollusionSignal{
+		"a": models.SignalVotingBloc, "b": models.SignalVotingBloc, "c": models.SignalVotingBloc,
+		"d": models.SignalMinorityAgreement, "e": models.SignalMinorityAgreement,
+	}
+	if !reflect.DeepEqual(signals, wantSignals) {
+		t.Errorf("signals %v, want %v", signals, wantSignals)
+	}
+	wantRelated := map[string][]string{
+		"a": {"b", "c"}, "b": {"a", "c"}, "c": {"a", "b"}, "d": {"e"}, "e": {"d"},
+	}
+	if !reflect.DeepEqual(related, wantRelated) {
+		t.Errorf("related nodes %v, want %v", related, wantRelated)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	partners := map[string][]string{
+		"c": {"b"}, "b": {"a", "c"}, "a": {"b"},
+		"z": {"y"}, "y": {"z"},
+		"m": {},
+	}
+	want := [][]string{{"a", "b", "c"}, {"m"}, {"y", "z"}}
+	if got := components(partners); !reflect.DeepEqual(got, want) {
+		t.Errorf("components = %v, want %v", got, want)
+	}
+}
+
+func TestRegistrationFlags(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	node := func(id string, offset time.Duration, cpu int) *models.Node {
+		return &models.Node{ID: id, Region: "us-west", CPUCores: cpu, MemoryGB: 8, MaxSlots: 1,
+			RegisteredAt: start.Add(offset)}
+	}
+
+	tests := []struct {
+		name        string
+		nodes       []*models.Node
+		implicated  map[string]bool
+		flagged     []string
+		quarantined bool
+	}{
+		{"burst of three", []*models.Node{
+			node("a", 0, 4), node("b", 5*time.Minute, 4), node("c", 10*time.Minute, 4),
+		}, nil, []string{"a", "b", "c"}, false},
+		{"burst with a suspect", []*models.Node{
+			node("a", 0, 4), node("b", 5*time.Minute, 4), node("c", 10*time.Minute, 4),
+		}, map[string]bool{"b": true}, []string{"a", "b", "c"}, true},
+		{"chained within the gap", []*models.Node{
+			node("a", 0, 4), node("b", registrationGap, 4), node("c", 2*registrationGap, 4),
+		}, nil, []string{"a", "b", "c"}, false},
+		{"gap too long", []*models.Node{
+			node("a", 0, 4), node("b", 5*time.Minute, 4), node("c", 5*time.Minute+registrationGap+time.Second, 4),
+		}, nil, nil, false},
+		{"too few", []*models.Node{
+			node("a", 0, 4), node("b", time.Minute, 4),
+		}, nil, nil, false},
+		{"different capacity", []*models.Node{
+			node("a", 0, 4), node("b", time.Minute, 4), node("c", 2*time.Minute, 8),
+		}, nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		var flagged []string
+		for _, flag := range registrationFlags(tt.nodes, tt.implicated, time.Now()) {
+			flagged = append(flagged, flag.NodeID)
+			if flag.Signal != models.SignalRegistrationPattern {
+				t.Errorf("%s: %s flagged for %s", tt.name, flag.NodeID, flag.Signal)
+			}
+			if flag.Quarantined != tt.quarantined {
+				t.Errorf("%s: %s quarantined = %t, want %t", tt.name, flag.NodeID, flag.Quarantined, tt.quarantined)
+			}
+			if len(flag.RelatedNodes) != len(tt.flagged)-1 {
+				t.Errorf("%s: %s related to %v", tt.name, flag.NodeID, flag.RelatedNodes)
+			}
+		}
+		sort.Strings(flagged)
+		if !reflect.DeepEqual(flagged, tt.flagged) {
+			t.Errorf("%s: flagged %v, want %v", tt.name, flagged, tt.flagged)
+		}
+	}
+}
+
+func TestScanQuarantinesBurstWithFaultyNode(t *testing.T) {
+	db := repository.NewMemoryStore()
+	registerNodes(t, db, time.Now().Add(-time.Hour), time.Minute, "fleet-a", "fleet-b", "fleet-c")
+
+	// Alone, a burst is only flagged
+	detector := NewDetector(db, 0)
+	if err := detector.Scan(); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if got := flagsBySignal(t, db)[models.SignalRegistrationPattern]; len(got) != 3 {
+		t.Fatalf("flagged %v, want the whole burst", got)
+	}
+	for _, id := range []string{"fleet-a", "fleet-b", "fleet-c"} {
+		if node, _ := db.GetNode(id); node.Status == models.NodeStatusFaulty {
+			t.Errorf("node %s quarantined for registering in a burst alone", id)
+		}
+	}
+
+	// Once one of them is caught, the rest are quarantined with it
+	if _, err := db.QuarantineNode("fleet-b", "Node quarantined"); err != nil {
+		t.Fatalf("QuarantineNode: %v", err)
+	}
+	if err := detector.Scan(); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	for _, id := range []string{"fleet-a", "fleet-c"} {
+		if node, _ := db.GetNode(id); node.Status != models.NodeStatusFaulty {
+			t.Errorf("node %s is %s after a node from its burst was quarantined, want faulty", id, node.Status)
+		}
+	}
+}
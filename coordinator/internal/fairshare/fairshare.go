@@ -0,0 +1,163 @@
+package fairshare
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+)
+
+// DefaultWeight is the share of submitters without a configured weight
+const DefaultWeight = 1.0
+
+// Order interleaves pending jobs across submitters by weighted fair sharing.
+// jobs must already be in each submitter's own order. The next job always
+// comes from the submitter with the least node time per unit of weight, who
+// is then charged the job's worst case, its redundancy times its timeout, so
+// one submitter's backlog can't crowd out the others between scheduling
+// passes. Ties go to the submitter whose next job has waited longest.
+func Order(jobs []*models.Job, usage, weights map[string]float64) []*models.Job {
+	queues := make(map[string][]*models.Job)
+	var submitters []string
+	for _, job := range jobs {
+		if _, ok := queues[job.SubmittedBy]; !ok {
+			submitters = append(submitters, job.SubmittedBy)
+		}
+		queues[job.SubmittedBy] = append(queues[job.SubmittedBy], job)
+	}
+
+	charged := make(map[string]float64, len(submitters))
+	for _, submitter := range submitters {
+		charged[submitter] = usage[submitter]
+	}
+
+	ordered := make([]*models.Job, 0, len(jobs))
+	for len(ordered) < len(jobs) {
+		var next string
+		for _, submitter := range submitters {
+			if len(queues[submitter]) == 0 {
+				continue
+			}
+			if next == "" || before(submitter, next, queues, charged, weights) {
+				next = submitter
+			}
+		}
+
+		job := queues[next][0]
+		queues[next] = queues[next][1:]
+		charged[next] += cost(job)
+		ordered = append(ordered, job)
+	}
+	return ordered
+}
+
+// before reports whether submitter a is owed the next job ahead of b
+func before(a, b string, queues map[string][]*models.Job, charged, weights map[string]float64) bool {
+	da := charged[a] / Weight(weights, a)
+	db := charged[b] / Weight(weights, b)
+	if da != db {
+		return da < db
+	}
+	return queues[a][0].SubmittedAt.Before(queues[b][0].SubmittedAt)
+}
+
+// cost is the most node time a job can take before a node gives up on it
+func cost(job *models.Job) float64 {
+	return float64(job.Redundancy) * float64(job.TimeoutSeconds)
+}
+
+// Weight returns a submitter's configured weight, or DefaultWeight
+func Weight(weights map[string]float64, submitter string) float64 {
+	if w, ok := weights[submitter]; ok && w > 0 {
+		return w
+	}
+	return DefaultWeight
+}
+
+// Snapshot loads the pending jobs and returns them in fair-share order along
+// with each submitter's standing. Usage is counted over the past window.
+func Snapshot(db repository.Store, window time.Duration) ([]*models.Job, *models.FairShareQueue, error) {
+	jobs, err := db.GetPendingJobs()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get pending jobs: %w", err)
+	}
+	usage, err := db.GetSubmitterUsage(time.Now().Add(-window))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get submitter usage: %w", err)
+	}
+	weights, err := db.GetShareWeights()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get share weights: %w", err)
+	}
+
+	ordered := Order(jobs, usage, weights)
+	return ordered, report(ordered, usage, weights, window), nil
+}
+
+// report describes the queue and every submitter with pending jobs or recent
+// usage
+func report(ordered []*models.Job, usage, weights map[string]float64, window time.Duration) *models.FairShareQueue {
+	queue := &models.FairShareQueue{
+		WindowSeconds: int(window.Seconds()),
+		Tenants:       []*models.TenantShare{},
+		Jobs:          make([]*models.QueuedJob, len(ordered)),
+	}
+
+	tenants := make(map[string]*models.TenantShare)
+	tenant := func(submitter string) *models.TenantShare {
+		if t, ok := tenants[submitter]; ok {
+			return t
+		}
+		t := &models.TenantShare{
+			SubmittedBy:  submitter,
+			Weight:       Weight(weights, submitter),
+			UsageSeconds: usage[submitter],
+		}
+		tenants[submitter] = t
+		queue.Tenants = append(queue.Tenants, t)
+		return t
+	}
+
+	for i, job := range ordered {
+		queue.Jobs[i] = &models.QueuedJob{
+			Position:    i + 1,
+			JobID:       job.ID,
+			Name:        job.Name,
+			SubmittedBy: job.SubmittedBy,
+			Priority:    job.Priority,
+			SubmittedAt: job.SubmittedAt,
+		}
+		t := tenant(job.SubmittedBy)
+		t.PendingJobs++
+		if t.NextPosition == 0 {
+			t.NextPosition = i + 1
+		}
+	}
+
+	idle := make([]string, 0, len(usage))
+	for submitter := range usage {
+		if _, ok := tenants[submitter]; !ok {
+			idle = append(idle, submitter)
+		}
+	}
+	sort.Strings(idle)
+	for _, submitter := range idle {
+		tenant(submitter)
+	}
+
+	var totalUsage, totalWeight float64
+	for _, t := range queue.Tenants {
+		totalUsage += t.UsageSeconds
+		totalWeight += t.Weight
+	}
+	for _, t := range queue.Tenants {
+		if totalUsage > 0 {
+			t.Share = t.UsageSeconds / totalUsage
+		}
+		t.TargetShare = t.Weight / totalWeight
+	}
+
+	return queue
+}
@@ -0,0 +1,113 @@
+package fairshare
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+// queue returns pending jobs, n per submitter, in each submitter's own order.
+// Job IDs are the submitter followed by the job's number, e.g. "a1".
+func queue(n int, redundancy map[string]int, submitters ...string) []*models.Job {
+	start := time.Now().Add(-time.Hour)
+	var jobs []*models.Job
+	for i := 1; i <= n; i++ {
+		for s, submitter := range submitters {
+			r := redundancy[submitter]
+			if r == 0 {
+				r = 1
+			}
+			jobs = append(jobs, &models.Job{
+				ID:             fmt.Sprintf("%s%d", submitter, i),
+				SubmittedBy:    submitter,
+				SubmittedAt:    start.Add(time.Duration(i*len(submitters)+s) * time.Second),
+				Redundancy:     r,
+				TimeoutSeconds: 100,
+			})
+		}
+	}
+	return jobs
+}
+
+func ids(jobs []*models.Job) string {
+	parts := make([]string, len(jobs))
+	for i, job := range jobs {
+		parts[i] = job.ID
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobs    []*models.Job
+		usage   map[string]float64
+		weights map[string]float64
+		want    string
+	}{
+		{
+			name: "equal shares alternate, oldest first on ties",
+			jobs: queue(3, nil, "a", "b"),
+			want: "a1 b1 a2 b2 a3 b3",
+		},
+		{
+			name:    "double weight gets two jobs for each of the other's",
+			jobs:    queue(4, nil, "a", "b"),
+			weights: map[string]float64{"b": 2},
+			want:    "a1 b1 b2 a2 b3 b4 a3 a4",
+		},
+		{
+			name:  "past usage is made up for first",
+			jobs:  queue(3, nil, "a", "b"),
+			usage: map[string]float64{"a": 200},
+			want:  "b1 b2 a1 b3 a2 a3",
+		},
+		{
+			name: "costlier jobs take a bigger turn",
+			jobs: queue(4, map[string]int{"a": 3}, "a", "b"),
+			want: "a1 b1 b2 b3 a2 b4 a3 a4",
+		},
+		{
+			name:    "weight offsets usage",
+			jobs:    queue(2, nil, "a", "b", "c"),
+			usage:   map[string]float64{"a": 200, "b": 100},
+			weights: map[string]float64{"a": 4},
+			want:    "c1 a1 a2 b1 c2 b2",
+		},
+		{
+			name:    "non-positive weights count as the default",
+			jobs:    queue(2, nil, "a", "b"),
+			weights: map[string]float64{"a": 0, "b": -1},
+			want:    "a1 b1 a2 b2",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := ids(Order(tt.jobs, tt.usage, tt.weights)); got != tt.want {
+			t.Errorf("%s: order %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrderKeepsEachSubmittersOwnOrder(t *testing.T) {
+	jobs := queue(5, map[string]int{"b": 2}, "a", "b", "c")
+	ordered := Order(jobs, map[string]float64{"c": 300}, map[string]float64{"a": 3})
+
+	if len(ordered) != len(jobs) {
+		t.Fatalf("ordered %d jobs, want %d", len(ordered), len(jobs))
+	}
+	own := make(map[string][]string)
+	for _, job := range ordered {
+		own[job.SubmittedBy] = append(own[job.SubmittedBy], job.ID)
+	}
+	for _, submitter := range []string{"a", "b", "c"} {
+		want := []string{submitter + "1", submitter + "2", submitter + "3", submitter + "4", submitter + "5"}
+		if !reflect.DeepEqual(own[submitter], want) {
+			t.Errorf("%s's jobs ordered %v, want %v", submitter, own[submitter], want)
+		}
+	}
+}
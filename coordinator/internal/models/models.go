@@ -8,133 +8,601 @@ import (
 type JobStatus string
 
 const (
-	JobStatusPending    JobStatus = "pending"
-	JobStatusScheduled  JobStatus = "scheduled"
-	JobStatusRunning    JobStatus = "running"
-	JobStatusVerifying  JobStatus = "verifying"
-	JobStatusCompleted  JobStatus = "completed"
-	JobStatusFailed     JobStatus = "failed"
+	JobStatusPending   JobStatus = "pending"
+	JobStatusScheduled JobStatus = "scheduled"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusVerifying JobStatus = "verifying"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+	JobStatusTimedOut  JobStatus = "timed_out"
 )
 
+// IsFinished reports whether a job in this status will never change again
+func (s JobStatus) IsFinished() bool {
+	switch s {
+	case JobStatusCompleted, JobStatusFailed, JobStatusCancelled, JobStatusTimedOut:
+		return true
+	default:
+		return false
+	}
+}
+
 // Job represents a compute job to be executed
 type Job struct {
-	ID              string                 `json:"id" db:"id"`
-	Name            string                 `json:"name" db:"name"`
-	Description     string                 `json:"description" db:"description"`
-	DockerImage     string                 `json:"docker_image" db:"docker_image"`
-	Command         []string               `json:"command" db:"command"`
-	Environment     map[string]string      `json:"environment" db:"environment"`
-	InputData       string                 `json:"input_data" db:"input_data"`
-	RequiredCPU     int                    `json:"required_cpu" db:"required_cpu"`
-	RequiredMemory  int                    `json:"required_memory" db:"required_memory"`
-	RequiredGPU     bool                   `json:"required_gpu" db:"required_gpu"`
-	Redundancy      int                    `json:"redundancy" db:"redundancy"` // How many nodes to run on
-	Consensus       int                    `json:"consensus" db:"consensus"`   // How many must agree
-	Status          JobStatus              `json:"status" db:"status"`
-	SubmittedBy     string                 `json:"submitted_by" db:"submitted_by"`
-	SubmittedAt     time.Time              `json:"submitted_at" db:"submitted_at"`
-	StartedAt       *time.Time             `json:"started_at,omitempty" db:"started_at"`
-	CompletedAt     *time.Time             `json:"completed_at,omitempty" db:"completed_at"`
-	Result          string                 `json:"result,omitempty" db:"result"`
-	ErrorMessage    string                 `json:"error_message,omitempty" db:"error_message"`
-	CreditsRequired int                    `json:"credits_required" db:"credits_required"`
+	ID              string              `json:"id" db:"id"`
+	Name            string              `json:"name" db:"name"`
+	Description     string              `json:"description" db:"description"`
+	DockerImage     string              `json:"docker_image" db:"docker_image"`
+	Command         []string            `json:"command" db:"command"`
+	Environment     map[string]string   `json:"environment" db:"environment"`
+	InputData       string              `json:"input_data" db:"input_data"`
+	RequiredCPU     int                 `json:"required_cpu" db:"required_cpu"`
+	RequiredMemory  int                 `json:"required_memory" db:"required_memory"`
+	RequiredGPU     bool                `json:"required_gpu" db:"required_gpu"`
+	DiskQuotaGB     int                 `json:"disk_quota_gb,omitempty" db:"disk_quota_gb"`       // 0 means no quota
+	Redundancy      int                 `json:"redundancy" db:"redundancy"`                       // How many nodes to run on
+	Consensus       int                 `json:"consensus" db:"consensus"`                         // How many must agree
+	ConsensusWeight float64             `json:"consensus_weight,omitempty" db:"consensus_weight"` // Weighted mode: vote weight needed instead of Consensus
+	TieBreakers     int                 `json:"tie_breakers,omitempty" db:"tie_breakers"`         // Executions added (and counted in Redundancy) to break a split
+	Adaptive        bool                `json:"adaptive,omitempty" db:"adaptive"`                 // Start with Consensus replicas on trusted nodes, escalate as needed
+	MaxRedundancy   int                 `json:"max_redundancy,omitempty" db:"max_redundancy"`     // Cap for tie-breakers and escalation; 0 uses the coordinator default
+	TimeoutSeconds  int                 `json:"timeout_seconds" db:"timeout_seconds"`             // Per-execution run time limit
+	Deadline        *time.Time          `json:"deadline,omitempty" db:"deadline"`                 // Job must be verified by then
+	OutputFile      string              `json:"output_file,omitempty" db:"output_file"`           // Result file in the container; stdout if empty
+	Normalize       []NormalizationRule `json:"normalize,omitempty" db:"normalize"`               // Applied to the output before hashing
+	Comparator      ComparatorSpec      `json:"comparator" db:"comparator"`                       // How results are judged equivalent
+	Spread          SpreadPolicy        `json:"spread" db:"spread"`                               // Anti-affinity for the job's replicas
+	Placement       PlacementStrategy   `json:"placement,omitempty" db:"placement"`               // Node ranking; empty uses the coordinator default
+	Priority        int                 `json:"priority" db:"priority"`                           // Order among the submitter's own pending jobs, higher first
+	NonPreemptible  bool                `json:"non_preemptible,omitempty" db:"non_preemptible"`   // Executions are never revoked for higher-priority jobs
+	NodeSelector    map[string]string   `json:"node_selector,omitempty" db:"node_selector"`       // Labels a node must have, exactly
+	Affinity        NodeAffinity        `json:"affinity" db:"affinity"`                           // Label expressions nodes must or should match
+	Tolerations     []Toleration        `json:"tolerations,omitempty" db:"tolerations"`           // Taints the job accepts
+	Status          JobStatus           `json:"status" db:"status"`
+	SubmittedBy     string              `json:"submitted_by" db:"submitted_by"`
+	SubmittedAt     time.Time           `json:"submitted_at" db:"submitted_at"`
+	StartedAt       *time.Time          `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt     *time.Time          `json:"completed_at,omitempty" db:"completed_at"`
+	Result          string              `json:"result,omitempty" db:"result"`
+	ErrorMessage    string              `json:"error_message,omitempty" db:"error_message"`
+	CreditsRequired int                 `json:"credits_required" db:"credits_required"`
+	Verification    *VerificationResult `json:"verification,omitempty" db:"verification"` // How consensus was decided
+
+	// CanaryID links a spot-check job to its known-answer catalog entry. It is
+	// never serialized, so a canary looks like any other job to workers.
+	CanaryID string `json:"-" db:"canary_id"`
+}
+
+// NormalizationRuleType names a transformation applied to job output before hashing
+type NormalizationRuleType string
+
+const (
+	NormalizeStripRegex     NormalizationRuleType = "strip_regex"     // Remove every match of Pattern
+	NormalizeIgnoreLines    NormalizationRuleType = "ignore_lines"    // Drop lines matching Pattern
+	NormalizeTrimWhitespace NormalizationRuleType = "trim_whitespace" // Trim each line and the whole output
+	NormalizeSortLines      NormalizationRuleType = "sort_lines"      // Sort lines lexically
+	NormalizeCanonicalJSON  NormalizationRuleType = "canonical_json"  // Re-encode JSON with sorted keys, no whitespace
+)
+
+// NormalizationRule is one step of a job's output normalization. Rules run in
+// order and only on the worker, before it hashes and reports the output; the
+// verifier compares what was reported.
+type NormalizationRule struct {
+	Type    NormalizationRuleType `json:"type"`
+	Pattern string                `json:"pattern,omitempty"` // Regular expression for strip_regex and ignore_lines
+}
+
+// ComparatorType selects how the verifier decides two results agree
+type ComparatorType string
+
+const (
+	ComparatorExact            ComparatorType = "exact"             // Identical result hashes (default)
+	ComparatorCanonicalJSON    ComparatorType = "canonical_json"    // Equal JSON values, ignoring key order and formatting
+	ComparatorNumericTolerance ComparatorType = "numeric_tolerance" // Numbers within AbsTolerance or RelTolerance
+	ComparatorSet              ComparatorType = "set"               // Same set of lines, in any order
+)
+
+// ComparatorSpec configures a job's result comparator
+type ComparatorSpec struct {
+	Type ComparatorType `json:"type,omitempty"`
+	// numeric_tolerance only: numbers agree if they differ by at most
+	// AbsTolerance, or by at most RelTolerance times the larger magnitude
+	AbsTolerance float64 `json:"abs_tolerance,omitempty"`
+	RelTolerance float64 `json:"rel_tolerance,omitempty"`
+	// numeric_tolerance only: "json" (default) or "csv"
+	Format string `json:"format,omitempty"`
+}
+
+// SpreadDomain is a node attribute that a job's replicas should not share
+type SpreadDomain string
+
+const (
+	SpreadOwner  SpreadDomain = "owner"  // The operator running the node
+	SpreadRegion SpreadDomain = "region" // The node's region
+	SpreadHost   SpreadDomain = "host"   // The physical machine behind the node
+)
+
+// SpreadMode decides what the scheduler does when not enough nodes satisfy a
+// job's spread
+type SpreadMode string
+
+const (
+	// SpreadRelax drops spread domains, last first, once RelaxAfterSeconds
+	// have passed since submission (default)
+	SpreadRelax SpreadMode = "relax"
+	// SpreadStrict waits until enough nodes satisfy every domain
+	SpreadStrict SpreadMode = "strict"
+)
+
+// SpreadPolicy places each of a job's replicas on nodes with a distinct value
+// for every domain in Domains, in order of priority. Nodes that didn't report
+// a value are treated as distinct from every other node.
+type SpreadPolicy struct {
+	Domains           []SpreadDomain `json:"domains"`
+	Mode              SpreadMode     `json:"mode,omitempty"`
+	RelaxAfterSeconds int            `json:"relax_after_seconds,omitempty"` // relax only
+}
+
+// DefaultSpreadDomains apply to jobs that don't ask for a spread
+var DefaultSpreadDomains = []SpreadDomain{SpreadOwner, SpreadRegion}
+
+// DefaultSpread is the spread policy of jobs that don't ask for one
+func DefaultSpread() SpreadPolicy {
+	return SpreadPolicy{Domains: DefaultSpreadDomains, Mode: SpreadRelax}
+}
+
+// PlacementStrategy names how the scheduler ranks candidate nodes for a job
+type PlacementStrategy string
+
+const (
+	PlacementReputation     PlacementStrategy = "reputation"      // Highest reputation first (default)
+	PlacementLeastLoaded    PlacementStrategy = "least_loaded"    // Most spare capacity first
+	PlacementBinPacking     PlacementStrategy = "bin_packing"     // Fullest node that still fits first
+	PlacementRandomWeighted PlacementStrategy = "random_weighted" // Random, weighted by reputation
+	PlacementCost           PlacementStrategy = "cost"            // Cheapest node first
+)
+
+// Job priorities range from MinJobPriority to MaxJobPriority, default 0.
+// Besides ordering a submitter's own jobs, priority decides which executions
+// may be preempted for which jobs.
+const (
+	MinJobPriority = -10
+	MaxJobPriority = 10
+)
+
+// MaxRedundancy caps how many nodes a single job may occupy, tie-breakers included
+const MaxRedundancy = 15
+
+// VerificationPolicy is a k-of-n setting: run on Redundancy nodes, Consensus must agree
+type VerificationPolicy struct {
+	Redundancy int `json:"redundancy"`
+	Consensus  int `json:"consensus"`
+}
+
+// TrustLevel is a named VerificationPolicy preset that can be requested on submission
+type TrustLevel string
+
+const (
+	TrustLevelMinimal  TrustLevel = "minimal"  // 1-of-1, cheap smoke tests
+	TrustLevelStandard TrustLevel = "standard" // 2-of-3, network default
+	TrustLevelHigh     TrustLevel = "high"     // 3-of-5
+	TrustLevelCritical TrustLevel = "critical" // 5-of-7, financial workloads
+)
+
+// TrustLevelPolicies maps each trust level to its verification policy
+var TrustLevelPolicies = map[TrustLevel]VerificationPolicy{
+	TrustLevelMinimal:  {Redundancy: 1, Consensus: 1},
+	TrustLevelStandard: {Redundancy: 3, Consensus: 2},
+	TrustLevelHigh:     {Redundancy: 5, Consensus: 3},
+	TrustLevelCritical: {Redundancy: 7, Consensus: 5},
+}
+
+// Canary is a known-answer workload from the spot-check catalog. The
+// coordinator runs copies of it on random nodes as ordinary looking jobs and
+// quarantines any node whose normalized result doesn't hash to ExpectedHash.
+type Canary struct {
+	ID             string              `json:"id" db:"id"`
+	Name           string              `json:"name" db:"name"` // Shown to workers, so it should look like a real job
+	Description    string              `json:"description" db:"description"`
+	DockerImage    string              `json:"docker_image" db:"docker_image"`
+	Command        []string            `json:"command" db:"command"`
+	Environment    map[string]string   `json:"environment" db:"environment"`
+	InputData      string              `json:"input_data" db:"input_data"`
+	RequiredCPU    int                 `json:"required_cpu" db:"required_cpu"`
+	RequiredMemory int                 `json:"required_memory" db:"required_memory"`
+	TimeoutSeconds int                 `json:"timeout_seconds" db:"timeout_seconds"`
+	OutputFile     string              `json:"output_file,omitempty" db:"output_file"`
+	Normalize      []NormalizationRule `json:"normalize,omitempty" db:"normalize"`
+	ExpectedHash   string              `json:"expected_hash" db:"expected_hash"` // SHA256 of the normalized correct output
+	Enabled        bool                `json:"enabled" db:"enabled"`
+	CreatedAt      time.Time           `json:"created_at" db:"created_at"`
 }
 
 // NodeStatus represents the current state of a worker node
 type NodeStatus string
 
 const (
-	NodeStatusOnline   NodeStatus = "online"
-	NodeStatusOffline  NodeStatus = "offline"
-	NodeStatusBusy     NodeStatus = "busy"
-	NodeStatusFaulty   NodeStatus = "faulty"
+	NodeStatusOnline  NodeStatus = "online"
+	NodeStatusOffline NodeStatus = "offline"
+	NodeStatusBusy    NodeStatus = "busy"
+	NodeStatusFaulty  NodeStatus = "faulty"
 )
 
 // Node represents a worker node in the network
 type Node struct {
-	ID               string     `json:"id" db:"id"`
-	Name             string     `json:"name" db:"name"`
-	Region           string     `json:"region" db:"region"`
-	CPUCores         int        `json:"cpu_cores" db:"cpu_cores"`
-	MemoryGB         int        `json:"memory_gb" db:"memory_gb"`
-	GPUEnabled       bool       `json:"gpu_enabled" db:"gpu_enabled"`
-	GPUModel         string     `json:"gpu_model,omitempty" db:"gpu_model"`
-	Status           NodeStatus `json:"status" db:"status"`
-	ReputationScore  float64    `json:"reputation_score" db:"reputation_score"`
-	TotalJobsRun     int        `json:"total_jobs_run" db:"total_jobs_run"`
-	SuccessfulJobs   int        `json:"successful_jobs_run" db:"successful_jobs_run"`
-	FailedJobs       int        `json:"failed_jobs" db:"failed_jobs"`
-	CreditsEarned    int        `json:"credits_earned" db:"credits_earned"`
-	LastHeartbeat    time.Time  `json:"last_heartbeat" db:"last_heartbeat"`
-	RegisteredAt     time.Time  `json:"registered_at" db:"registered_at"`
-	CurrentJobID     string     `json:"current_job_id,omitempty" db:"current_job_id"`
+	ID              string            `json:"id" db:"id"`
+	Name            string            `json:"name" db:"name"`
+	Region          string            `json:"region" db:"region"`
+	Owner           string            `json:"owner,omitempty" db:"owner"`   // Operator running the node
+	Host            string            `json:"host,omitempty" db:"host"`     // Physical machine, if reported
+	Price           float64           `json:"price" db:"price"`             // Credits per CPU-hour the operator asks
+	Labels          map[string]string `json:"labels,omitempty" db:"labels"` // e.g. arch, disk type, cached datasets
+	Taints          []Taint           `json:"taints,omitempty" db:"taints"` // Keep away jobs that don't tolerate them
+	CPUCores        int               `json:"cpu_cores" db:"cpu_cores"`
+	MemoryGB        int               `json:"memory_gb" db:"memory_gb"`
+	GPUEnabled      bool              `json:"gpu_enabled" db:"gpu_enabled"`
+	GPUModel        string            `json:"gpu_model,omitempty" db:"gpu_model"`
+	Status          NodeStatus        `json:"status" db:"status"`
+	ReputationScore float64           `json:"reputation_score" db:"reputation_score"`
+	TotalJobsRun    int               `json:"total_jobs_run" db:"total_jobs_run"`
+	SuccessfulJobs  int               `json:"successful_jobs_run" db:"successful_jobs_run"`
+	FailedJobs      int               `json:"failed_jobs" db:"failed_jobs"`
+	CreditsEarned   int               `json:"credits_earned" db:"credits_earned"`
+	LastHeartbeat   time.Time         `json:"last_heartbeat" db:"last_heartbeat"`
+	RegisteredAt    time.Time         `json:"registered_at" db:"registered_at"`
+	CurrentJobID    string            `json:"current_job_id,omitempty" db:"current_job_id"`
+	MaxSlots        int               `json:"max_slots" db:"max_slots"` // Concurrent executions the worker accepts
+
+	// Cordoned nodes get no new executions until uncordoned, and stay offline
+	// once drained. A draining node finishes its executions, then goes offline.
+	Cordoned bool `json:"cordoned,omitempty" db:"cordoned"`
+	Draining bool `json:"draining,omitempty" db:"draining"`
+	// During a maintenance window the node gets no work and missed heartbeats
+	// cost no reputation
+	MaintenanceStart *time.Time `json:"maintenance_start,omitempty" db:"maintenance_start"`
+	MaintenanceEnd   *time.Time `json:"maintenance_end,omitempty" db:"maintenance_end"`
+
+	// Current load, derived from outstanding executions
+	ActiveExecutions int `json:"active_executions"`
+	UsedCPU          int `json:"used_cpu"`
+	UsedMemory       int `json:"used_memory"`
+}
+
+// InMaintenance reports whether the node's maintenance window overlaps the
+// period from start to end
+func (n *Node) InMaintenance(start, end time.Time) bool {
+	if n.MaintenanceStart == nil || n.MaintenanceEnd == nil {
+		return false
+	}
+	return n.MaintenanceStart.Before(end) && n.MaintenanceEnd.After(start)
+}
+
+// TaintEffect says how strongly a taint repels jobs that don't tolerate it
+type TaintEffect string
+
+const (
+	TaintNoSchedule       TaintEffect = "no_schedule"        // Never placed there
+	TaintPreferNoSchedule TaintEffect = "prefer_no_schedule" // Placed there only when no other node will do
+)
+
+// Taint marks a node as reserved or undesirable, e.g. dedicated=ml or
+// flaky-network
+type Taint struct {
+	Key    string      `json:"key"`
+	Value  string      `json:"value,omitempty"`
+	Effect TaintEffect `json:"effect"`
+}
+
+// TolerationOperator says how a toleration matches a taint's value
+type TolerationOperator string
+
+const (
+	TolerationEqual  TolerationOperator = "equal"  // Same key and value (default)
+	TolerationExists TolerationOperator = "exists" // Same key, any value
+)
+
+// Toleration lets a job onto nodes with matching taints. An empty key with
+// exists tolerates every taint; an empty effect matches every effect.
+type Toleration struct {
+	Key      string             `json:"key"`
+	Operator TolerationOperator `json:"operator,omitempty"`
+	Value    string             `json:"value,omitempty"`
+	Effect   TaintEffect        `json:"effect,omitempty"`
+}
+
+// LabelOperator is the test a LabelExpression applies to a node label
+type LabelOperator string
+
+const (
+	LabelIn           LabelOperator = "in"             // Label set to one of Values
+	LabelNotIn        LabelOperator = "not_in"         // Label unset or not one of Values
+	LabelExists       LabelOperator = "exists"         // Label set
+	LabelDoesNotExist LabelOperator = "does_not_exist" // Label unset
+	LabelGt           LabelOperator = "gt"             // Label is a number above the single value
+	LabelLt           LabelOperator = "lt"             // Label is a number below the single value
+)
+
+// LabelExpression is a test on one node label
+type LabelExpression struct {
+	Key      string        `json:"key"`
+	Operator LabelOperator `json:"operator"`
+	Values   []string      `json:"values,omitempty"`
+}
+
+// PreferredExpression adds Weight to a node's preference when it matches
+type PreferredExpression struct {
+	Weight     int             `json:"weight"`
+	Expression LabelExpression `json:"expression"`
+}
+
+// NodeAffinity restricts and orders the nodes a job may run on. Every
+// Required expression must match; among those nodes, the ones matching the
+// most Preferred weight are used first.
+type NodeAffinity struct {
+	Required  []LabelExpression     `json:"required,omitempty"`
+	Preferred []PreferredExpression `json:"preferred,omitempty"`
+}
+
+// CollusionSignal names the kind of evidence behind a NodeFlag
+type CollusionSignal string
+
+const (
+	// SignalMinorityAgreement: the node keeps agreeing with another node on
+	// disputed jobs, often on the losing side
+	SignalMinorityAgreement CollusionSignal = "minority_agreement"
+	// SignalVotingBloc: three or more nodes pairwise agree that way
+	SignalVotingBloc CollusionSignal = "voting_bloc"
+	// SignalRegistrationPattern: the node registered together with others of
+	// the same region and capacity, as a sybil operator's fleet would
+	SignalRegistrationPattern CollusionSignal = "registration_pattern"
+)
+
+// NodeFlag records why collusion detection suspects a node. Quarantined flags
+// also made the node faulty. Reinstating the node clears its flags.
+type NodeFlag struct {
+	ID           string          `json:"id" db:"id"`
+	NodeID       string          `json:"node_id" db:"node_id"`
+	Signal       CollusionSignal `json:"signal" db:"signal"`
+	Explanation  string          `json:"explanation" db:"explanation"`
+	RelatedNodes []string        `json:"related_nodes" db:"related_nodes"`
+	Quarantined  bool            `json:"quarantined" db:"quarantined"`
+	FlaggedAt    time.Time       `json:"flagged_at" db:"flagged_at"`
+	ClearedAt    *time.Time      `json:"cleared_at,omitempty" db:"cleared_at"`
+}
+
+// TenantShare is a submitter's standing under fair-share scheduling. Share
+// and TargetShare are fractions of the node time used by active submitters.
+type TenantShare struct {
+	SubmittedBy  string  `json:"submitted_by"`
+	Weight       float64 `json:"weight"`
+	UsageSeconds float64 `json:"usage_node_seconds"` // Node time consumed within the fair-share window
+	Share        float64 `json:"share"`              // Fraction of that node time that was theirs
+	TargetShare  float64 `json:"target_share"`       // Fraction their weight entitles them to
+	PendingJobs  int     `json:"pending_jobs"`
+	NextPosition int     `json:"next_position,omitempty"` // Queue position of their next job, from 1
+}
+
+// QueuedJob is a pending job's place in the fair-share order
+type QueuedJob struct {
+	Position    int       `json:"position"`
+	JobID       string    `json:"job_id"`
+	Name        string    `json:"name"`
+	SubmittedBy string    `json:"submitted_by"`
+	Priority    int       `json:"priority"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// FairShareQueue is the order the scheduler will offer pending jobs to nodes
+type FairShareQueue struct {
+	WindowSeconds int            `json:"window_seconds"`
+	Tenants       []*TenantShare `json:"tenants"`
+	Jobs          []*QueuedJob   `json:"jobs"`
 }
 
 // JobExecution represents an instance of a job running on a specific node
 type JobExecution struct {
-	ID            string         `json:"id" db:"id"`
-	JobID         string         `json:"job_id" db:"job_id"`
-	NodeID        string         `json:"node_id" db:"node_id"`
-	Status        JobStatus      `json:"status" db:"status"`
-	StartedAt     time.Time      `json:"started_at" db:"started_at"`
-	CompletedAt   *time.Time     `json:"completed_at,omitempty" db:"completed_at"`
-	Result        string         `json:"result,omitempty" db:"result"`
-	ResultHash    string         `json:"result_hash,omitempty" db:"result_hash"`
-	ErrorMessage  string         `json:"error_message,omitempty" db:"error_message"`
-	Logs          string         `json:"logs,omitempty" db:"logs"`
+	ID           string     `json:"id" db:"id"`
+	JobID        string     `json:"job_id" db:"job_id"`
+	NodeID       string     `json:"node_id" db:"node_id"`
+	Status       JobStatus  `json:"status" db:"status"`
+	StartedAt    time.Time  `json:"started_at" db:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	Result       string     `json:"result,omitempty" db:"result"`
+	ResultHash   string     `json:"result_hash,omitempty" db:"result_hash"`
+	ErrorMessage string     `json:"error_message,omitempty" db:"error_message"`
+	Stdout       string     `json:"stdout,omitempty" db:"stdout"`
+	Stderr       string     `json:"stderr,omitempty" db:"stderr"`
+	ErrorClass   ErrorClass `json:"error_class,omitempty" db:"error_class"`
+	// ClaimedAt is set when the node claims the execution; LeaseExpiresAt is the
+	// claim deadline while scheduled and the lease expiry while running
+	ClaimedAt      *time.Time `json:"claimed_at,omitempty" db:"claimed_at"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty" db:"lease_expires_at"`
+	// RunStartedAt is set when the node reports the container started, once
+	// it has pulled the image
+	RunStartedAt *time.Time `json:"run_started_at,omitempty" db:"run_started_at"`
+}
+
+// PendingExecution is an execution scheduled on a node and waiting for the
+// node to claim it, together with its job
+type PendingExecution struct {
+	Execution *JobExecution
+	Job       *Job
+}
+
+// ErrorClass categorizes why an execution failed
+type ErrorClass string
+
+const (
+	// ErrorClassNodeLost marks executions orphaned by a node going offline.
+	// They are replaced on another node and don't count against the job.
+	ErrorClassNodeLost ErrorClass = "node_lost"
+	// ErrorClassOOMKilled marks executions killed for exceeding the job's memory limit
+	ErrorClassOOMKilled ErrorClass = "oom_killed"
+	// ErrorClassTimedOut marks executions that ran past the job's timeout
+	ErrorClassTimedOut ErrorClass = "timed_out"
+	// ErrorClassPreempted marks executions revoked to make room for a
+	// higher-priority job. Like lost ones, they are replaced and not held
+	// against the job or the node.
+	ErrorClassPreempted ErrorClass = "preempted"
+	// ErrorClassInternal marks executions a worker lost track of through a
+	// fault of its own or of its container runtime, rather than the job's
+	ErrorClassInternal ErrorClass = "internal_error"
+)
+
+// IsLost reports whether an execution of this class was taken from its node
+// through no fault of the node, so it is replaced rather than counted as a
+// failure
+func (c ErrorClass) IsLost() bool {
+	return c == ErrorClassNodeLost || c == ErrorClassPreempted
 }
 
 // VerificationResult represents the outcome of k-of-n verification
 type VerificationResult struct {
-	JobID           string            `json:"job_id"`
-	TotalExecutions int               `json:"total_executions"`
-	ResultCounts    map[string]int    `json:"result_counts"`
-	ConsensusResult string            `json:"consensus_result"`
-	ConsensusReached bool             `json:"consensus_reached"`
-	AgreementNodes  []string          `json:"agreement_nodes"`
-	DisagreementNodes []string        `json:"disagreement_nodes"`
+	JobID             string         `json:"job_id"`
+	TotalExecutions   int            `json:"total_executions"`
+	ResultCounts      map[string]int `json:"result_counts"`
+	ConsensusResult   string         `json:"consensus_result"`
+	ConsensusReached  bool           `json:"consensus_reached"`
+	AgreementNodes    []string       `json:"agreement_nodes"`
+	DisagreementNodes []string       `json:"disagreement_nodes"`
+
+	// Weighted consensus only: each node's vote weight, the total weight behind
+	// each result, and the winning weight against the job's threshold
+	NodeWeights     map[string]float64 `json:"node_weights,omitempty"`
+	ResultWeights   map[string]float64 `json:"result_weights,omitempty"`
+	ConsensusWeight float64            `json:"consensus_weight,omitempty"`
+	RequiredWeight  float64            `json:"required_weight,omitempty"`
+}
+
+// JobOutcome is how an active job ends once its results have been judged:
+// its final status and result, and what each node that ran it earns
+type JobOutcome struct {
+	Status       JobStatus
+	Result       string
+	ErrorMessage string
+	Verification *VerificationResult // Nil unless the results were verified
+	Rewards      []NodeReward
+}
+
+// NodeReward is a node's reputation change and job stats for one execution
+type NodeReward struct {
+	NodeID     string
+	Reputation float64 // Added to the node's score, which stays at or above zero
+	Success    bool
+	Credits    int
 }
 
 // Heartbeat represents a health check from a worker node
 type Heartbeat struct {
-	NodeID        string    `json:"node_id"`
-	Timestamp     time.Time `json:"timestamp"`
-	CPUUsage      float64   `json:"cpu_usage"`
-	MemoryUsage   float64   `json:"memory_usage"`
-	ActiveJobs    int       `json:"active_jobs"`
+	NodeID      string    `json:"node_id"`
+	Timestamp   time.Time `json:"timestamp"`
+	CPUUsage    float64   `json:"cpu_usage"`
+	MemoryUsage float64   `json:"memory_usage"`
+	ActiveJobs  int       `json:"active_jobs"` // Slots in use
+	TotalSlots  int       `json:"total_slots"`
+	UsedCPU     int       `json:"used_cpu"`
+	UsedMemory  int       `json:"used_memory"`
+	// ActiveExecutions lists the executions the worker is currently running, so
+	// the coordinator can tell it which ones to stop
+	ActiveExecutions []string `json:"active_executions"`
 }
 
 // JobSubmitRequest represents the API request to submit a new job
 type JobSubmitRequest struct {
-	Name            string            `json:"name" binding:"required"`
-	Description     string            `json:"description"`
-	DockerImage     string            `json:"docker_image" binding:"required"`
-	Command         []string          `json:"command" binding:"required"`
-	Environment     map[string]string `json:"environment"`
-	InputData       string            `json:"input_data"`
-	RequiredCPU     int               `json:"required_cpu"`
-	RequiredMemory  int               `json:"required_memory"`
-	RequiredGPU     bool              `json:"required_gpu"`
+	Name            string              `json:"name" binding:"required"`
+	Description     string              `json:"description"`
+	DockerImage     string              `json:"docker_image" binding:"required"`
+	Command         []string            `json:"command" binding:"required"`
+	Environment     map[string]string   `json:"environment"`
+	InputData       string              `json:"input_data"`
+	RequiredCPU     int                 `json:"required_cpu"`
+	RequiredMemory  int                 `json:"required_memory"`
+	RequiredGPU     bool                `json:"required_gpu"`
+	DiskQuotaGB     int                 `json:"disk_quota_gb"`
+	TimeoutSeconds  int                 `json:"timeout_seconds"`  // Optional, defaults to 5 minutes
+	Deadline        *time.Time          `json:"deadline"`         // Optional, RFC 3339
+	OutputFile      string              `json:"output_file"`      // Optional absolute path of the result file
+	Normalize       []NormalizationRule `json:"normalize"`        // Optional output normalization
+	Comparator      ComparatorSpec      `json:"comparator"`       // Optional, defaults to exact hash match
+	Spread          *SpreadPolicy       `json:"spread"`           // Optional, defaults to owner and region, relaxed as needed
+	Placement       PlacementStrategy   `json:"placement"`        // Optional, defaults to the coordinator's strategy
+	Priority        int                 `json:"priority"`         // Optional, -10 to 10, orders the submitter's own jobs
+	SubmittedBy     string              `json:"submitted_by"`     // Optional fair-share tenant, defaults to "user"
+	NonPreemptible  bool                `json:"non_preemptible"`  // Optional, protects executions from preemption
+	NodeSelector    map[string]string   `json:"node_selector"`    // Optional labels nodes must have
+	Affinity        NodeAffinity        `json:"affinity"`         // Optional label expressions
+	Tolerations     []Toleration        `json:"tolerations"`      // Optional, lets the job onto tainted nodes
+	Redundancy      int                 `json:"redundancy"`       // Optional, overrides trust level
+	Consensus       int                 `json:"consensus"`        // Optional, overrides trust level
+	ConsensusWeight float64             `json:"consensus_weight"` // Optional, enables reputation-weighted voting
+	Adaptive        bool                `json:"adaptive"`         // Optional adaptive redundancy
+	MaxRedundancy   int                 `json:"max_redundancy"`   // Optional, defaults to redundancy for adaptive jobs
+	TrustLevel      TrustLevel          `json:"trust_level"`      // Optional preset
+}
+
+// CanaryRequest adds a known-answer workload to the spot-check catalog. Give
+// either the expected output, which is normalized and hashed like a worker
+// would, or its hash.
+type CanaryRequest struct {
+	Name           string              `json:"name" binding:"required"`
+	Description    string              `json:"description"`
+	DockerImage    string              `json:"docker_image" binding:"required"`
+	Command        []string            `json:"command" binding:"required"`
+	Environment    map[string]string   `json:"environment"`
+	InputData      string              `json:"input_data"`
+	RequiredCPU    int                 `json:"required_cpu"`
+	RequiredMemory int                 `json:"required_memory"`
+	TimeoutSeconds int                 `json:"timeout_seconds"`
+	OutputFile     string              `json:"output_file"`
+	Normalize      []NormalizationRule `json:"normalize"`
+	ExpectedOutput *string             `json:"expected_output"`
+	ExpectedHash   string              `json:"expected_hash"`
+}
+
+// ExecutionLeaseRequest is sent by a worker to claim or renew an execution lease
+type ExecutionLeaseRequest struct {
+	NodeID string `json:"node_id" binding:"required"`
+}
+
+// ShareWeightRequest sets a submitter's fair-share weight
+type ShareWeightRequest struct {
+	Weight float64 `json:"weight" binding:"required"`
 }
 
 // NodeRegisterRequest represents the API request for a node to register
 type NodeRegisterRequest struct {
-	ID         string `json:"id" binding:"required"`
-	Name       string `json:"name" binding:"required"`
-	Region     string `json:"region"`
-	CPUCores   int    `json:"cpu_cores" binding:"required"`
-	MemoryGB   int    `json:"memory_gb" binding:"required"`
-	GPUEnabled bool   `json:"gpu_enabled"`
-	GPUModel   string `json:"gpu_model"`
+	ID         string            `json:"id" binding:"required"`
+	Name       string            `json:"name" binding:"required"`
+	Region     string            `json:"region"`
+	Owner      string            `json:"owner"`
+	Host       string            `json:"host"`
+	Price      float64           `json:"price"` // Credits per CPU-hour; defaults to 1
+	Labels     map[string]string `json:"labels"`
+	Taints     []Taint           `json:"taints"`
+	CPUCores   int               `json:"cpu_cores" binding:"required"`
+	MemoryGB   int               `json:"memory_gb" binding:"required"`
+	GPUEnabled bool              `json:"gpu_enabled"`
+	GPUModel   string            `json:"gpu_model"`
+	MaxSlots   int               `json:"max_slots"` // Defaults to 1 (one execution at a time)
+}
+
+// MaintenanceRequest schedules a node's maintenance window. Start defaults
+// to now.
+type MaintenanceRequest struct {
+	Start *time.Time `json:"start"`
+	End   time.Time  `json:"end" binding:"required"`
 }
 
 // JobResultSubmission represents a worker submitting a job result
 type JobResultSubmission struct {
-	ExecutionID  string `json:"execution_id" binding:"required"`
-	JobID        string `json:"job_id" binding:"required"`
-	NodeID       string `json:"node_id" binding:"required"`
-	Result       string `json:"result"`
-	ResultHash   string `json:"result_hash"`
-	ErrorMessage string `json:"error_message"`
-	Logs         string `json:"logs"`
+	ExecutionID  string     `json:"execution_id" binding:"required"`
+	JobID        string     `json:"job_id" binding:"required"`
+	NodeID       string     `json:"node_id" binding:"required"`
+	Result       string     `json:"result"`
+	ResultHash   string     `json:"result_hash"`
+	ErrorMessage string     `json:"error_message"`
+	ErrorClass   ErrorClass `json:"error_class"`
+	Stdout       string     `json:"stdout"`
+	Stderr       string     `json:"stderr"`
 }
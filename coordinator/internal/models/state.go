@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition is wrapped by the error returned for a status change
+// the state machine doesn't allow, e.g. completing a cancelled job
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// jobTransitions lists the statuses a job may move to from each status.
+// Finished jobs never change again.
+var jobTransitions = map[JobStatus][]JobStatus{
+	JobStatusPending:   {JobStatusScheduled, JobStatusFailed, JobStatusCancelled, JobStatusTimedOut},
+	JobStatusScheduled: {JobStatusRunning, JobStatusFailed, JobStatusCancelled, JobStatusTimedOut},
+	JobStatusRunning:   {JobStatusVerifying, JobStatusCompleted, JobStatusFailed, JobStatusCancelled, JobStatusTimedOut},
+	JobStatusVerifying: {JobStatusCompleted, JobStatusFailed, JobStatusCancelled, JobStatusTimedOut},
+}
+
+// executionTransitions lists the statuses an execution may move to from each
+// status. Executions start scheduled; an expired one is scheduled afresh,
+// possibly on another node. Completed, failed and cancelled are final.
+var executionTransitions = map[JobStatus][]JobStatus{
+	JobStatusScheduled: {JobStatusScheduled, JobStatusRunning, JobStatusFailed, JobStatusCancelled},
+	JobStatusRunning:   {JobStatusScheduled, JobStatusCompleted, JobStatusFailed, JobStatusCancelled},
+}
+
+// allStatuses fixes the order statuses are listed in
+var allStatuses = []JobStatus{
+	JobStatusPending, JobStatusScheduled, JobStatusRunning, JobStatusVerifying,
+	JobStatusCompleted, JobStatusFailed, JobStatusCancelled, JobStatusTimedOut,
+}
+
+// CheckJobTransition returns an error wrapping ErrInvalidTransition unless a
+// job may move from one status to the other
+func CheckJobTransition(from, to JobStatus) error {
+	return checkTransition("job", jobTransitions, from, to)
+}
+
+// CheckExecutionTransition returns an error wrapping ErrInvalidTransition
+// unless an execution may move from one status to the other
+func CheckExecutionTransition(from, to JobStatus) error {
+	return checkTransition("execution", executionTransitions, from, to)
+}
+
+// JobStatusesBefore returns the statuses a job may move to the given status from
+func JobStatusesBefore(to JobStatus) []JobStatus {
+	return statusesBefore(jobTransitions, to)
+}
+
+// ExecutionStatusesBefore returns the statuses an execution may move to the
+// given status from
+func ExecutionStatusesBefore(to JobStatus) []JobStatus {
+	return statusesBefore(executionTransitions, to)
+}
+
+func checkTransition(kind string, transitions map[JobStatus][]JobStatus, from, to JobStatus) error {
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s %s -> %s", ErrInvalidTransition, kind, from, to)
+}
+
+func statusesBefore(transitions map[JobStatus][]JobStatus, to JobStatus) []JobStatus {
+	var from []JobStatus
+	for _, status := range allStatuses {
+		if checkTransition("", transitions, status, to) == nil {
+			from = append(from, status)
+		}
+	}
+	return from
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckJobTransition(t *testing.T) {
+	tests := []struct {
+		from, to JobStatus
+		ok       bool
+	}{
+		{JobStatusPending, JobStatusScheduled, true},
+		{JobStatusScheduled, JobStatusRunning, true},
+		{JobStatusRunning, JobStatusVerifying, true},
+		{JobStatusRunning, JobStatusCompleted, true},
+		{JobStatusVerifying, JobStatusCompleted, true},
+		{JobStatusPending, JobStatusFailed, true},
+		{JobStatusScheduled, JobStatusCancelled, true},
+		{JobStatusRunning, JobStatusTimedOut, true},
+		{JobStatusVerifying, JobStatusFailed, true},
+
+		// No skipping ahead or going back
+		{JobStatusPending, JobStatusRunning, false},
+		{JobStatusPending, JobStatusCompleted, false},
+		{JobStatusRunning, JobStatusScheduled, false},
+		{JobStatusScheduled, JobStatusScheduled, false},
+
+		// Finished jobs never change again
+		{JobStatusCompleted, JobStatusFailed, false},
+		{JobStatusFailed, JobStatusCompleted, false},
+		{JobStatusCancelled, JobStatusCompleted, false},
+		{JobStatusCancelled, JobStatusRunning, false},
+		{JobStatusTimedOut, JobStatusCancelled, false},
+	}
+
+	for _, tt := range tests {
+		err := CheckJobTransition(tt.from, tt.to)
+		if tt.ok && err != nil {
+			t.Errorf("job %s -> %s: unexpected error %v", tt.from, tt.to, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("job %s -> %s: got %v, want ErrInvalidTransition", tt.from, tt.to, err)
+		}
+	}
+}
+
+func TestCheckExecutionTransition(t *testing.T) {
+	tests := []struct {
+		from, to JobStatus
+		ok       bool
+	}{
+		{JobStatusScheduled, JobStatusRunning, true},
+		{JobStatusScheduled, JobStatusScheduled, true}, // Reassigned before it was claimed
+		{JobStatusRunning, JobStatusScheduled, true},   // Lease expired
+		{JobStatusRunning, JobStatusCompleted, true},
+		{JobStatusRunning, JobStatusFailed, true},
+		{JobStatusScheduled, JobStatusFailed, true},
+		{JobStatusScheduled, JobStatusCancelled, true},
+
+		{JobStatusScheduled, JobStatusCompleted, false},
+		{JobStatusRunning, JobStatusVerifying, false},
+		{JobStatusPending, JobStatusScheduled, false},
+		{JobStatusCompleted, JobStatusRunning, false},
+		{JobStatusFailed, JobStatusScheduled, false},
+		{JobStatusCancelled, JobStatusCompleted, false},
+	}
+
+	for _, tt := range tests {
+		err := CheckExecutionTransition(tt.from, tt.to)
+		if tt.ok && err != nil {
+			t.Errorf("execution %s -> %s: unexpected error %v", tt.from, tt.to, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("execution %s -> %s: got %v, want ErrInvalidTransition", tt.from, tt.to, err)
+		}
+	}
+}
+
+func TestStatusesBefore(t *testing.T) {
+	tests := []struct {
+		got, want []JobStatus
+	}{
+		{JobStatusesBefore(JobStatusRunning), []JobStatus{JobStatusScheduled}},
+		{JobStatusesBefore(JobStatusCompleted), []JobStatus{JobStatusRunning, JobStatusVerifying}},
+		{JobStatusesBefore(JobStatusPending), nil},
+		{ExecutionStatusesBefore(JobStatusCompleted), []JobStatus{JobStatusRunning}},
+		{ExecutionStatusesBefore(JobStatusCancelled), []JobStatus{JobStatusScheduled, JobStatusRunning}},
+	}
+
+	for i, tt := range tests {
+		if len(tt.got) != len(tt.want) {
+			t.Errorf("case %d: got %v, want %v", i, tt.got, tt.want)
+			continue
+		}
+		for j := range tt.got {
+			if tt.got[j] != tt.want[j] {
+				t.Errorf("case %d: got %v, want %v", i, tt.got, tt.want)
+				break
+			}
+		}
+	}
+}
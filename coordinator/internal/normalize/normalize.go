@@ -0,0 +1,140 @@
+package normalize
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+// Validate checks that every rule is known and its pattern compiles
+func Validate(rules []models.NormalizationRule) error {
+	for i, rule := range rules {
+		switch rule.Type {
+		case models.NormalizeStripRegex, models.NormalizeIgnoreLines:
+			if rule.Pattern == "" {
+				return fmt.Errorf("normalize rule %d (%s) needs a pattern", i, rule.Type)
+			}
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("normalize rule %d (%s): %w", i, rule.Type, err)
+			}
+		case models.NormalizeTrimWhitespace, models.NormalizeSortLines, models.NormalizeCanonicalJSON:
+		default:
+			return fmt.Errorf("normalize rule %d: unknown type %q", i, rule.Type)
+		}
+	}
+	return nil
+}
+
+// Apply runs the rules over output in order. The verifier doesn't use it;
+// it normalizes spot-check expected outputs, which only match honest nodes'
+// answers if the worker's copy gives the same output.
+func Apply(output string, rules []models.NormalizationRule) (string, error) {
+	for _, rule := range rules {
+		var err error
+		switch rule.Type {
+		case models.NormalizeStripRegex:
+			var re *regexp.Regexp
+			if re, err = regexp.Compile(rule.Pattern); err == nil {
+				output = re.ReplaceAllString(output, "")
+			}
+		case models.NormalizeIgnoreLines:
+			var re *regexp.Regexp
+			if re, err = regexp.Compile(rule.Pattern); err == nil {
+				output = ignoreLines(output, re)
+			}
+		case models.NormalizeTrimWhitespace:
+			output = trimWhitespace(output)
+		case models.NormalizeSortLines:
+			output = sortLines(output)
+		case models.NormalizeCanonicalJSON:
+			output, err = canonicalJSON(output)
+		default:
+			err = fmt.Errorf("unknown type %q", rule.Type)
+		}
+		if err != nil {
+			return "", fmt.Errorf("normalize %s: %w", rule.Type, err)
+		}
+	}
+	return output, nil
+}
+
+// Hash returns the hex SHA256 of a (normalized) result
+func Hash(result string) string {
+	sum := sha256.Sum256([]byte(result))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitLines splits output into lines, ignoring a single trailing newline
+func splitLines(output string) []string {
+	if output == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func ignoreLines(output string, re *regexp.Regexp) string {
+	var kept []string
+	for _, line := range splitLines(output) {
+		if !re.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	return joinLines(kept)
+}
+
+func trimWhitespace(output string) string {
+	lines := splitLines(output)
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func sortLines(output string) string {
+	lines := splitLines(output)
+	sort.Strings(lines)
+	return joinLines(lines)
+}
+
+// canonicalJSON re-encodes each JSON value in output (a single document or
+// JSON lines) with sorted object keys and no insignificant whitespace
+func canonicalJSON(output string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(output))
+	decoder.UseNumber()
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		// Encode writes one value per line
+		if err := encoder.Encode(value); err != nil {
+			return "", err
+		}
+	}
+
+	return buf.String(), nil
+}
@@ -3,16 +3,92 @@ package repository
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
 	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	_ "github.com/lib/pq"
 )
 
+// Database is the SQL Store, on Postgres or, through NewSQLite, on an
+// embedded SQLite file
 type Database struct {
-	db *sql.DB
+	db      conn
+	dialect dialect
+}
+
+// querier runs queries, on the database or inside a transaction
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// conn is the part of *sql.DB the queries use
+type conn interface {
+	querier
+	Begin() (transaction, error)
+	Close() error
+}
+
+// transaction is the part of *sql.Tx the queries use
+type transaction interface {
+	querier
+	Commit() error
+	Rollback() error
+}
+
+// postgresConn hands out transactions as the transaction interface
+type postgresConn struct {
+	*sql.DB
+}
+
+func (c postgresConn) Begin() (transaction, error) {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// transact runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise
+func (d *Database) transact(fn func(q querier) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// dialect covers the SQL that differs between the engines Database runs on
+type dialect struct {
+	// name is also the directory holding the dialect's migrations
+	name string
+	// epoch converts a timestamp expression to seconds since 1970
+	epoch func(expr string) string
+	// greatest is the function returning the largest of its arguments
+	greatest string
+	// lockRows ends a SELECT to lock the rows it returns until the transaction
+	// ends, skipping rows another transaction has locked
+	lockRows string
+}
+
+var postgresDialect = dialect{
+	name:     "postgres",
+	epoch:    func(expr string) string { return "EXTRACT(EPOCH FROM " + expr + ")" },
+	greatest: "GREATEST",
+	lockRows: " FOR UPDATE SKIP LOCKED",
 }
 
+// NewDatabase connects to Postgres. MigrateUp brings the schema up to date.
 func NewDatabase(connectionString string) (*Database, error) {
 	db, err := sql.Open("postgres", connectionString)
 	if err != nil {
@@ -23,298 +99,683 @@ func NewDatabase(connectionString string) (*Database, error) {
 		return nil, err
 	}
 
-	database := &Database{db: db}
-
-	// Initialize schema
-	if err := database.initSchema(); err != nil {
-		return nil, err
-	}
-
-	return database, nil
-}
-
-func (d *Database) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS jobs (
-		id VARCHAR(36) PRIMARY KEY,
-		name VARCHAR(255) NOT NULL,
-		description TEXT,
-		docker_image VARCHAR(255) NOT NULL,
-		command JSONB NOT NULL,
-		environment JSONB,
-		input_data TEXT,
-		required_cpu INTEGER DEFAULT 1,
-		required_memory INTEGER DEFAULT 1,
-		required_gpu BOOLEAN DEFAULT FALSE,
-		redundancy INTEGER DEFAULT 3,
-		consensus INTEGER DEFAULT 2,
-		status VARCHAR(50) NOT NULL,
-		submitted_by VARCHAR(255),
-		submitted_at TIMESTAMP NOT NULL,
-		started_at TIMESTAMP,
-		completed_at TIMESTAMP,
-		result TEXT,
-		error_message TEXT,
-		credits_required INTEGER DEFAULT 1
-	);
-
-	CREATE TABLE IF NOT EXISTS nodes (
-		id VARCHAR(36) PRIMARY KEY,
-		name VARCHAR(255) NOT NULL,
-		region VARCHAR(100),
-		cpu_cores INTEGER NOT NULL,
-		memory_gb INTEGER NOT NULL,
-		gpu_enabled BOOLEAN DEFAULT FALSE,
-		gpu_model VARCHAR(255),
-		status VARCHAR(50) NOT NULL,
-		reputation_score REAL DEFAULT 100.0,
-		total_jobs_run INTEGER DEFAULT 0,
-		successful_jobs_run INTEGER DEFAULT 0,
-		failed_jobs INTEGER DEFAULT 0,
-		credits_earned INTEGER DEFAULT 0,
-		last_heartbeat TIMESTAMP NOT NULL,
-		registered_at TIMESTAMP NOT NULL,
-		current_job_id VARCHAR(36)
-	);
-
-	CREATE TABLE IF NOT EXISTS job_executions (
-		id VARCHAR(36) PRIMARY KEY,
-		job_id VARCHAR(36) NOT NULL REFERENCES jobs(id),
-		node_id VARCHAR(36) NOT NULL REFERENCES nodes(id),
-		status VARCHAR(50) NOT NULL,
-		started_at TIMESTAMP NOT NULL,
-		completed_at TIMESTAMP,
-		result TEXT,
-		result_hash VARCHAR(64),
-		error_message TEXT,
-		logs TEXT
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
-	CREATE INDEX IF NOT EXISTS idx_nodes_status ON nodes(status);
-	CREATE INDEX IF NOT EXISTS idx_executions_job_id ON job_executions(job_id);
-	CREATE INDEX IF NOT EXISTS idx_executions_node_id ON job_executions(node_id);
-	`
-
-	_, err := d.db.Exec(schema)
-	return err
+	return &Database{db: postgresConn{db}, dialect: postgresDialect}, nil
+}
+
+// jobColumns lists job columns in the order scanJob expects them
+const jobColumns = `
+	id, name, COALESCE(description, ''), docker_image, command, environment, COALESCE(input_data, ''),
+	required_cpu, required_memory, required_gpu, COALESCE(disk_quota_gb, 0), redundancy, consensus,
+	COALESCE(timeout_seconds, 0), deadline, COALESCE(output_file, ''), normalize, comparator, spread,
+	COALESCE(placement, ''), COALESCE(priority, 0), COALESCE(non_preemptible, FALSE),
+	node_selector, affinity, tolerations,
+	COALESCE(consensus_weight, 0), COALESCE(tie_breakers, 0),
+	COALESCE(adaptive, FALSE), COALESCE(max_redundancy, 0), verification, status,
+	COALESCE(submitted_by, ''), submitted_at, started_at, completed_at,
+	COALESCE(result, ''), COALESCE(error_message, ''), credits_required, COALESCE(canary_id, '')`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// withColumns scans the columns selected after a record's own into extra
+type withColumns struct {
+	rowScanner
+	extra []interface{}
+}
+
+func (w withColumns) Scan(dest ...interface{}) error {
+	return w.rowScanner.Scan(append(dest, w.extra...)...)
+}
+
+func scanJob(row rowScanner) (*models.Job, error) {
+	var job models.Job
+	var commandJSON, envJSON, normalizeJSON, comparatorJSON, spreadJSON, verificationJSON []byte
+	var selectorJSON, affinityJSON, tolerationsJSON []byte
+
+	err := row.Scan(
+		&job.ID, &job.Name, &job.Description, &job.DockerImage, &commandJSON, &envJSON,
+		&job.InputData, &job.RequiredCPU, &job.RequiredMemory, &job.RequiredGPU, &job.DiskQuotaGB,
+		&job.Redundancy, &job.Consensus, &job.TimeoutSeconds, &job.Deadline,
+		&job.OutputFile, &normalizeJSON, &comparatorJSON, &spreadJSON, &job.Placement, &job.Priority, &job.NonPreemptible,
+		&selectorJSON, &affinityJSON, &tolerationsJSON, &job.ConsensusWeight, &job.TieBreakers,
+		&job.Adaptive, &job.MaxRedundancy, &verificationJSON, &job.Status, &job.SubmittedBy, &job.SubmittedAt,
+		&job.StartedAt, &job.CompletedAt, &job.Result, &job.ErrorMessage, &job.CreditsRequired,
+		&job.CanaryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal(commandJSON, &job.Command)
+	json.Unmarshal(envJSON, &job.Environment)
+	if normalizeJSON != nil {
+		json.Unmarshal(normalizeJSON, &job.Normalize)
+	}
+	if comparatorJSON != nil {
+		json.Unmarshal(comparatorJSON, &job.Comparator)
+	}
+	if spreadJSON != nil {
+		json.Unmarshal(spreadJSON, &job.Spread)
+	}
+	if selectorJSON != nil {
+		json.Unmarshal(selectorJSON, &job.NodeSelector)
+	}
+	if affinityJSON != nil {
+		json.Unmarshal(affinityJSON, &job.Affinity)
+	}
+	if tolerationsJSON != nil {
+		json.Unmarshal(tolerationsJSON, &job.Tolerations)
+	}
+	if verificationJSON != nil {
+		json.Unmarshal(verificationJSON, &job.Verification)
+	}
+
+	return &job, nil
+}
+
+func (d *Database) queryJobs(query string, args ...interface{}) ([]*models.Job, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
 }
 
 // Job operations
 func (d *Database) CreateJob(job *models.Job) error {
 	commandJSON, _ := json.Marshal(job.Command)
 	envJSON, _ := json.Marshal(job.Environment)
+	normalizeJSON, _ := json.Marshal(job.Normalize)
+	comparatorJSON, _ := json.Marshal(job.Comparator)
+	spreadJSON, _ := json.Marshal(job.Spread)
+	selectorJSON, _ := json.Marshal(job.NodeSelector)
+	affinityJSON, _ := json.Marshal(job.Affinity)
+	tolerationsJSON, _ := json.Marshal(job.Tolerations)
 
 	_, err := d.db.Exec(`
 		INSERT INTO jobs (id, name, description, docker_image, command, environment,
-			input_data, required_cpu, required_memory, required_gpu, redundancy, consensus,
-			status, submitted_by, submitted_at, credits_required)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+			input_data, required_cpu, required_memory, required_gpu, disk_quota_gb, redundancy,
+			consensus, timeout_seconds, deadline, output_file, normalize, comparator, spread, placement,
+			priority, non_preemptible, node_selector, affinity, tolerations, consensus_weight, adaptive,
+			max_redundancy, status, submitted_by, submitted_at, credits_required, canary_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+			$21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, NULLIF($33, ''))`,
 		job.ID, job.Name, job.Description, job.DockerImage, commandJSON, envJSON,
-		job.InputData, job.RequiredCPU, job.RequiredMemory, job.RequiredGPU,
-		job.Redundancy, job.Consensus, job.Status, job.SubmittedBy,
-		job.SubmittedAt, job.CreditsRequired,
+		job.InputData, job.RequiredCPU, job.RequiredMemory, job.RequiredGPU, job.DiskQuotaGB,
+		job.Redundancy, job.Consensus, job.TimeoutSeconds, job.Deadline, job.OutputFile,
+		normalizeJSON, comparatorJSON, spreadJSON, job.Placement, job.Priority, job.NonPreemptible,
+		selectorJSON, affinityJSON, tolerationsJSON, job.ConsensusWeight, job.Adaptive, job.MaxRedundancy,
+		job.Status, job.SubmittedBy, job.SubmittedAt, job.CreditsRequired, job.CanaryID,
 	)
 	return err
 }
 
 func (d *Database) GetJob(id string) (*models.Job, error) {
-	var job models.Job
-	var commandJSON, envJSON []byte
+	return scanJob(d.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+}
 
-	err := d.db.QueryRow(`
-		SELECT id, name, description, docker_image, command, environment, input_data,
-			required_cpu, required_memory, required_gpu, redundancy, consensus, status,
-			submitted_by, submitted_at, started_at, completed_at, result, error_message, credits_required
-		FROM jobs WHERE id = $1`, id).Scan(
-		&job.ID, &job.Name, &job.Description, &job.DockerImage, &commandJSON, &envJSON,
-		&job.InputData, &job.RequiredCPU, &job.RequiredMemory, &job.RequiredGPU,
-		&job.Redundancy, &job.Consensus, &job.Status, &job.SubmittedBy, &job.SubmittedAt,
-		&job.StartedAt, &job.CompletedAt, &job.Result, &job.ErrorMessage, &job.CreditsRequired,
-	)
+// UpdateJobStatus moves a job to status if the state machine allows it from
+// the status the job is in. Returns sql.ErrNoRows if the job doesn't exist and
+// an error wrapping models.ErrInvalidTransition if it can't move, e.g. because
+// it was cancelled or timed out in the meantime.
+func (d *Database) UpdateJobStatus(id string, status models.JobStatus, result, errorMsg string) error {
+	if len(models.JobStatusesBefore(status)) == 0 {
+		return models.CheckJobTransition("", status)
+	}
 
+	var res sql.Result
+	var err error
+	if status.IsFinished() {
+		from, fromArgs := statusList(6, models.JobStatusesBefore(status))
+		res, err = d.db.Exec(`
+			UPDATE jobs SET status = $1, result = $2, error_message = $3, completed_at = $4
+			WHERE id = $5 AND status IN (`+from+`)`,
+			append([]interface{}{status, result, errorMsg, time.Now(), id}, fromArgs...)...,
+		)
+	} else {
+		from, fromArgs := statusList(3, models.JobStatusesBefore(status))
+		res, err = d.db.Exec(`
+			UPDATE jobs SET status = $1 WHERE id = $2 AND status IN (`+from+`)`,
+			append([]interface{}{status, id}, fromArgs...)...,
+		)
+	}
 	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return jobTransitionError(d.db, id, status)
+	}
+	return nil
+}
+
+// jobTransitionError explains why a guarded update couldn't move a job to status
+func jobTransitionError(q querier, id string, status models.JobStatus) error {
+	var current models.JobStatus
+	if err := q.QueryRow(`SELECT status FROM jobs WHERE id = $1`, id).Scan(&current); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: job %s is %s, not moving it to %s", models.ErrInvalidTransition, id, current, status)
+}
+
+// lockJob locks a job's row until the transaction ends and returns the job.
+// Returns ErrLocked if another transaction holds it and sql.ErrNoRows if it
+// doesn't exist.
+func (d *Database) lockJob(q querier, id string) (*models.Job, error) {
+	job, err := scanJob(q.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`+d.dialect.lockRows, id))
+	if err != sql.ErrNoRows {
+		return job, err
+	}
+	var exists bool
+	if err := q.QueryRow(`SELECT TRUE FROM jobs WHERE id = $1`, id).Scan(&exists); err != nil {
 		return nil, err
 	}
+	return nil, ErrLocked
+}
 
-	json.Unmarshal(commandJSON, &job.Command)
-	json.Unmarshal(envJSON, &job.Environment)
+// ScheduleJob moves a pending job to scheduled with one execution on each of
+// the given ones' nodes, and sets its redundancy to their number, all or
+// nothing. The job and the nodes stay locked while the nodes' capacity is
+// checked again, so concurrent coordinators can neither schedule a job twice
+// nor overfill a node. Returns ErrLocked if another transaction holds the job
+// or a node, ErrNoCapacity if a node filled up since it was picked and an
+// error wrapping models.ErrInvalidTransition if the job is no longer pending.
+func (d *Database) ScheduleJob(jobID string, executions []*models.JobExecution) error {
+	return d.transact(func(q querier) error {
+		job, err := d.lockJob(q, jobID)
+		if err != nil {
+			return err
+		}
+		if err := models.CheckJobTransition(job.Status, models.JobStatusScheduled); err != nil {
+			return err
+		}
+		if _, err := d.insertExecutions(q, job, executions, true); err != nil {
+			return err
+		}
+		_, err = q.Exec(`UPDATE jobs SET status = $1, redundancy = $2 WHERE id = $3`,
+			models.JobStatusScheduled, len(executions), jobID)
+		return err
+	})
+}
 
-	return &job, nil
+// AddJobExecutions adds executions to an active job, replacing lost ones or
+// breaking a tie, and returns how many it added. It adds no more than the job
+// is short of its redundancy, not counting executions lost with their node or
+// preempted, and skips nodes that another transaction holds or that filled
+// up, so every coordinator can call it for the same job at once. Returns
+// sql.ErrNoRows if the job doesn't exist or isn't active.
+func (d *Database) AddJobExecutions(jobID string, executions []*models.JobExecution) (int, error) {
+	added := 0
+	err := d.transact(func(q querier) error {
+		job, err := d.lockJob(q, jobID)
+		if err != nil {
+			return err
+		}
+		if job.Status == models.JobStatusPending || job.Status.IsFinished() {
+			return sql.ErrNoRows
+		}
+
+		var counted int
+		err = q.QueryRow(`
+			SELECT COUNT(*) FROM job_executions
+			WHERE job_id = $1 AND COALESCE(error_class, '') NOT IN ($2, $3)`,
+			jobID, models.ErrorClassNodeLost, models.ErrorClassPreempted,
+		).Scan(&counted)
+		if err != nil {
+			return err
+		}
+		if short := job.Redundancy - counted; len(executions) > short {
+			executions = executions[:max(short, 0)]
+		}
+
+		added, err = d.insertExecutions(q, job, executions, false)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
 }
 
-func (d *Database) UpdateJobStatus(id string, status models.JobStatus, result, errorMsg string) error {
-	now := time.Now()
+// insertExecutions locks the executions' nodes, checks each still has room
+// for one more execution of job and inserts the execution as scheduled. With
+// all, a node without room fails the whole batch; otherwise it is skipped.
+func (d *Database) insertExecutions(q querier, job *models.Job, executions []*models.JobExecution, all bool) (int, error) {
+	if len(executions) == 0 {
+		return 0, nil
+	}
+	nodeIDs := make([]string, len(executions))
+	for i, exec := range executions {
+		nodeIDs[i] = exec.NodeID
+	}
+	nodes, err := d.lockNodes(q, nodeIDs)
+	if err != nil {
+		return 0, err
+	}
 
-	if status == models.JobStatusCompleted || status == models.JobStatusFailed {
-		_, err := d.db.Exec(`
-			UPDATE jobs SET status = $1, result = $2, error_message = $3, completed_at = $4
-			WHERE id = $5`,
-			status, result, errorMsg, now, id,
+	inserted := 0
+	for _, exec := range executions {
+		node := nodes[exec.NodeID]
+		switch {
+		case node == nil && all:
+			return 0, fmt.Errorf("%w: node %s", ErrLocked, exec.NodeID)
+		case node != nil && !hasRoom(node, job.RequiredCPU, job.RequiredMemory, job.RequiredGPU) && all:
+			return 0, fmt.Errorf("%w: node %s", ErrNoCapacity, exec.NodeID)
+		case node == nil || !hasRoom(node, job.RequiredCPU, job.RequiredMemory, job.RequiredGPU):
+			continue
+		}
+
+		_, err := q.Exec(`
+			INSERT INTO job_executions (id, job_id, node_id, status, started_at, lease_expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			exec.ID, job.ID, exec.NodeID, models.JobStatusScheduled, exec.StartedAt, exec.LeaseExpiresAt,
 		)
-		return err
+		if err != nil {
+			return 0, err
+		}
+		node.ActiveExecutions++
+		node.UsedCPU += job.RequiredCPU
+		node.UsedMemory += job.RequiredMemory
+		if err := refreshNodeStatus(q, exec.NodeID); err != nil {
+			return 0, err
+		}
+		inserted++
 	}
+	return inserted, nil
+}
 
-	_, err := d.db.Exec(`
-		UPDATE jobs SET status = $1 WHERE id = $2`,
-		status, id,
+// lockNodes locks the rows of the given nodes until the transaction ends and
+// returns them with their current load by ID. Nodes another transaction holds
+// are left out.
+func (d *Database) lockNodes(q querier, nodeIDs []string) (map[string]*models.Node, error) {
+	args := make([]interface{}, len(nodeIDs))
+	for i, id := range nodeIDs {
+		args[i] = id
+	}
+	rows, err := q.Query(`
+		SELECT id FROM nodes WHERE id IN (`+placeholders(1, len(args))+`)
+		ORDER BY id`+d.dialect.lockRows,
+		args...,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	var locked []interface{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		locked = append(locked, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*models.Node)
+	if len(locked) == 0 {
+		return nodes, nil
+	}
+
+	loaded, err := queryNodes(q, `SELECT `+nodeColumns+` FROM `+nodesWithLoad+`
+		WHERE id IN (`+placeholders(1, len(locked))+`)`, locked...)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range loaded {
+		nodes[node.ID] = node
+	}
+	return nodes, nil
 }
 
-func (d *Database) GetPendingJobs() ([]*models.Job, error) {
-	rows, err := d.db.Query(`
-		SELECT id, name, description, docker_image, command, environment, input_data,
-			required_cpu, required_memory, required_gpu, redundancy, consensus, status,
-			submitted_by, submitted_at, credits_required
-		FROM jobs WHERE status = $1 ORDER BY submitted_at ASC`,
-		models.JobStatusPending,
-	)
+// lockNode locks a node's row until the transaction ends and returns it with
+// its current load. Returns ErrLocked if another transaction holds it and
+// sql.ErrNoRows if it doesn't exist.
+func (d *Database) lockNode(q querier, id string) (*models.Node, error) {
+	nodes, err := d.lockNodes(q, []string{id})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	if node := nodes[id]; node != nil {
+		return node, nil
+	}
+	var exists bool
+	if err := q.QueryRow(`SELECT TRUE FROM nodes WHERE id = $1`, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	return nil, ErrLocked
+}
 
-	var jobs []*models.Job
-	for rows.Next() {
-		var job models.Job
-		var commandJSON, envJSON []byte
-
-		err := rows.Scan(
-			&job.ID, &job.Name, &job.Description, &job.DockerImage, &commandJSON, &envJSON,
-			&job.InputData, &job.RequiredCPU, &job.RequiredMemory, &job.RequiredGPU,
-			&job.Redundancy, &job.Consensus, &job.Status, &job.SubmittedBy,
-			&job.SubmittedAt, &job.CreditsRequired,
+// FinalizeJob ends an active job with the outcome of judging its results:
+// its final status, result and verification, and what each node that ran it
+// earns, in one transaction that also cancels its outstanding executions. The job is locked first, so two coordinators
+// can't both finalize it and reward its nodes twice. Returns ErrLocked if
+// another transaction holds the job, sql.ErrNoRows if it doesn't exist and an
+// error wrapping models.ErrInvalidTransition if it has already finished.
+func (d *Database) FinalizeJob(id string, outcome *models.JobOutcome) error {
+	var verificationJSON interface{}
+	if outcome.Verification != nil {
+		data, err := json.Marshal(outcome.Verification)
+		if err != nil {
+			return err
+		}
+		verificationJSON = data
+	}
+
+	return d.transact(func(q querier) error {
+		job, err := d.lockJob(q, id)
+		if err != nil {
+			return err
+		}
+		if err := models.CheckJobTransition(job.Status, outcome.Status); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		_, err = q.Exec(`
+			UPDATE jobs SET status = $1, result = $2, error_message = $3, completed_at = $4, verification = $5
+			WHERE id = $6`,
+			outcome.Status, outcome.Result, outcome.ErrorMessage, now, verificationJSON, id,
 		)
 		if err != nil {
-			continue
+			return err
 		}
 
-		json.Unmarshal(commandJSON, &job.Command)
-		json.Unmarshal(envJSON, &job.Environment)
-		jobs = append(jobs, &job)
-	}
+		// Replicas the outcome didn't wait for, e.g. tie-breakers, are no
+		// longer needed and give their nodes' slots back
+		if _, err := stopExecutions(q, id, models.JobStatusCancelled, "", now); err != nil {
+			return err
+		}
 
-	return jobs, nil
+		for _, reward := range outcome.Rewards {
+			succeeded, failed := 0, 1
+			if reward.Success {
+				succeeded, failed = 1, 0
+			}
+			_, err := q.Exec(`
+				UPDATE nodes SET
+					reputation_score = CASE WHEN reputation_score + $1 < 0 THEN 0 ELSE reputation_score + $1 END,
+					total_jobs_run = total_jobs_run + 1,
+					successful_jobs_run = successful_jobs_run + $2,
+					failed_jobs = failed_jobs + $3,
+					credits_earned = credits_earned + $4
+				WHERE id = $5`,
+				reward.Reputation, succeeded, failed, reward.Credits, reward.NodeID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (d *Database) GetAllJobs() ([]*models.Job, error) {
-	rows, err := d.db.Query(`
-		SELECT id, name, description, docker_image, command, environment, input_data,
-			required_cpu, required_memory, required_gpu, redundancy, consensus, status,
-			submitted_by, submitted_at, started_at, completed_at, result, error_message, credits_required
-		FROM jobs ORDER BY submitted_at DESC LIMIT 100`,
+// AddTieBreakers raises a job's redundancy by count extra executions that
+// are scheduled to break a consensus split. Returns ErrLocked if another
+// transaction holds the job and sql.ErrNoRows if it doesn't exist or isn't
+// active.
+func (d *Database) AddTieBreakers(id string, count int) error {
+	return d.updateActiveJob(id, `
+		UPDATE jobs SET redundancy = redundancy + $1, tie_breakers = COALESCE(tie_breakers, 0) + $1
+		WHERE id = $2`,
+		count,
 	)
+}
+
+// SetJobRedundancy changes how many executions a job should have. Errors are
+// as for AddTieBreakers.
+func (d *Database) SetJobRedundancy(id string, redundancy int) error {
+	return d.updateActiveJob(id, `UPDATE jobs SET redundancy = $1 WHERE id = $2`, redundancy)
+}
+
+// updateActiveJob runs update, whose last argument is the job's ID, on a
+// scheduled or running job while holding its lock
+func (d *Database) updateActiveJob(id, update string, args ...interface{}) error {
+	return d.transact(func(q querier) error {
+		job, err := d.lockJob(q, id)
+		if err != nil {
+			return err
+		}
+		if job.Status == models.JobStatusPending || job.Status.IsFinished() {
+			return sql.ErrNoRows
+		}
+		_, err = q.Exec(update, append(args, id)...)
+		return err
+	})
+}
+
+// CancelJob cancels an unfinished job together with its outstanding executions
+// and returns the nodes those executions were assigned to, whose status it
+// refreshes. Returns ErrLocked if another transaction holds the job,
+// sql.ErrNoRows if it doesn't exist and an error wrapping
+// models.ErrInvalidTransition if it has already finished.
+func (d *Database) CancelJob(id string) ([]string, error) {
+	return d.stopJob(id, models.JobStatusCancelled, "Cancelled by user",
+		models.JobStatusCancelled, "")
+}
+
+// TimeOutJob ends an unfinished job that missed its deadline. Its outstanding
+// executions fail as timed out; the nodes they were assigned to are refreshed
+// and returned. Errors are as for CancelJob.
+func (d *Database) TimeOutJob(id, errorMsg string) ([]string, error) {
+	return d.stopJob(id, models.JobStatusTimedOut, errorMsg,
+		models.JobStatusFailed, models.ErrorClassTimedOut)
+}
+
+// FailJob fails an unfinished job that can't succeed any more and cancels its
+// outstanding executions, whose nodes are refreshed and returned. Errors are
+// as for CancelJob.
+func (d *Database) FailJob(id, errorMsg string) ([]string, error) {
+	return d.stopJob(id, models.JobStatusFailed, errorMsg,
+		models.JobStatusCancelled, "")
+}
+
+// stopJob moves an unfinished job to a final status and stops its scheduled
+// and running executions, in one transaction holding the job's lock
+func (d *Database) stopJob(id string, status models.JobStatus, errorMsg string,
+	execStatus models.JobStatus, execClass models.ErrorClass) ([]string, error) {
+	var nodeIDs []string
+	err := d.transact(func(q querier) error {
+		job, err := d.lockJob(q, id)
+		if err != nil {
+			return err
+		}
+		if err := models.CheckJobTransition(job.Status, status); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		_, err = q.Exec(`
+			UPDATE jobs SET status = $1, error_message = $2, completed_at = $3 WHERE id = $4`,
+			status, errorMsg, now, id,
+		)
+		if err != nil {
+			return err
+		}
+
+		nodeIDs, err = stopExecutions(q, id, execStatus, execClass, now)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return nodeIDs, nil
+}
 
-	var jobs []*models.Job
+// stopExecutions moves a job's scheduled and running executions to a final
+// status, which frees the resources they held, and refreshes the status of
+// their nodes, which it returns
+func stopExecutions(q querier, jobID string, status models.JobStatus, class models.ErrorClass, now time.Time) ([]string, error) {
+	from, fromArgs := statusList(5, models.ExecutionStatusesBefore(status))
+	rows, err := q.Query(`
+		UPDATE job_executions
+		SET status = $1, completed_at = $2, error_class = $3, lease_expires_at = NULL
+		WHERE job_id = $4 AND status IN (`+from+`)
+		RETURNING node_id`,
+		append([]interface{}{status, now, class, jobID}, fromArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var nodeIDs []string
 	for rows.Next() {
-		var job models.Job
-		var commandJSON, envJSON []byte
-
-		err := rows.Scan(
-			&job.ID, &job.Name, &job.Description, &job.DockerImage, &commandJSON, &envJSON,
-			&job.InputData, &job.RequiredCPU, &job.RequiredMemory, &job.RequiredGPU,
-			&job.Redundancy, &job.Consensus, &job.Status, &job.SubmittedBy,
-			&job.SubmittedAt, &job.StartedAt, &job.CompletedAt, &job.Result,
-			&job.ErrorMessage, &job.CreditsRequired,
-		)
-		if err != nil {
-			continue
+		var nodeID string
+		if err := rows.Scan(&nodeID); err != nil {
+			rows.Close()
+			return nil, err
 		}
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		json.Unmarshal(commandJSON, &job.Command)
-		json.Unmarshal(envJSON, &job.Environment)
-		jobs = append(jobs, &job)
+	for _, nodeID := range nodeIDs {
+		if err := refreshNodeStatus(q, nodeID); err != nil {
+			return nil, err
+		}
 	}
+	return nodeIDs, nil
+}
 
-	return jobs, nil
+func (d *Database) GetPendingJobs() ([]*models.Job, error) {
+	return d.queryJobs(`
+		SELECT `+jobColumns+`
+		FROM jobs WHERE status = $1 ORDER BY priority DESC, deadline ASC NULLS LAST, submitted_at ASC`,
+		models.JobStatusPending,
+	)
+}
+
+// GetActiveJobs returns every job that has been scheduled but not yet finished
+func (d *Database) GetActiveJobs() ([]*models.Job, error) {
+	return d.queryJobs(`
+		SELECT `+jobColumns+`
+		FROM jobs WHERE status IN ($1, $2, $3) ORDER BY submitted_at ASC`,
+		models.JobStatusScheduled, models.JobStatusRunning, models.JobStatusVerifying,
+	)
+}
+
+// GetJobs returns the jobs with the given IDs
+func (d *Database) GetJobs(ids []string) ([]*models.Job, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return d.queryJobs(`SELECT `+jobColumns+` FROM jobs WHERE id IN (`+placeholders(1, len(ids))+`)`, args...)
+}
+
+// GetAllJobs returns the most recent jobs. Spot-check canaries are internal
+// and left out.
+func (d *Database) GetAllJobs() ([]*models.Job, error) {
+	return d.queryJobs(`
+		SELECT ` + jobColumns + `
+		FROM jobs WHERE canary_id IS NULL ORDER BY submitted_at DESC LIMIT 100`,
+	)
 }
 
 // Node operations
 func (d *Database) RegisterNode(node *models.Node) error {
+	labelsJSON, _ := json.Marshal(node.Labels)
+	taintsJSON, _ := json.Marshal(node.Taints)
+
 	_, err := d.db.Exec(`
-		INSERT INTO nodes (id, name, region, cpu_cores, memory_gb, gpu_enabled, gpu_model,
-			status, reputation_score, last_heartbeat, registered_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO nodes (id, name, region, owner, host, price, labels, taints, cpu_cores, memory_gb,
+			gpu_enabled, gpu_model, status, reputation_score, last_heartbeat, registered_at, max_slots)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 		ON CONFLICT (id) DO UPDATE SET
 			name = EXCLUDED.name,
 			region = EXCLUDED.region,
+			owner = EXCLUDED.owner,
+			host = EXCLUDED.host,
+			price = EXCLUDED.price,
+			labels = EXCLUDED.labels,
+			taints = EXCLUDED.taints,
 			cpu_cores = EXCLUDED.cpu_cores,
 			memory_gb = EXCLUDED.memory_gb,
 			gpu_enabled = EXCLUDED.gpu_enabled,
 			gpu_model = EXCLUDED.gpu_model,
-			status = EXCLUDED.status,
-			last_heartbeat = EXCLUDED.last_heartbeat`,
-		node.ID, node.Name, node.Region, node.CPUCores, node.MemoryGB,
-		node.GPUEnabled, node.GPUModel, node.Status, node.ReputationScore,
-		node.LastHeartbeat, node.RegisteredAt,
+			status = CASE WHEN nodes.status = $18 THEN nodes.status ELSE EXCLUDED.status END,
+			last_heartbeat = EXCLUDED.last_heartbeat,
+			max_slots = EXCLUDED.max_slots,
+			draining = FALSE`,
+		node.ID, node.Name, node.Region, node.Owner, node.Host, node.Price, labelsJSON, taintsJSON,
+		node.CPUCores, node.MemoryGB, node.GPUEnabled, node.GPUModel, node.Status, node.ReputationScore,
+		node.LastHeartbeat, node.RegisteredAt, node.MaxSlots, models.NodeStatusFaulty,
 	)
 	return err
 }
 
-func (d *Database) GetNode(id string) (*models.Node, error) {
+// nodeColumns lists node columns in the order scanNode expects them. They must
+// be selected from nodesWithLoad.
+const nodeColumns = `
+	id, name, COALESCE(region, ''), COALESCE(owner, ''), COALESCE(host, ''), COALESCE(price, 1),
+	labels, taints,
+	cpu_cores, memory_gb, gpu_enabled, COALESCE(gpu_model, ''), status,
+	reputation_score, total_jobs_run, successful_jobs_run, failed_jobs,
+	credits_earned, last_heartbeat, registered_at, COALESCE(current_job_id, ''),
+	max_slots, COALESCE(cordoned, FALSE), COALESCE(draining, FALSE), maintenance_start, maintenance_end,
+	active_executions, used_cpu, used_memory`
+
+// nodesWithLoad extends nodes with the resources held by their outstanding executions
+const nodesWithLoad = `(
+	SELECT nodes.*,
+		COALESCE(exec_load.active_executions, 0) AS active_executions,
+		COALESCE(exec_load.used_cpu, 0) AS used_cpu,
+		COALESCE(exec_load.used_memory, 0) AS used_memory
+	FROM nodes
+	LEFT JOIN (
+		SELECT e.node_id, COUNT(*) AS active_executions,
+			SUM(j.required_cpu) AS used_cpu, SUM(j.required_memory) AS used_memory
+		FROM job_executions e JOIN jobs j ON j.id = e.job_id
+		WHERE e.status IN ('scheduled', 'running')
+		GROUP BY e.node_id
+	) exec_load ON exec_load.node_id = nodes.id
+) AS nodes`
+
+func scanNode(row rowScanner) (*models.Node, error) {
 	var node models.Node
-	err := d.db.QueryRow(`
-		SELECT id, name, region, cpu_cores, memory_gb, gpu_enabled, gpu_model, status,
-			reputation_score, total_jobs_run, successful_jobs_run, failed_jobs,
-			credits_earned, last_heartbeat, registered_at, current_job_id
-		FROM nodes WHERE id = $1`, id).Scan(
-		&node.ID, &node.Name, &node.Region, &node.CPUCores, &node.MemoryGB,
+	var labelsJSON, taintsJSON []byte
+	err := row.Scan(
+		&node.ID, &node.Name, &node.Region, &node.Owner, &node.Host, &node.Price, &labelsJSON, &taintsJSON,
+		&node.CPUCores, &node.MemoryGB,
 		&node.GPUEnabled, &node.GPUModel, &node.Status, &node.ReputationScore,
 		&node.TotalJobsRun, &node.SuccessfulJobs, &node.FailedJobs,
 		&node.CreditsEarned, &node.LastHeartbeat, &node.RegisteredAt, &node.CurrentJobID,
+		&node.MaxSlots, &node.Cordoned, &node.Draining, &node.MaintenanceStart, &node.MaintenanceEnd,
+		&node.ActiveExecutions, &node.UsedCPU, &node.UsedMemory,
 	)
-	return &node, err
-}
-
-func (d *Database) GetAvailableNodes(requiredCPU, requiredMemory int, requiredGPU bool) ([]*models.Node, error) {
-	query := `
-		SELECT id, name, region, cpu_cores, memory_gb, gpu_enabled, gpu_model, status,
-			reputation_score, total_jobs_run, successful_jobs_run, failed_jobs,
-			credits_earned, last_heartbeat, registered_at, current_job_id
-		FROM nodes
-		WHERE status = $1
-			AND cpu_cores >= $2
-			AND memory_gb >= $3
-			AND ($4 = FALSE OR gpu_enabled = TRUE)
-		ORDER BY reputation_score DESC, total_jobs_run ASC
-	`
-
-	rows, err := d.db.Query(query, models.NodeStatusOnline, requiredCPU, requiredMemory, requiredGPU)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var nodes []*models.Node
-	for rows.Next() {
-		var node models.Node
-		err := rows.Scan(
-			&node.ID, &node.Name, &node.Region, &node.CPUCores, &node.MemoryGB,
-			&node.GPUEnabled, &node.GPUModel, &node.Status, &node.ReputationScore,
-			&node.TotalJobsRun, &node.SuccessfulJobs, &node.FailedJobs,
-			&node.CreditsEarned, &node.LastHeartbeat, &node.RegisteredAt, &node.CurrentJobID,
-		)
-		if err != nil {
-			continue
-		}
-		nodes = append(nodes, &node)
+	if labelsJSON != nil {
+		json.Unmarshal(labelsJSON, &node.Labels)
 	}
-
-	return nodes, nil
+	if taintsJSON != nil {
+		json.Unmarshal(taintsJSON, &node.Taints)
+	}
+	return &node, nil
 }
 
-func (d *Database) GetAllNodes() ([]*models.Node, error) {
-	rows, err := d.db.Query(`
-		SELECT id, name, region, cpu_cores, memory_gb, gpu_enabled, gpu_model, status,
-			reputation_score, total_jobs_run, successful_jobs_run, failed_jobs,
-			credits_earned, last_heartbeat, registered_at, current_job_id
-		FROM nodes ORDER BY registered_at DESC`,
-	)
+func queryNodes(q querier, query string, args ...interface{}) ([]*models.Node, error) {
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -322,28 +783,86 @@ func (d *Database) GetAllNodes() ([]*models.Node, error) {
 
 	var nodes []*models.Node
 	for rows.Next() {
-		var node models.Node
-		err := rows.Scan(
-			&node.ID, &node.Name, &node.Region, &node.CPUCores, &node.MemoryGB,
-			&node.GPUEnabled, &node.GPUModel, &node.Status, &node.ReputationScore,
-			&node.TotalJobsRun, &node.SuccessfulJobs, &node.FailedJobs,
-			&node.CreditsEarned, &node.LastHeartbeat, &node.RegisteredAt, &node.CurrentJobID,
-		)
+		node, err := scanNode(rows)
 		if err != nil {
 			continue
 		}
-		nodes = append(nodes, &node)
+		nodes = append(nodes, node)
 	}
 
 	return nodes, nil
 }
 
-func (d *Database) UpdateNodeHeartbeat(nodeID string, heartbeat *models.Heartbeat) error {
-	_, err := d.db.Exec(`
-		UPDATE nodes SET last_heartbeat = $1, status = $2 WHERE id = $3`,
-		heartbeat.Timestamp, models.NodeStatusOnline, nodeID,
+func (d *Database) GetNode(id string) (*models.Node, error) {
+	return scanNode(d.db.QueryRow(`SELECT `+nodeColumns+` FROM `+nodesWithLoad+` WHERE id = $1`, id))
+}
+
+// GetAvailableNodes returns live nodes in rotation with a free slot and
+// enough spare CPU/memory for one more execution with the given requirements
+func (d *Database) GetAvailableNodes(requiredCPU, requiredMemory int, requiredGPU bool) ([]*models.Node, error) {
+	return queryNodes(d.db, `
+		SELECT `+nodeColumns+`
+		FROM `+nodesWithLoad+`
+		WHERE status IN ($1, $2) AND NOT COALESCE(cordoned, FALSE) AND NOT COALESCE(draining, FALSE)
+			AND active_executions < max_slots
+			AND cpu_cores - used_cpu >= $3
+			AND memory_gb - used_memory >= $4
+			AND ($5 = FALSE OR gpu_enabled = TRUE)
+		ORDER BY reputation_score DESC, active_executions ASC, total_jobs_run ASC`,
+		models.NodeStatusOnline, models.NodeStatusBusy, requiredCPU, requiredMemory, requiredGPU,
+	)
+}
+
+// GetLiveNodes returns online and busy nodes in rotation big enough for the
+// given requirements, however loaded they are
+func (d *Database) GetLiveNodes(requiredCPU, requiredMemory int, requiredGPU bool) ([]*models.Node, error) {
+	return queryNodes(d.db, `
+		SELECT `+nodeColumns+`
+		FROM `+nodesWithLoad+`
+		WHERE status IN ($1, $2) AND NOT COALESCE(cordoned, FALSE) AND NOT COALESCE(draining, FALSE)
+			AND cpu_cores >= $3
+			AND memory_gb >= $4
+			AND ($5 = FALSE OR gpu_enabled = TRUE)
+		ORDER BY reputation_score DESC`,
+		models.NodeStatusOnline, models.NodeStatusBusy, requiredCPU, requiredMemory, requiredGPU,
+	)
+}
+
+// GetEligibleNodes returns registered, non-faulty nodes that could ever satisfy
+// the given requirements, regardless of whether they are currently available
+func (d *Database) GetEligibleNodes(requiredCPU, requiredMemory int, requiredGPU bool) ([]*models.Node, error) {
+	return queryNodes(d.db, `
+		SELECT `+nodeColumns+`
+		FROM `+nodesWithLoad+`
+		WHERE status != $1
+			AND cpu_cores >= $2
+			AND memory_gb >= $3
+			AND ($4 = FALSE OR gpu_enabled = TRUE)`,
+		models.NodeStatusFaulty, requiredCPU, requiredMemory, requiredGPU,
 	)
-	return err
+}
+
+func (d *Database) GetAllNodes() ([]*models.Node, error) {
+	return queryNodes(d.db, `SELECT `+nodeColumns+` FROM `+nodesWithLoad+` ORDER BY registered_at DESC`)
+}
+
+// UpdateNodeHeartbeat records a heartbeat, bringing an offline node back online
+// unless it is cordoned or drained, and picking up a changed slot count
+func (d *Database) UpdateNodeHeartbeat(nodeID string, heartbeat *models.Heartbeat) error {
+	_, err := d.db.Exec(`
+		UPDATE nodes SET
+			last_heartbeat = $1,
+			status = CASE WHEN status = $2 AND NOT COALESCE(cordoned, FALSE) AND NOT COALESCE(draining, FALSE)
+				THEN $3 ELSE status END,
+			max_slots = CASE WHEN $4 > 0 THEN $4 ELSE max_slots END
+		WHERE id = $5`,
+		heartbeat.Timestamp, models.NodeStatusOffline, models.NodeStatusOnline,
+		heartbeat.TotalSlots, nodeID,
+	)
+	if err != nil {
+		return err
+	}
+	return d.RefreshNodeStatus(nodeID)
 }
 
 func (d *Database) UpdateNodeStatus(nodeID string, status models.NodeStatus) error {
@@ -351,87 +870,1092 @@ func (d *Database) UpdateNodeStatus(nodeID string, status models.NodeStatus) err
 	return err
 }
 
+// RefreshNodeStatus flips a live node between online and busy depending on
+// whether all of its slots are taken. Offline and faulty nodes are left alone.
+func (d *Database) RefreshNodeStatus(nodeID string) error {
+	return refreshNodeStatus(d.db, nodeID)
+}
+
+func refreshNodeStatus(q querier, nodeID string) error {
+	_, err := q.Exec(`
+		UPDATE nodes SET status = CASE
+			WHEN (SELECT COUNT(*) FROM job_executions
+				WHERE node_id = $1 AND status IN ($2, $3)) >= max_slots THEN $4
+			ELSE $5 END
+		WHERE id = $1 AND status IN ($4, $5)`,
+		nodeID, models.JobStatusScheduled, models.JobStatusRunning,
+		models.NodeStatusBusy, models.NodeStatusOnline,
+	)
+	return err
+}
+
+// SetNodeCordoned takes a node out of rotation or puts it back. Uncordoning
+// also stops a drain. Returns sql.ErrNoRows if the node doesn't exist.
+func (d *Database) SetNodeCordoned(nodeID string, cordoned bool) error {
+	res, err := d.db.Exec(`
+		UPDATE nodes SET cordoned = $1, draining = COALESCE(draining, FALSE) AND $1 WHERE id = $2`,
+		cordoned, nodeID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DrainNode stops new executions going to a node, which goes offline once its
+// claimed executions have finished. Executions it hasn't claimed yet are
+// failed as lost, so the scheduler moves them elsewhere; their job IDs are
+// returned. With cordon the node also stays out of rotation afterwards.
+// Returns ErrLocked if another transaction holds the node and sql.ErrNoRows
+// if it doesn't exist.
+func (d *Database) DrainNode(nodeID string, cordon bool) ([]string, error) {
+	var jobIDs []string
+	err := d.transact(func(q querier) error {
+		// Holding the node's lock keeps the scheduler from placing executions
+		// on it until it is marked draining
+		if _, err := d.lockNode(q, nodeID); err != nil {
+			return err
+		}
+		_, err := q.Exec(`
+			UPDATE nodes SET draining = TRUE, cordoned = COALESCE(cordoned, FALSE) OR $1 WHERE id = $2`,
+			cordon, nodeID,
+		)
+		if err != nil {
+			return err
+		}
+
+		rows, err := q.Query(`
+			UPDATE job_executions
+			SET status = $1, completed_at = $2, error_class = $3, error_message = $4, lease_expires_at = NULL
+			WHERE node_id = $5 AND status = $6
+			RETURNING job_id`,
+			models.JobStatusFailed, time.Now(), models.ErrorClassNodeLost, "Node draining", nodeID,
+			models.JobStatusScheduled,
+		)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var jobID string
+			if err := rows.Scan(&jobID); err != nil {
+				rows.Close()
+				return err
+			}
+			jobIDs = append(jobIDs, jobID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		return refreshNodeStatus(q, nodeID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobIDs, nil
+}
+
+// FinishDrains takes live draining nodes without outstanding executions
+// offline and returns their IDs. They stay draining, and so offline, until
+// they register again or are uncordoned.
+func (d *Database) FinishDrains() ([]string, error) {
+	rows, err := d.db.Query(`
+		UPDATE nodes SET status = $1
+		WHERE draining AND status IN ($2, $3) AND NOT EXISTS (
+			SELECT 1 FROM job_executions
+			WHERE node_id = nodes.id AND status IN ($4, $5)
+		)
+		RETURNING id`,
+		models.NodeStatusOffline, models.NodeStatusOnline, models.NodeStatusBusy,
+		models.JobStatusScheduled, models.JobStatusRunning,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodeIDs []string
+	for rows.Next() {
+		var nodeID string
+		if err := rows.Scan(&nodeID); err != nil {
+			return nil, err
+		}
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	return nodeIDs, rows.Err()
+}
+
+// SetNodeMaintenance schedules a node's maintenance window, or clears it when
+// start and end are nil. Returns sql.ErrNoRows if the node doesn't exist.
+func (d *Database) SetNodeMaintenance(nodeID string, start, end *time.Time) error {
+	res, err := d.db.Exec(`
+		UPDATE nodes SET maintenance_start = $1, maintenance_end = $2 WHERE id = $3`,
+		start, end, nodeID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ReinstateNode lifts a faulty node's quarantine. The node comes back as
+// offline and goes online with its next heartbeat. Returns sql.ErrNoRows if
+// the node doesn't exist or isn't faulty.
+func (d *Database) ReinstateNode(nodeID string) error {
+	res, err := d.db.Exec(`UPDATE nodes SET status = $1 WHERE id = $2 AND status = $3`,
+		models.NodeStatusOffline, nodeID, models.NodeStatusFaulty)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (d *Database) UpdateNodeReputation(nodeID string, delta float64) error {
 	_, err := d.db.Exec(`
-		UPDATE nodes SET reputation_score = GREATEST(0, reputation_score + $1) WHERE id = $2`,
+		UPDATE nodes SET reputation_score = CASE WHEN reputation_score + $1 < 0 THEN 0 ELSE reputation_score + $1 END
+		WHERE id = $2`,
 		delta, nodeID,
 	)
 	return err
 }
 
-func (d *Database) IncrementNodeStats(nodeID string, success bool, creditsEarned int) error {
-	if success {
-		_, err := d.db.Exec(`
-			UPDATE nodes SET
-				total_jobs_run = total_jobs_run + 1,
-				successful_jobs_run = successful_jobs_run + 1,
-				credits_earned = credits_earned + $1
-			WHERE id = $2`,
-			creditsEarned, nodeID,
+// TakeNodeOffline marks a live node that has sent no heartbeat since
+// staleBefore offline, lowers its reputation by penalty and fails its
+// outstanding executions as lost, all in one transaction, and returns the IDs
+// of the jobs those executions belonged to. Returns sql.ErrNoRows if the node
+// doesn't exist or is no longer live and stale, and ErrLocked if another
+// transaction holds the node or one of those jobs.
+func (d *Database) TakeNodeOffline(nodeID string, staleBefore time.Time, penalty float64, errorMsg string) ([]string, error) {
+	var jobIDs []string
+	err := d.transact(func(q querier) error {
+		node, err := d.lockNode(q, nodeID)
+		if err != nil {
+			return err
+		}
+		live := node.Status == models.NodeStatusOnline || node.Status == models.NodeStatusBusy
+		if !live || !node.LastHeartbeat.Before(staleBefore) {
+			return sql.ErrNoRows
+		}
+
+		_, err = q.Exec(`
+			UPDATE nodes SET status = $1,
+				reputation_score = CASE WHEN reputation_score - $2 < 0 THEN 0 ELSE reputation_score - $2 END
+			WHERE id = $3`,
+			models.NodeStatusOffline, penalty, nodeID,
 		)
+		if err != nil {
+			return err
+		}
+		jobIDs, err = d.failNodeExecutions(q, nodeID, models.ErrorClassNodeLost, errorMsg)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return jobIDs, nil
+}
 
-	_, err := d.db.Exec(`
-		UPDATE nodes SET
-			total_jobs_run = total_jobs_run + 1,
-			failed_jobs = failed_jobs + 1
-		WHERE id = $1`,
-		nodeID,
+// QuarantineNode marks a node faulty, so it gets no more work until an admin
+// reinstates it, and fails its outstanding executions as lost, in one
+// transaction. It returns the IDs of the jobs those executions belonged to.
+// Returns sql.ErrNoRows if the node doesn't exist and ErrLocked if another
+// transaction holds the node or one of those jobs.
+func (d *Database) QuarantineNode(nodeID, reason string) ([]string, error) {
+	var jobIDs []string
+	err := d.transact(func(q querier) error {
+		var err error
+		jobIDs, err = d.quarantineNode(q, nodeID, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobIDs, nil
+}
+
+// quarantineNode is QuarantineNode within a transaction
+func (d *Database) quarantineNode(q querier, nodeID, reason string) ([]string, error) {
+	if _, err := d.lockNode(q, nodeID); err != nil {
+		return nil, err
+	}
+	if _, err := q.Exec(`UPDATE nodes SET status = $1 WHERE id = $2`, models.NodeStatusFaulty, nodeID); err != nil {
+		return nil, err
+	}
+	return d.failNodeExecutions(q, nodeID, models.ErrorClassNodeLost, reason)
+}
+
+// ErrLeaseNotHeld is returned when a node tries to claim or renew an execution it doesn't own
+var ErrLeaseNotHeld = errors.New("execution lease not held by node")
+
+// ErrLocked is returned when a job or node is locked by another transaction,
+// typically another coordinator's working on it. Try again later.
+var ErrLocked = errors.New("locked by another transaction")
+
+// ErrNoCapacity is returned when a node picked for an execution no longer has room for it
+var ErrNoCapacity = errors.New("node has no room for the execution")
+
+// executionColumns lists execution columns in the order scanExecution expects them
+const executionColumns = `
+	id, job_id, node_id, status, started_at, completed_at,
+	COALESCE(result, ''), COALESCE(result_hash, ''), COALESCE(error_message, ''),
+	COALESCE(stdout, ''), COALESCE(stderr, ''), COALESCE(error_class, ''), claimed_at, lease_expires_at,
+	run_started_at`
+
+func scanExecution(row rowScanner) (*models.JobExecution, error) {
+	var exec models.JobExecution
+	err := row.Scan(
+		&exec.ID, &exec.JobID, &exec.NodeID, &exec.Status, &exec.StartedAt,
+		&exec.CompletedAt, &exec.Result, &exec.ResultHash, &exec.ErrorMessage,
+		&exec.Stdout, &exec.Stderr, &exec.ErrorClass, &exec.ClaimedAt, &exec.LeaseExpiresAt,
+		&exec.RunStartedAt,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	return &exec, nil
+}
+
+func queryExecutions(q querier, query string, args ...interface{}) ([]*models.JobExecution, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var executions []*models.JobExecution
+	for rows.Next() {
+		exec, err := scanExecution(rows)
+		if err != nil {
+			continue
+		}
+		executions = append(executions, exec)
+	}
+
+	return executions, nil
 }
 
 // JobExecution operations
-func (d *Database) CreateJobExecution(execution *models.JobExecution) error {
-	_, err := d.db.Exec(`
-		INSERT INTO job_executions (id, job_id, node_id, status, started_at)
-		VALUES ($1, $2, $3, $4, $5)`,
-		execution.ID, execution.JobID, execution.NodeID, execution.Status, execution.StartedAt,
+
+// UpdateJobExecution writes an execution's outcome and refreshes its node's
+// status, provided the state machine allows the execution's new status from
+// its current one. Returns sql.ErrNoRows if the execution doesn't exist and
+// an error wrapping models.ErrInvalidTransition if it can't move.
+func (d *Database) UpdateJobExecution(execution *models.JobExecution) error {
+	if len(models.ExecutionStatusesBefore(execution.Status)) == 0 {
+		return models.CheckExecutionTransition("", execution.Status)
+	}
+
+	return d.transact(func(q querier) error {
+		from, fromArgs := statusList(11, models.ExecutionStatusesBefore(execution.Status))
+		var nodeID string
+		err := q.QueryRow(`
+			UPDATE job_executions
+			SET status = $1, completed_at = $2, result = $3, result_hash = $4,
+			    error_message = $5, stdout = $6, stderr = $7, error_class = $8, lease_expires_at = $9
+			WHERE id = $10 AND status IN (`+from+`)
+			RETURNING node_id`,
+			append([]interface{}{execution.Status, execution.CompletedAt, execution.Result, execution.ResultHash,
+				execution.ErrorMessage, execution.Stdout, execution.Stderr, execution.ErrorClass,
+				execution.LeaseExpiresAt, execution.ID}, fromArgs...)...,
+		).Scan(&nodeID)
+		if err == sql.ErrNoRows {
+			var current models.JobStatus
+			if err := q.QueryRow(`SELECT status FROM job_executions WHERE id = $1`, execution.ID).Scan(&current); err != nil {
+				return err
+			}
+			return models.CheckExecutionTransition(current, execution.Status)
+		}
+		if err != nil {
+			return err
+		}
+		return refreshNodeStatus(q, nodeID)
+	})
+}
+
+// FinishJobExecution records a worker's result, provided the execution is still
+// running under that worker's lease, and refreshes the worker's status
+func (d *Database) FinishJobExecution(execution *models.JobExecution) error {
+	if err := checkFinish(execution); err != nil {
+		return err
+	}
+	return d.transact(func(q querier) error {
+		res, err := q.Exec(`
+			UPDATE job_executions
+			SET status = $1, completed_at = $2, result = $3, result_hash = $4,
+			    error_message = $5, stdout = $6, stderr = $7, error_class = $8, lease_expires_at = NULL
+			WHERE id = $9 AND node_id = $10 AND status = $11`,
+			execution.Status, execution.CompletedAt, execution.Result, execution.ResultHash,
+			execution.ErrorMessage, execution.Stdout, execution.Stderr, execution.ErrorClass,
+			execution.ID, execution.NodeID, models.JobStatusRunning,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrLeaseNotHeld
+		}
+		return refreshNodeStatus(q, execution.NodeID)
+	})
+}
+
+func (d *Database) GetJobExecution(id string) (*models.JobExecution, error) {
+	return scanExecution(d.db.QueryRow(`SELECT `+executionColumns+` FROM job_executions WHERE id = $1`, id))
+}
+
+func (d *Database) GetJobExecutions(jobID string) ([]*models.JobExecution, error) {
+	return queryExecutions(d.db, `
+		SELECT `+executionColumns+`
+		FROM job_executions WHERE job_id = $1`,
+		jobID,
 	)
-	return err
 }
 
-func (d *Database) UpdateJobExecution(execution *models.JobExecution) error {
-	_, err := d.db.Exec(`
+// checkFinish refuses a worker's result that doesn't end the execution
+func checkFinish(execution *models.JobExecution) error {
+	if !execution.Status.IsFinished() {
+		return fmt.Errorf("%w: execution %s can't finish as %s", models.ErrInvalidTransition, execution.ID, execution.Status)
+	}
+	return models.CheckExecutionTransition(models.JobStatusRunning, execution.Status)
+}
+
+// GetScheduledExecutions returns the executions scheduled on a node that it
+// hasn't claimed yet, each with its job, most urgent first. It is one query on
+// the (node_id, status) index, however many executions there are.
+func (d *Database) GetScheduledExecutions(nodeID string) ([]*models.PendingExecution, error) {
+	rows, err := d.db.Query(`
+		SELECT `+jobColumns+`, e.execution_id, e.scheduled_at, e.claim_deadline
+		FROM jobs JOIN (
+			SELECT id AS execution_id, job_id, started_at AS scheduled_at, lease_expires_at AS claim_deadline
+			FROM job_executions WHERE node_id = $1 AND status = $2
+		) e ON e.job_id = jobs.id
+		ORDER BY COALESCE(jobs.priority, 0) DESC, e.scheduled_at ASC`,
+		nodeID, models.JobStatusScheduled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []*models.PendingExecution
+	for rows.Next() {
+		exec := &models.JobExecution{NodeID: nodeID, Status: models.JobStatusScheduled}
+		job, err := scanJob(withColumns{rows, []interface{}{&exec.ID, &exec.StartedAt, &exec.LeaseExpiresAt}})
+		if err != nil {
+			return nil, err
+		}
+		exec.JobID = job.ID
+		pending = append(pending, &models.PendingExecution{Execution: exec, Job: job})
+	}
+
+	return pending, rows.Err()
+}
+
+// ClaimJobExecution atomically moves a scheduled execution owned by nodeID to
+// running and grants the node a lease, moving the job to running with its
+// first claim. Only one claim can ever succeed. The job is locked first, so
+// the execution can't be claimed while its job is stopped, finalized or the
+// execution reassigned. Returns ErrLocked if another transaction holds the
+// job.
+func (d *Database) ClaimJobExecution(executionID, nodeID string, lease time.Duration) (*models.JobExecution, error) {
+	var exec *models.JobExecution
+	err := d.transact(func(q querier) error {
+		current, job, err := d.lockExecution(q, executionID)
+		if err == sql.ErrNoRows {
+			return ErrLeaseNotHeld
+		}
+		if err != nil {
+			return err
+		}
+		if current.NodeID != nodeID || current.Status != models.JobStatusScheduled || job.Status.IsFinished() {
+			return ErrLeaseNotHeld
+		}
+
+		now := time.Now()
+		from, fromArgs := statusList(4, models.JobStatusesBefore(models.JobStatusRunning))
+		_, err = q.Exec(`
+			UPDATE jobs SET status = $1, started_at = COALESCE(started_at, $2)
+			WHERE id = $3 AND status IN (`+from+`)`,
+			append([]interface{}{models.JobStatusRunning, now, job.ID}, fromArgs...)...,
+		)
+		if err != nil {
+			return err
+		}
+
+		exec, err = scanExecution(q.QueryRow(`
+			UPDATE job_executions
+			SET status = $1, claimed_at = $2, lease_expires_at = $3
+			WHERE id = $4 AND node_id = $5 AND status = $6
+			RETURNING `+executionColumns,
+			models.JobStatusRunning, now, now.Add(lease), executionID, nodeID, models.JobStatusScheduled,
+		))
+		if err == sql.ErrNoRows {
+			return ErrLeaseNotHeld
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exec, nil
+}
+
+// lockExecution locks an execution's job until the transaction ends and
+// returns the execution, read once the job is locked, with the job. Returns
+// ErrLocked if another transaction holds the job and sql.ErrNoRows if the
+// execution doesn't exist.
+func (d *Database) lockExecution(q querier, executionID string) (*models.JobExecution, *models.Job, error) {
+	var jobID string
+	if err := q.QueryRow(`SELECT job_id FROM job_executions WHERE id = $1`, executionID).Scan(&jobID); err != nil {
+		return nil, nil, err
+	}
+	job, err := d.lockJob(q, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	exec, err := scanExecution(q.QueryRow(`SELECT `+executionColumns+` FROM job_executions WHERE id = $1`, executionID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return exec, job, nil
+}
+
+// RenewJobExecutionLease extends the lease of a running execution held by nodeID
+func (d *Database) RenewJobExecutionLease(executionID, nodeID string, lease time.Duration) (time.Time, error) {
+	expiresAt := time.Now().Add(lease)
+	res, err := d.db.Exec(`
+		UPDATE job_executions SET lease_expires_at = $1
+		WHERE id = $2 AND node_id = $3 AND status = $4`,
+		expiresAt, executionID, nodeID, models.JobStatusRunning,
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return time.Time{}, ErrLeaseNotHeld
+	}
+	return expiresAt, nil
+}
+
+// FailNodeExecutions fails every outstanding execution on a node and returns
+// the IDs of the jobs they belonged to. The node and those jobs are locked
+// first. Returns ErrLocked if another transaction holds any of them, in which
+// case nothing is failed, and sql.ErrNoRows if the node doesn't exist.
+func (d *Database) FailNodeExecutions(nodeID string, class models.ErrorClass, errorMsg string) ([]string, error) {
+	var jobIDs []string
+	err := d.transact(func(q querier) error {
+		var err error
+		jobIDs, err = d.failNodeExecutions(q, nodeID, class, errorMsg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobIDs, nil
+}
+
+// failNodeExecutions is FailNodeExecutions within a transaction
+func (d *Database) failNodeExecutions(q querier, nodeID string, class models.ErrorClass, errorMsg string) ([]string, error) {
+	if _, err := d.lockNode(q, nodeID); err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(`
+		SELECT DISTINCT job_id FROM job_executions
+		WHERE node_id = $1 AND status IN ($2, $3)
+		ORDER BY job_id`,
+		nodeID, models.JobStatusScheduled, models.JobStatusRunning,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var jobIDs []string
+	for rows.Next() {
+		var jobID string
+		if err := rows.Scan(&jobID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		jobIDs = append(jobIDs, jobID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, jobID := range jobIDs {
+		if _, err := d.lockJob(q, jobID); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = q.Exec(`
 		UPDATE job_executions
-		SET status = $1, completed_at = $2, result = $3, result_hash = $4,
-		    error_message = $5, logs = $6
-		WHERE id = $7`,
-		execution.Status, execution.CompletedAt, execution.Result, execution.ResultHash,
-		execution.ErrorMessage, execution.Logs, execution.ID,
+		SET status = $1, completed_at = $2, error_class = $3, error_message = $4, lease_expires_at = NULL
+		WHERE node_id = $5 AND status IN ($6, $7)`,
+		models.JobStatusFailed, time.Now(), class, errorMsg, nodeID,
+		models.JobStatusScheduled, models.JobStatusRunning,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	if err := refreshNodeStatus(q, nodeID); err != nil {
+		return nil, err
+	}
+	return jobIDs, nil
 }
 
-func (d *Database) GetJobExecutions(jobID string) ([]*models.JobExecution, error) {
+// GetRevokedExecutions returns the subset of executionIDs that the node should
+// no longer be running: cancelled, finished, reassigned elsewhere or unknown
+func (d *Database) GetRevokedExecutions(nodeID string, executionIDs []string) ([]string, error) {
+	if len(executionIDs) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{nodeID, models.JobStatusRunning}
+	for _, id := range executionIDs {
+		args = append(args, id)
+	}
 	rows, err := d.db.Query(`
-		SELECT id, job_id, node_id, status, started_at, completed_at,
-		       result, result_hash, error_message, logs
-		FROM job_executions WHERE job_id = $1`,
-		jobID,
+		SELECT id FROM job_executions
+		WHERE node_id = $1 AND status = $2 AND id IN (`+placeholders(3, len(executionIDs))+`)`,
+		args...,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var executions []*models.JobExecution
+	valid := make(map[string]bool)
 	for rows.Next() {
-		var exec models.JobExecution
-		err := rows.Scan(
-			&exec.ID, &exec.JobID, &exec.NodeID, &exec.Status, &exec.StartedAt,
-			&exec.CompletedAt, &exec.Result, &exec.ResultHash, &exec.ErrorMessage, &exec.Logs,
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		valid[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var revoked []string
+	for _, id := range executionIDs {
+		if !valid[id] {
+			revoked = append(revoked, id)
+		}
+	}
+	return revoked, nil
+}
+
+// GetPreemptibleExecutions returns the outstanding executions of active jobs
+// below the given priority that allow preemption
+func (d *Database) GetPreemptibleExecutions(belowPriority int) ([]*models.JobExecution, error) {
+	return queryExecutions(d.db, `
+		SELECT `+executionColumns+`
+		FROM job_executions
+		WHERE status IN ($1, $2) AND job_id IN (
+			SELECT id FROM jobs
+			WHERE status IN ($1, $2, $3) AND COALESCE(priority, 0) < $4
+				AND NOT COALESCE(non_preemptible, FALSE)
+		)`,
+		models.JobStatusScheduled, models.JobStatusRunning, models.JobStatusVerifying, belowPriority,
+	)
+}
+
+// PreemptJobExecution revokes an outstanding execution to free its node and
+// refreshes the node's status. The worker is told to stop it on its next
+// heartbeat or lease renewal. The execution's job and node are locked first.
+// Returns ErrLocked if another transaction holds either and sql.ErrNoRows if
+// the execution or its job already finished.
+func (d *Database) PreemptJobExecution(executionID, reason string) error {
+	return d.transact(func(q querier) error {
+		exec, job, err := d.lockExecution(q, executionID)
+		if err != nil {
+			return err
+		}
+		if job.Status.IsFinished() {
+			return sql.ErrNoRows
+		}
+		if _, err := d.lockNode(q, exec.NodeID); err != nil {
+			return err
+		}
+
+		res, err := q.Exec(`
+			UPDATE job_executions
+			SET status = $1, completed_at = $2, error_class = $3, error_message = $4, lease_expires_at = NULL
+			WHERE id = $5 AND status IN ($6, $7)`,
+			models.JobStatusFailed, time.Now(), models.ErrorClassPreempted, reason, executionID,
+			models.JobStatusScheduled, models.JobStatusRunning,
 		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return refreshNodeStatus(q, exec.NodeID)
+	})
+}
+
+// GetDisputedExecutions returns the completed executions of jobs whose
+// completed results didn't all hash the same, for executions completed since
+// the given time
+func (d *Database) GetDisputedExecutions(since time.Time) ([]*models.JobExecution, error) {
+	return queryExecutions(d.db, `
+		SELECT `+executionColumns+`
+		FROM job_executions
+		WHERE status = $1 AND completed_at >= $2 AND job_id IN (
+			SELECT job_id FROM job_executions
+			WHERE status = $1 AND completed_at >= $2 AND result_hash IS NOT NULL
+			GROUP BY job_id HAVING COUNT(DISTINCT result_hash) > 1
+		)
+		ORDER BY job_id, completed_at`,
+		models.JobStatusCompleted, since,
+	)
+}
+
+// GetExpiredExecutions returns scheduled executions nobody claimed in time and
+// running executions whose lease was not renewed
+func (d *Database) GetExpiredExecutions() ([]*models.JobExecution, error) {
+	return queryExecutions(d.db, `
+		SELECT `+executionColumns+`
+		FROM job_executions
+		WHERE status IN ($1, $2) AND lease_expires_at < $3`,
+		models.JobStatusScheduled, models.JobStatusRunning, time.Now(),
+	)
+}
+
+// TimeOutOverrunExecutions fails running executions that have run longer than
+// their job's timeout plus grace, in case the worker didn't stop them itself,
+// and returns the nodes they were running on, whose status it refreshes. The
+// timeout counts from when the worker reported the container started or,
+// until it does, from the claim plus pullAllowance for pulling the image.
+// Each execution's job and node are locked first; executions whose job or
+// node another transaction holds are left for the next call.
+func (d *Database) TimeOutOverrunExecutions(grace, pullAllowance time.Duration) ([]string, error) {
+	started := "COALESCE(" + d.dialect.epoch("e.run_started_at") + ", " + d.dialect.epoch("e.claimed_at") + " + $4)"
+	overrun := `
+		SELECT e.id FROM job_executions e JOIN jobs j ON j.id = e.job_id
+		WHERE e.status = $1 AND j.timeout_seconds > 0
+			AND ` + started + ` + j.timeout_seconds + $3 < ` + d.dialect.epoch("$2")
+
+	var nodeIDs []string
+	err := d.transact(func(q querier) error {
+		now := time.Now()
+		args := []interface{}{models.JobStatusRunning, now, int(grace.Seconds()), int(pullAllowance.Seconds())}
+		candidates, err := queryExecutions(q, `
+			SELECT `+executionColumns+` FROM job_executions
+			WHERE id IN (`+overrun+`)
+			ORDER BY job_id, id`,
+			args...,
+		)
+		if err != nil {
+			return err
+		}
+
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		// Jobs are locked before nodes, the order scheduling locks them in
+		locked := make(map[string]bool)
+		var candidateNodes []string
+		for _, exec := range candidates {
+			if _, ok := locked[exec.JobID]; !ok {
+				_, err := d.lockJob(q, exec.JobID)
+				if err != nil && err != ErrLocked {
+					return err
+				}
+				locked[exec.JobID] = err == nil
+			}
+			candidateNodes = append(candidateNodes, exec.NodeID)
+		}
+		nodes, err := d.lockNodes(q, candidateNodes)
+		if err != nil {
+			return err
+		}
+
+		for _, exec := range candidates {
+			if !locked[exec.JobID] || nodes[exec.NodeID] == nil {
+				continue
+			}
+			// Checked again under the locks, in case the execution finished
+			// or its worker reported it started meanwhile
+			res, err := q.Exec(`
+				UPDATE job_executions
+				SET status = $5, completed_at = $2, error_class = $6,
+				    error_message = $7, lease_expires_at = NULL
+				WHERE id = $8 AND id IN (`+overrun+`)`,
+				append(args[:len(args):len(args)], models.JobStatusFailed, models.ErrorClassTimedOut,
+					"Execution exceeded the job timeout", exec.ID)...,
+			)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			if err := refreshNodeStatus(q, exec.NodeID); err != nil {
+				return err
+			}
+			nodeIDs = append(nodeIDs, exec.NodeID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodeIDs, nil
+}
+
+// StartJobExecution records that a node started running an execution it
+// holds, the first time it reports so. Returns ErrLeaseNotHeld if the
+// execution isn't running on the node.
+func (d *Database) StartJobExecution(executionID, nodeID string) error {
+	res, err := d.db.Exec(`
+		UPDATE job_executions SET run_started_at = COALESCE(run_started_at, $1)
+		WHERE id = $2 AND node_id = $3 AND status = $4`,
+		time.Now(), executionID, nodeID, models.JobStatusRunning,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseNotHeld
+	}
+	return nil
+}
+
+// ReassignJobExecution hands an expired execution to toNodeID as a fresh,
+// unclaimed execution and refreshes the status of both nodes. It is a no-op
+// (ErrLeaseNotHeld) if the lease was renewed or the execution finished in the
+// meantime, or its job did. The job and, when moving to another node, that
+// node are locked, and the node is checked to still have room: ErrLocked and
+// ErrNoCapacity mean the execution stays put for now.
+func (d *Database) ReassignJobExecution(executionID, toNodeID string, claimDeadline time.Time) error {
+	return d.transact(func(q querier) error {
+		var fromNodeID, jobID string
+		err := q.QueryRow(`SELECT node_id, job_id FROM job_executions WHERE id = $1`, executionID).
+			Scan(&fromNodeID, &jobID)
+		if err == sql.ErrNoRows {
+			return ErrLeaseNotHeld
+		}
+		if err != nil {
+			return err
+		}
+
+		// The job is locked before the node, the order scheduling locks them
+		// in, and a job that finished meanwhile keeps its execution stopped
+		job, err := d.lockJob(q, jobID)
+		if err != nil {
+			return err
+		}
+		if job.Status.IsFinished() {
+			return ErrLeaseNotHeld
+		}
+
+		if toNodeID != fromNodeID {
+			node, err := d.lockNode(q, toNodeID)
+			if err == sql.ErrNoRows {
+				return ErrNoCapacity
+			}
+			if err != nil {
+				return err
+			}
+			if !hasRoom(node, job.RequiredCPU, job.RequiredMemory, job.RequiredGPU) {
+				return ErrNoCapacity
+			}
+		}
+
+		now := time.Now()
+		res, err := q.Exec(`
+			UPDATE job_executions
+			SET node_id = $1, status = $2, started_at = $3, claimed_at = NULL, lease_expires_at = $4,
+			    run_started_at = NULL
+			WHERE id = $5 AND status IN ($2, $6) AND lease_expires_at < $3`,
+			toNodeID, models.JobStatusScheduled, now, claimDeadline, executionID, models.JobStatusRunning,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrLeaseNotHeld
+		}
+
+		if err := refreshNodeStatus(q, fromNodeID); err != nil {
+			return err
+		}
+		return refreshNodeStatus(q, toNodeID)
+	})
+}
+
+// Node flag operations
+
+func (d *Database) CreateNodeFlag(flag *models.NodeFlag) error {
+	return insertFlag(d.db, flag)
+}
+
+// FlagNode records a flag and, if the flag calls for it, quarantines the node
+// as QuarantineNode does, in one transaction. It returns the IDs of the jobs
+// whose executions the quarantine failed. Errors are as for QuarantineNode.
+func (d *Database) FlagNode(flag *models.NodeFlag) ([]string, error) {
+	var jobIDs []string
+	err := d.transact(func(q querier) error {
+		if _, err := d.lockNode(q, flag.NodeID); err != nil {
+			return err
+		}
+		if err := insertFlag(q, flag); err != nil {
+			return err
+		}
+		if !flag.Quarantined {
+			return nil
+		}
+		var err error
+		jobIDs, err = d.quarantineNode(q, flag.NodeID, "Node quarantined")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobIDs, nil
+}
+
+func insertFlag(q querier, flag *models.NodeFlag) error {
+	relatedJSON, _ := json.Marshal(flag.RelatedNodes)
+	_, err := q.Exec(`
+		INSERT INTO node_flags (id, node_id, signal, explanation, related_nodes, quarantined, flagged_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		flag.ID, flag.NodeID, flag.Signal, flag.Explanation, relatedJSON, flag.Quarantined, flag.FlaggedAt,
+	)
+	return err
+}
+
+// GetNodeFlags returns every flag raised by collusion detection, newest first,
+// optionally only those of one node
+func (d *Database) GetNodeFlags(nodeID string) ([]*models.NodeFlag, error) {
+	rows, err := d.db.Query(`
+		SELECT id, node_id, signal, explanation, related_nodes, quarantined, flagged_at, cleared_at
+		FROM node_flags WHERE CAST($1 AS TEXT) = '' OR node_id = $1
+		ORDER BY flagged_at DESC`,
+		nodeID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []*models.NodeFlag
+	for rows.Next() {
+		var flag models.NodeFlag
+		var relatedJSON []byte
+		if err := rows.Scan(&flag.ID, &flag.NodeID, &flag.Signal, &flag.Explanation, &relatedJSON,
+			&flag.Quarantined, &flag.FlaggedAt, &flag.ClearedAt); err != nil {
+			continue
+		}
+		if relatedJSON != nil {
+			json.Unmarshal(relatedJSON, &flag.RelatedNodes)
+		}
+		flags = append(flags, &flag)
+	}
+
+	return flags, rows.Err()
+}
+
+// ClearNodeFlags marks a node's outstanding flags as reviewed and returns how
+// many there were
+func (d *Database) ClearNodeFlags(nodeID string) (int, error) {
+	res, err := d.db.Exec(`UPDATE node_flags SET cleared_at = $1 WHERE node_id = $2 AND cleared_at IS NULL`,
+		time.Now(), nodeID)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// Fair-share operations
+
+// GetSubmitterUsage returns the node-seconds each submitter's executions
+// consumed since the given time, from claim to completion. Executions still
+// running count up to now. Spot checks are the coordinator's own and left out.
+func (d *Database) GetSubmitterUsage(since time.Time) (map[string]float64, error) {
+	seconds := d.dialect.epoch("COALESCE(e.completed_at, $2)") + " - " +
+		d.dialect.epoch(d.dialect.greatest+"(e.claimed_at, $1)")
+	rows, err := d.db.Query(`
+		SELECT COALESCE(j.submitted_by, ''), SUM(`+seconds+`)
+		FROM job_executions e JOIN jobs j ON j.id = e.job_id
+		WHERE j.canary_id IS NULL AND e.claimed_at IS NOT NULL
+			AND (e.completed_at >= $1 OR (e.completed_at IS NULL AND e.status = $3))
+		GROUP BY COALESCE(j.submitted_by, '')`,
+		since, time.Now(), models.JobStatusRunning,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make(map[string]float64)
+	for rows.Next() {
+		var submitter string
+		var seconds float64
+		if err := rows.Scan(&submitter, &seconds); err != nil {
+			return nil, err
+		}
+		usage[submitter] = seconds
+	}
+
+	return usage, rows.Err()
+}
+
+// GetShareWeights returns the fair-share weights that have been configured
+func (d *Database) GetShareWeights() (map[string]float64, error) {
+	rows, err := d.db.Query(`SELECT submitted_by, weight FROM fair_shares`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	weights := make(map[string]float64)
+	for rows.Next() {
+		var submitter string
+		var weight float64
+		if err := rows.Scan(&submitter, &weight); err != nil {
+			return nil, err
+		}
+		weights[submitter] = weight
+	}
+
+	return weights, rows.Err()
+}
+
+func (d *Database) SetShareWeight(submitter string, weight float64) error {
+	_, err := d.db.Exec(`
+		INSERT INTO fair_shares (submitted_by, weight, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (submitted_by) DO UPDATE SET weight = EXCLUDED.weight, updated_at = EXCLUDED.updated_at`,
+		submitter, weight, time.Now(),
+	)
+	return err
+}
+
+// Canary operations
+
+// canaryColumns lists canary columns in the order scanCanary expects them
+const canaryColumns = `
+	id, name, COALESCE(description, ''), docker_image, command, environment, COALESCE(input_data, ''),
+	required_cpu, required_memory, timeout_seconds, COALESCE(output_file, ''), normalize,
+	expected_hash, enabled, created_at`
+
+func scanCanary(row rowScanner) (*models.Canary, error) {
+	var canary models.Canary
+	var commandJSON, envJSON, normalizeJSON []byte
+
+	err := row.Scan(
+		&canary.ID, &canary.Name, &canary.Description, &canary.DockerImage, &commandJSON, &envJSON,
+		&canary.InputData, &canary.RequiredCPU, &canary.RequiredMemory, &canary.TimeoutSeconds,
+		&canary.OutputFile, &normalizeJSON, &canary.ExpectedHash, &canary.Enabled, &canary.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal(commandJSON, &canary.Command)
+	json.Unmarshal(envJSON, &canary.Environment)
+	if normalizeJSON != nil {
+		json.Unmarshal(normalizeJSON, &canary.Normalize)
+	}
+
+	return &canary, nil
+}
+
+func (d *Database) queryCanaries(query string, args ...interface{}) ([]*models.Canary, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var canaries []*models.Canary
+	for rows.Next() {
+		canary, err := scanCanary(rows)
 		if err != nil {
 			continue
 		}
-		executions = append(executions, &exec)
+		canaries = append(canaries, canary)
 	}
 
-	return executions, nil
+	return canaries, nil
+}
+
+func (d *Database) CreateCanary(canary *models.Canary) error {
+	commandJSON, _ := json.Marshal(canary.Command)
+	envJSON, _ := json.Marshal(canary.Environment)
+	normalizeJSON, _ := json.Marshal(canary.Normalize)
+
+	_, err := d.db.Exec(`
+		INSERT INTO canaries (id, name, description, docker_image, command, environment, input_data,
+			required_cpu, required_memory, timeout_seconds, output_file, normalize, expected_hash,
+			enabled, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		canary.ID, canary.Name, canary.Description, canary.DockerImage, commandJSON, envJSON,
+		canary.InputData, canary.RequiredCPU, canary.RequiredMemory, canary.TimeoutSeconds,
+		canary.OutputFile, normalizeJSON, canary.ExpectedHash, canary.Enabled, canary.CreatedAt,
+	)
+	return err
+}
+
+func (d *Database) GetCanary(id string) (*models.Canary, error) {
+	return scanCanary(d.db.QueryRow(`SELECT `+canaryColumns+` FROM canaries WHERE id = $1`, id))
+}
+
+func (d *Database) GetAllCanaries() ([]*models.Canary, error) {
+	return d.queryCanaries(`SELECT ` + canaryColumns + ` FROM canaries ORDER BY created_at DESC`)
+}
+
+// GetEnabledCanaries returns the catalog entries the scheduler may inject
+func (d *Database) GetEnabledCanaries() ([]*models.Canary, error) {
+	return d.queryCanaries(`SELECT ` + canaryColumns + ` FROM canaries WHERE enabled = TRUE`)
+}
+
+// DisableCanary takes a catalog entry out of rotation. Entries are kept, since
+// past spot-check jobs refer to them. Returns sql.ErrNoRows if it doesn't exist.
+func (d *Database) DisableCanary(id string) error {
+	res, err := d.db.Exec(`UPDATE canaries SET enabled = FALSE WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (d *Database) Close() error {
 	return d.db.Close()
 }
+
+// statusList returns placeholders numbered from first for the given statuses,
+// and the statuses as arguments to go with them
+func statusList(first int, statuses []models.JobStatus) (string, []interface{}) {
+	args := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		args[i] = status
+	}
+	return placeholders(first, len(statuses)), args
+}
+
+// placeholders returns n comma-separated parameters numbered from first
+func placeholders(first, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", first+i)
+	}
+	return strings.Join(params, ", ")
+}
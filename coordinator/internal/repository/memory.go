@@ -0,0 +1,1344 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+// MemoryStore keeps the coordinator's state in memory, for unit tests and
+// throwaway demos. It behaves like Database, down to which updates are no-ops,
+// but nothing survives a restart. Records are copied on the way in and out,
+// so callers can't change stored state behind its back.
+type MemoryStore struct {
+	mu         sync.Mutex
+	jobs       map[string]*models.Job
+	nodes      map[string]*models.Node
+	executions []*models.JobExecution // In creation order
+	flags      []*models.NodeFlag
+	shares     map[string]float64
+	canaries   map[string]*models.Canary
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:     make(map[string]*models.Job),
+		nodes:    make(map[string]*models.Node),
+		shares:   make(map[string]float64),
+		canaries: make(map[string]*models.Canary),
+	}
+}
+
+// copyJob copies job down to its slices, maps and pointers
+func copyJob(job *models.Job) *models.Job {
+	c := *job
+	c.Command = slices.Clone(job.Command)
+	c.Environment = maps.Clone(job.Environment)
+	c.Deadline = copyTime(job.Deadline)
+	c.Normalize = slices.Clone(job.Normalize)
+	c.Spread.Domains = slices.Clone(job.Spread.Domains)
+	c.NodeSelector = maps.Clone(job.NodeSelector)
+	c.Affinity.Required = copyExpressions(job.Affinity.Required)
+	c.Affinity.Preferred = slices.Clone(job.Affinity.Preferred)
+	for i := range c.Affinity.Preferred {
+		c.Affinity.Preferred[i].Expression.Values = slices.Clone(c.Affinity.Preferred[i].Expression.Values)
+	}
+	c.Tolerations = slices.Clone(job.Tolerations)
+	c.StartedAt = copyTime(job.StartedAt)
+	c.CompletedAt = copyTime(job.CompletedAt)
+	c.Verification = copyVerification(job.Verification)
+	return &c
+}
+
+func copyExpressions(expressions []models.LabelExpression) []models.LabelExpression {
+	c := slices.Clone(expressions)
+	for i := range c {
+		c[i].Values = slices.Clone(c[i].Values)
+	}
+	return c
+}
+
+func copyVerification(result *models.VerificationResult) *models.VerificationResult {
+	if result == nil {
+		return nil
+	}
+	c := *result
+	c.ResultCounts = maps.Clone(result.ResultCounts)
+	c.AgreementNodes = slices.Clone(result.AgreementNodes)
+	c.DisagreementNodes = slices.Clone(result.DisagreementNodes)
+	c.NodeWeights = maps.Clone(result.NodeWeights)
+	c.ResultWeights = maps.Clone(result.ResultWeights)
+	return &c
+}
+
+func copyExecution(exec *models.JobExecution) *models.JobExecution {
+	c := *exec
+	c.CompletedAt = copyTime(exec.CompletedAt)
+	c.ClaimedAt = copyTime(exec.ClaimedAt)
+	c.LeaseExpiresAt = copyTime(exec.LeaseExpiresAt)
+	c.RunStartedAt = copyTime(exec.RunStartedAt)
+	return &c
+}
+
+func copyNode(node *models.Node) *models.Node {
+	c := *node
+	c.Labels = maps.Clone(node.Labels)
+	c.Taints = slices.Clone(node.Taints)
+	c.MaintenanceStart = copyTime(node.MaintenanceStart)
+	c.MaintenanceEnd = copyTime(node.MaintenanceEnd)
+	return &c
+}
+
+func copyFlag(flag *models.NodeFlag) *models.NodeFlag {
+	c := *flag
+	c.RelatedNodes = slices.Clone(flag.RelatedNodes)
+	c.ClearedAt = copyTime(flag.ClearedAt)
+	return &c
+}
+
+func copyCanary(canary *models.Canary) *models.Canary {
+	c := *canary
+	c.Command = slices.Clone(canary.Command)
+	c.Environment = maps.Clone(canary.Environment)
+	c.Normalize = slices.Clone(canary.Normalize)
+	return &c
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	return timePtr(*t)
+}
+
+// Job operations
+
+func (m *MemoryStore) CreateJob(job *models.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := copyJob(job)
+	stored.TieBreakers = 0
+	stored.Verification = nil
+	stored.StartedAt = nil
+	stored.CompletedAt = nil
+	stored.Result = ""
+	stored.ErrorMessage = ""
+	m.jobs[job.ID] = stored
+	return nil
+}
+
+func (m *MemoryStore) GetJob(id string) (*models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyJob(job), nil
+}
+
+func (m *MemoryStore) GetJobs(ids []string) ([]*models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var jobs []*models.Job
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if job, ok := m.jobs[id]; ok && !seen[id] {
+			seen[id] = true
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	return jobs, nil
+}
+
+// findJobs returns copies of the jobs match accepts, in the order less gives
+func (m *MemoryStore) findJobs(match func(*models.Job) bool, less func(a, b *models.Job) bool) []*models.Job {
+	var jobs []*models.Job
+	for _, job := range m.jobs {
+		if match(job) {
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return less(jobs[i], jobs[j]) })
+	return jobs
+}
+
+func (m *MemoryStore) GetPendingJobs() ([]*models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findJobs(
+		func(job *models.Job) bool { return job.Status == models.JobStatusPending },
+		func(a, b *models.Job) bool {
+			if a.Priority != b.Priority {
+				return a.Priority > b.Priority
+			}
+			if (a.Deadline == nil) != (b.Deadline == nil) {
+				return a.Deadline != nil
+			}
+			if a.Deadline != nil && !a.Deadline.Equal(*b.Deadline) {
+				return a.Deadline.Before(*b.Deadline)
+			}
+			return a.SubmittedAt.Before(b.SubmittedAt)
+		},
+	), nil
+}
+
+func (m *MemoryStore) GetActiveJobs() ([]*models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findJobs(
+		func(job *models.Job) bool {
+			switch job.Status {
+			case models.JobStatusScheduled, models.JobStatusRunning, models.JobStatusVerifying:
+				return true
+			}
+			return false
+		},
+		func(a, b *models.Job) bool { return a.SubmittedAt.Before(b.SubmittedAt) },
+	), nil
+}
+
+func (m *MemoryStore) GetAllJobs() ([]*models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := m.findJobs(
+		func(job *models.Job) bool { return job.CanaryID == "" },
+		func(a, b *models.Job) bool { return a.SubmittedAt.After(b.SubmittedAt) },
+	)
+	if len(jobs) > 100 {
+		jobs = jobs[:100]
+	}
+	return jobs, nil
+}
+
+func (m *MemoryStore) UpdateJobStatus(id string, status models.JobStatus, result, errorMsg string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := models.CheckJobTransition(job.Status, status); err != nil {
+		return err
+	}
+	job.Status = status
+	if status.IsFinished() {
+		job.Result = result
+		job.ErrorMessage = errorMsg
+		job.CompletedAt = timePtr(time.Now())
+	}
+	return nil
+}
+
+func (m *MemoryStore) ScheduleJob(jobID string, executions []*models.JobExecution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[jobID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := models.CheckJobTransition(job.Status, models.JobStatusScheduled); err != nil {
+		return err
+	}
+	admitted, full := m.admit(job, executions)
+	if full != "" {
+		return fmt.Errorf("%w: node %s", ErrNoCapacity, full)
+	}
+
+	for _, exec := range admitted {
+		m.addExecution(exec)
+	}
+	job.Status = models.JobStatusScheduled
+	job.Redundancy = len(executions)
+	return nil
+}
+
+func (m *MemoryStore) AddJobExecutions(jobID string, executions []*models.JobExecution) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[jobID]
+	if !ok || job.Status == models.JobStatusPending || job.Status.IsFinished() {
+		return 0, sql.ErrNoRows
+	}
+
+	counted := 0
+	for _, exec := range m.executions {
+		if exec.JobID == jobID && !exec.ErrorClass.IsLost() {
+			counted++
+		}
+	}
+	if short := job.Redundancy - counted; len(executions) > short {
+		executions = executions[:max(short, 0)]
+	}
+
+	admitted, _ := m.admit(job, executions)
+	for _, exec := range admitted {
+		m.addExecution(exec)
+	}
+	return len(admitted), nil
+}
+
+// admit returns the executions whose node has room for one more execution of
+// job, counting those admitted before it, and the first node that doesn't
+func (m *MemoryStore) admit(job *models.Job, executions []*models.JobExecution) ([]*models.JobExecution, string) {
+	loaded := make(map[string]*models.Node)
+	var admitted []*models.JobExecution
+	full := ""
+	for _, exec := range executions {
+		node, ok := loaded[exec.NodeID]
+		if !ok {
+			if stored, ok := m.nodes[exec.NodeID]; ok {
+				node = m.withLoad(stored)
+			}
+			loaded[exec.NodeID] = node
+		}
+		if node == nil || !hasRoom(node, job.RequiredCPU, job.RequiredMemory, job.RequiredGPU) {
+			if full == "" {
+				full = exec.NodeID
+			}
+			continue
+		}
+		node.ActiveExecutions++
+		node.UsedCPU += job.RequiredCPU
+		node.UsedMemory += job.RequiredMemory
+		admitted = append(admitted, exec)
+	}
+	return admitted, full
+}
+
+// addExecution stores a new scheduled execution and refreshes its node's status
+func (m *MemoryStore) addExecution(execution *models.JobExecution) {
+	m.executions = append(m.executions, &models.JobExecution{
+		ID:             execution.ID,
+		JobID:          execution.JobID,
+		NodeID:         execution.NodeID,
+		Status:         models.JobStatusScheduled,
+		StartedAt:      execution.StartedAt,
+		LeaseExpiresAt: copyTime(execution.LeaseExpiresAt),
+	})
+	if node, ok := m.nodes[execution.NodeID]; ok {
+		m.refreshNodeStatus(node)
+	}
+}
+
+func (m *MemoryStore) FinalizeJob(id string, outcome *models.JobOutcome) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := models.CheckJobTransition(job.Status, outcome.Status); err != nil {
+		return err
+	}
+	now := time.Now()
+	job.Status = outcome.Status
+	job.Result = outcome.Result
+	job.ErrorMessage = outcome.ErrorMessage
+	job.CompletedAt = timePtr(now)
+	job.Verification = nil
+	if outcome.Verification != nil {
+		job.Verification = copyVerification(outcome.Verification)
+	}
+
+	for _, reward := range outcome.Rewards {
+		node, ok := m.nodes[reward.NodeID]
+		if !ok {
+			continue
+		}
+		node.ReputationScore = math.Max(node.ReputationScore+reward.Reputation, 0)
+		node.TotalJobsRun++
+		if reward.Success {
+			node.SuccessfulJobs++
+		} else {
+			node.FailedJobs++
+		}
+		node.CreditsEarned += reward.Credits
+	}
+	m.stopExecutions(id, models.JobStatusCancelled, "", now)
+	return nil
+}
+
+func (m *MemoryStore) AddTieBreakers(id string, count int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := m.activeJob(id)
+	if job == nil {
+		return sql.ErrNoRows
+	}
+	job.Redundancy += count
+	job.TieBreakers += count
+	return nil
+}
+
+func (m *MemoryStore) SetJobRedundancy(id string, redundancy int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := m.activeJob(id)
+	if job == nil {
+		return sql.ErrNoRows
+	}
+	job.Redundancy = redundancy
+	return nil
+}
+
+// activeJob returns the stored job if it is scheduled or running
+func (m *MemoryStore) activeJob(id string) *models.Job {
+	job, ok := m.jobs[id]
+	if !ok || job.Status == models.JobStatusPending || job.Status.IsFinished() {
+		return nil
+	}
+	return job
+}
+
+func (m *MemoryStore) CancelJob(id string) ([]string, error) {
+	return m.stopJob(id, models.JobStatusCancelled, "Cancelled by user", models.JobStatusCancelled, "")
+}
+
+func (m *MemoryStore) TimeOutJob(id, errorMsg string) ([]string, error) {
+	return m.stopJob(id, models.JobStatusTimedOut, errorMsg, models.JobStatusFailed, models.ErrorClassTimedOut)
+}
+
+func (m *MemoryStore) FailJob(id, errorMsg string) ([]string, error) {
+	return m.stopJob(id, models.JobStatusFailed, errorMsg, models.JobStatusCancelled, "")
+}
+
+func (m *MemoryStore) stopJob(id string, status models.JobStatus, errorMsg string,
+	execStatus models.JobStatus, execClass models.ErrorClass) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if err := models.CheckJobTransition(job.Status, status); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	job.Status = status
+	job.ErrorMessage = errorMsg
+	job.CompletedAt = timePtr(now)
+
+	return m.stopExecutions(id, execStatus, execClass, now), nil
+}
+
+// stopExecutions moves a job's outstanding executions to a final status and
+// refreshes the status of their nodes, which it returns
+func (m *MemoryStore) stopExecutions(jobID string, status models.JobStatus, class models.ErrorClass, now time.Time) []string {
+	var nodeIDs []string
+	for _, exec := range m.executions {
+		if exec.JobID == jobID && isOutstanding(exec) {
+			exec.Status = status
+			exec.CompletedAt = timePtr(now)
+			exec.ErrorClass = class
+			exec.LeaseExpiresAt = nil
+			nodeIDs = append(nodeIDs, exec.NodeID)
+		}
+	}
+	for _, nodeID := range nodeIDs {
+		if node, ok := m.nodes[nodeID]; ok {
+			m.refreshNodeStatus(node)
+		}
+	}
+	return nodeIDs
+}
+
+// Node operations
+
+func (m *MemoryStore) RegisterNode(node *models.Node) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.nodes[node.ID]
+	if !ok {
+		stored := copyNode(node)
+		stored.TotalJobsRun, stored.SuccessfulJobs, stored.FailedJobs, stored.CreditsEarned = 0, 0, 0, 0
+		stored.CurrentJobID = ""
+		stored.Cordoned, stored.Draining = false, false
+		stored.MaintenanceStart, stored.MaintenanceEnd = nil, nil
+		stored.ActiveExecutions, stored.UsedCPU, stored.UsedMemory = 0, 0, 0
+		m.nodes[node.ID] = stored
+		return nil
+	}
+
+	existing.Name = node.Name
+	existing.Region = node.Region
+	existing.Owner = node.Owner
+	existing.Host = node.Host
+	existing.Price = node.Price
+	existing.Labels = maps.Clone(node.Labels)
+	existing.Taints = slices.Clone(node.Taints)
+	existing.CPUCores = node.CPUCores
+	existing.MemoryGB = node.MemoryGB
+	existing.GPUEnabled = node.GPUEnabled
+	existing.GPUModel = node.GPUModel
+	if existing.Status != models.NodeStatusFaulty {
+		existing.Status = node.Status
+	}
+	existing.LastHeartbeat = node.LastHeartbeat
+	existing.MaxSlots = node.MaxSlots
+	existing.Draining = false
+	return nil
+}
+
+// withLoad returns a copy of node with the resources its outstanding
+// executions hold
+func (m *MemoryStore) withLoad(node *models.Node) *models.Node {
+	c := copyNode(node)
+	c.ActiveExecutions, c.UsedCPU, c.UsedMemory = 0, 0, 0
+	for _, exec := range m.executions {
+		if exec.NodeID != node.ID || !isOutstanding(exec) {
+			continue
+		}
+		job, ok := m.jobs[exec.JobID]
+		if !ok {
+			continue
+		}
+		c.ActiveExecutions++
+		c.UsedCPU += job.RequiredCPU
+		c.UsedMemory += job.RequiredMemory
+	}
+	return c
+}
+
+// findNodes returns loaded copies of the nodes match accepts, in the order
+// less gives
+func (m *MemoryStore) findNodes(match func(*models.Node) bool, less func(a, b *models.Node) bool) []*models.Node {
+	var nodes []*models.Node
+	for _, node := range m.nodes {
+		loaded := m.withLoad(node)
+		if match(loaded) {
+			nodes = append(nodes, loaded)
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return less(nodes[i], nodes[j]) })
+	return nodes
+}
+
+func (m *MemoryStore) GetNode(id string) (*models.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m.withLoad(node), nil
+}
+
+func (m *MemoryStore) GetAllNodes() ([]*models.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findNodes(
+		func(*models.Node) bool { return true },
+		func(a, b *models.Node) bool { return a.RegisteredAt.After(b.RegisteredAt) },
+	), nil
+}
+
+func isLive(node *models.Node) bool {
+	return (node.Status == models.NodeStatusOnline || node.Status == models.NodeStatusBusy) &&
+		!node.Cordoned && !node.Draining
+}
+
+func fitsGPU(node *models.Node, requiredGPU bool) bool {
+	return !requiredGPU || node.GPUEnabled
+}
+
+// hasRoom reports whether a loaded node is live, in rotation and has a free
+// slot and enough spare CPU/memory for one more execution with the given
+// requirements
+func hasRoom(node *models.Node, requiredCPU, requiredMemory int, requiredGPU bool) bool {
+	return isLive(node) && node.ActiveExecutions < node.MaxSlots &&
+		node.CPUCores-node.UsedCPU >= requiredCPU &&
+		node.MemoryGB-node.UsedMemory >= requiredMemory &&
+		fitsGPU(node, requiredGPU)
+}
+
+func (m *MemoryStore) GetAvailableNodes(requiredCPU, requiredMemory int, requiredGPU bool) ([]*models.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findNodes(
+		func(node *models.Node) bool {
+			return hasRoom(node, requiredCPU, requiredMemory, requiredGPU)
+		},
+		func(a, b *models.Node) bool {
+			if a.ReputationScore != b.ReputationScore {
+				return a.ReputationScore > b.ReputationScore
+			}
+			if a.ActiveExecutions != b.ActiveExecutions {
+				return a.ActiveExecutions < b.ActiveExecutions
+			}
+			return a.TotalJobsRun < b.TotalJobsRun
+		},
+	), nil
+}
+
+func (m *MemoryStore) GetLiveNodes(requiredCPU, requiredMemory int, requiredGPU bool) ([]*models.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findNodes(
+		func(node *models.Node) bool {
+			return isLive(node) && node.CPUCores >= requiredCPU && node.MemoryGB >= requiredMemory &&
+				fitsGPU(node, requiredGPU)
+		},
+		func(a, b *models.Node) bool { return a.ReputationScore > b.ReputationScore },
+	), nil
+}
+
+func (m *MemoryStore) GetEligibleNodes(requiredCPU, requiredMemory int, requiredGPU bool) ([]*models.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findNodes(
+		func(node *models.Node) bool {
+			return node.Status != models.NodeStatusFaulty &&
+				node.CPUCores >= requiredCPU && node.MemoryGB >= requiredMemory &&
+				fitsGPU(node, requiredGPU)
+		},
+		func(a, b *models.Node) bool { return a.RegisteredAt.Before(b.RegisteredAt) },
+	), nil
+}
+
+func (m *MemoryStore) UpdateNodeHeartbeat(nodeID string, heartbeat *models.Heartbeat) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[nodeID]
+	if !ok {
+		return nil
+	}
+	node.LastHeartbeat = heartbeat.Timestamp
+	if node.Status == models.NodeStatusOffline && !node.Cordoned && !node.Draining {
+		node.Status = models.NodeStatusOnline
+	}
+	if heartbeat.TotalSlots > 0 {
+		node.MaxSlots = heartbeat.TotalSlots
+	}
+	m.refreshNodeStatus(node)
+	return nil
+}
+
+func (m *MemoryStore) UpdateNodeStatus(nodeID string, status models.NodeStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if node, ok := m.nodes[nodeID]; ok {
+		node.Status = status
+	}
+	return nil
+}
+
+func (m *MemoryStore) RefreshNodeStatus(nodeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if node, ok := m.nodes[nodeID]; ok {
+		m.refreshNodeStatus(node)
+	}
+	return nil
+}
+
+func (m *MemoryStore) refreshNodeStatus(node *models.Node) {
+	if node.Status != models.NodeStatusOnline && node.Status != models.NodeStatusBusy {
+		return
+	}
+	if m.withLoad(node).ActiveExecutions >= node.MaxSlots {
+		node.Status = models.NodeStatusBusy
+	} else {
+		node.Status = models.NodeStatusOnline
+	}
+}
+
+func (m *MemoryStore) UpdateNodeReputation(nodeID string, delta float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if node, ok := m.nodes[nodeID]; ok {
+		node.ReputationScore += delta
+		if node.ReputationScore < 0 {
+			node.ReputationScore = 0
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetNodeCordoned(nodeID string, cordoned bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[nodeID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	node.Cordoned = cordoned
+	node.Draining = node.Draining && cordoned
+	return nil
+}
+
+func (m *MemoryStore) DrainNode(nodeID string, cordon bool) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[nodeID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	node.Draining = true
+	node.Cordoned = node.Cordoned || cordon
+
+	var jobIDs []string
+	now := time.Now()
+	for _, exec := range m.executions {
+		if exec.NodeID == nodeID && exec.Status == models.JobStatusScheduled {
+			exec.Status = models.JobStatusFailed
+			exec.CompletedAt = timePtr(now)
+			exec.ErrorClass = models.ErrorClassNodeLost
+			exec.ErrorMessage = "Node draining"
+			exec.LeaseExpiresAt = nil
+			jobIDs = append(jobIDs, exec.JobID)
+		}
+	}
+	m.refreshNodeStatus(node)
+	return jobIDs, nil
+}
+
+func (m *MemoryStore) FinishDrains() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var nodeIDs []string
+	for _, node := range m.nodes {
+		if !node.Draining || (node.Status != models.NodeStatusOnline && node.Status != models.NodeStatusBusy) {
+			continue
+		}
+		if m.withLoad(node).ActiveExecutions > 0 {
+			continue
+		}
+		node.Status = models.NodeStatusOffline
+		nodeIDs = append(nodeIDs, node.ID)
+	}
+	sort.Strings(nodeIDs)
+	return nodeIDs, nil
+}
+
+func (m *MemoryStore) SetNodeMaintenance(nodeID string, start, end *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[nodeID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	node.MaintenanceStart, node.MaintenanceEnd = nil, nil
+	if start != nil {
+		node.MaintenanceStart = timePtr(*start)
+	}
+	if end != nil {
+		node.MaintenanceEnd = timePtr(*end)
+	}
+	return nil
+}
+
+func (m *MemoryStore) ReinstateNode(nodeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[nodeID]
+	if !ok || node.Status != models.NodeStatusFaulty {
+		return sql.ErrNoRows
+	}
+	node.Status = models.NodeStatusOffline
+	return nil
+}
+
+func (m *MemoryStore) TakeNodeOffline(nodeID string, staleBefore time.Time, penalty float64, errorMsg string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[nodeID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	live := node.Status == models.NodeStatusOnline || node.Status == models.NodeStatusBusy
+	if !live || !node.LastHeartbeat.Before(staleBefore) {
+		return nil, sql.ErrNoRows
+	}
+	node.Status = models.NodeStatusOffline
+	node.ReputationScore = math.Max(node.ReputationScore-penalty, 0)
+	return m.failNodeExecutions(nodeID, models.ErrorClassNodeLost, errorMsg)
+}
+
+func (m *MemoryStore) QuarantineNode(nodeID, reason string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.quarantineNode(nodeID, reason)
+}
+
+// quarantineNode is QuarantineNode with the lock held
+func (m *MemoryStore) quarantineNode(nodeID, reason string) ([]string, error) {
+	node, ok := m.nodes[nodeID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	node.Status = models.NodeStatusFaulty
+	return m.failNodeExecutions(nodeID, models.ErrorClassNodeLost, reason)
+}
+
+// Execution operations
+
+func isOutstanding(exec *models.JobExecution) bool {
+	return exec.Status == models.JobStatusScheduled || exec.Status == models.JobStatusRunning
+}
+
+func (m *MemoryStore) execution(id string) *models.JobExecution {
+	for _, exec := range m.executions {
+		if exec.ID == id {
+			return exec
+		}
+	}
+	return nil
+}
+
+// findExecutions returns copies of the executions match accepts, in creation
+// order
+func (m *MemoryStore) findExecutions(match func(*models.JobExecution) bool) []*models.JobExecution {
+	var executions []*models.JobExecution
+	for _, exec := range m.executions {
+		if match(exec) {
+			executions = append(executions, copyExecution(exec))
+		}
+	}
+	return executions
+}
+
+func (m *MemoryStore) GetJobExecution(id string) (*models.JobExecution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exec := m.execution(id)
+	if exec == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyExecution(exec), nil
+}
+
+func (m *MemoryStore) GetJobExecutions(jobID string) ([]*models.JobExecution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findExecutions(func(exec *models.JobExecution) bool { return exec.JobID == jobID }), nil
+}
+
+func (m *MemoryStore) GetScheduledExecutions(nodeID string) ([]*models.PendingExecution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []*models.PendingExecution
+	for _, exec := range m.executions {
+		job, ok := m.jobs[exec.JobID]
+		if !ok || exec.NodeID != nodeID || exec.Status != models.JobStatusScheduled {
+			continue
+		}
+		pending = append(pending, &models.PendingExecution{Execution: copyExecution(exec), Job: copyJob(job)})
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		if a, b := pending[i].Job.Priority, pending[j].Job.Priority; a != b {
+			return a > b
+		}
+		return pending[i].Execution.StartedAt.Before(pending[j].Execution.StartedAt)
+	})
+	return pending, nil
+}
+
+// setOutcome copies what UpdateJobExecution and FinishJobExecution write
+func setOutcome(exec, from *models.JobExecution) {
+	exec.Status = from.Status
+	exec.CompletedAt = from.CompletedAt
+	exec.Result = from.Result
+	exec.ResultHash = from.ResultHash
+	exec.ErrorMessage = from.ErrorMessage
+	exec.Stdout = from.Stdout
+	exec.Stderr = from.Stderr
+	exec.ErrorClass = from.ErrorClass
+}
+
+func (m *MemoryStore) UpdateJobExecution(execution *models.JobExecution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exec := m.execution(execution.ID)
+	if exec == nil {
+		return sql.ErrNoRows
+	}
+	if err := models.CheckExecutionTransition(exec.Status, execution.Status); err != nil {
+		return err
+	}
+	setOutcome(exec, execution)
+	exec.LeaseExpiresAt = copyTime(execution.LeaseExpiresAt)
+	if node, ok := m.nodes[exec.NodeID]; ok {
+		m.refreshNodeStatus(node)
+	}
+	return nil
+}
+
+func (m *MemoryStore) FinishJobExecution(execution *models.JobExecution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := checkFinish(execution); err != nil {
+		return err
+	}
+	exec := m.execution(execution.ID)
+	if exec == nil || exec.NodeID != execution.NodeID || exec.Status != models.JobStatusRunning {
+		return ErrLeaseNotHeld
+	}
+	setOutcome(exec, execution)
+	exec.LeaseExpiresAt = nil
+	if node, ok := m.nodes[exec.NodeID]; ok {
+		m.refreshNodeStatus(node)
+	}
+	return nil
+}
+
+func (m *MemoryStore) ClaimJobExecution(executionID, nodeID string, lease time.Duration) (*models.JobExecution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exec := m.execution(executionID)
+	if exec == nil || exec.NodeID != nodeID || exec.Status != models.JobStatusScheduled {
+		return nil, ErrLeaseNotHeld
+	}
+	job, ok := m.jobs[exec.JobID]
+	if ok && job.Status.IsFinished() {
+		return nil, ErrLeaseNotHeld
+	}
+	now := time.Now()
+	exec.Status = models.JobStatusRunning
+	exec.ClaimedAt = timePtr(now)
+	exec.LeaseExpiresAt = timePtr(now.Add(lease))
+	if ok && job.Status == models.JobStatusScheduled {
+		job.Status = models.JobStatusRunning
+		if job.StartedAt == nil {
+			job.StartedAt = timePtr(now)
+		}
+	}
+	return copyExecution(exec), nil
+}
+
+func (m *MemoryStore) RenewJobExecutionLease(executionID, nodeID string, lease time.Duration) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exec := m.execution(executionID)
+	if exec == nil || exec.NodeID != nodeID || exec.Status != models.JobStatusRunning {
+		return time.Time{}, ErrLeaseNotHeld
+	}
+	expiresAt := time.Now().Add(lease)
+	exec.LeaseExpiresAt = timePtr(expiresAt)
+	return expiresAt, nil
+}
+
+func (m *MemoryStore) StartJobExecution(executionID, nodeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exec := m.execution(executionID)
+	if exec == nil || exec.NodeID != nodeID || exec.Status != models.JobStatusRunning {
+		return ErrLeaseNotHeld
+	}
+	if exec.RunStartedAt == nil {
+		exec.RunStartedAt = timePtr(time.Now())
+	}
+	return nil
+}
+
+func (m *MemoryStore) ReassignJobExecution(executionID, toNodeID string, claimDeadline time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	exec := m.execution(executionID)
+	if exec == nil || !isOutstanding(exec) || exec.LeaseExpiresAt == nil || !exec.LeaseExpiresAt.Before(now) {
+		return ErrLeaseNotHeld
+	}
+	job := m.jobs[exec.JobID]
+	if job == nil || job.Status.IsFinished() {
+		return ErrLeaseNotHeld
+	}
+	from := exec.NodeID
+	if toNodeID != from {
+		node, ok := m.nodes[toNodeID]
+		if !ok || !hasRoom(m.withLoad(node), job.RequiredCPU, job.RequiredMemory, job.RequiredGPU) {
+			return ErrNoCapacity
+		}
+	}
+	exec.NodeID = toNodeID
+	exec.Status = models.JobStatusScheduled
+	exec.StartedAt = now
+	exec.ClaimedAt = nil
+	exec.RunStartedAt = nil
+	exec.LeaseExpiresAt = timePtr(claimDeadline)
+	for _, nodeID := range []string{from, toNodeID} {
+		if node, ok := m.nodes[nodeID]; ok {
+			m.refreshNodeStatus(node)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) PreemptJobExecution(executionID, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exec := m.execution(executionID)
+	if exec == nil || !isOutstanding(exec) {
+		return sql.ErrNoRows
+	}
+	if job, ok := m.jobs[exec.JobID]; ok && job.Status.IsFinished() {
+		return sql.ErrNoRows
+	}
+	exec.Status = models.JobStatusFailed
+	exec.CompletedAt = timePtr(time.Now())
+	exec.ErrorClass = models.ErrorClassPreempted
+	exec.ErrorMessage = reason
+	exec.LeaseExpiresAt = nil
+	if node, ok := m.nodes[exec.NodeID]; ok {
+		m.refreshNodeStatus(node)
+	}
+	return nil
+}
+
+func (m *MemoryStore) FailNodeExecutions(nodeID string, class models.ErrorClass, errorMsg string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.failNodeExecutions(nodeID, class, errorMsg)
+}
+
+// failNodeExecutions is FailNodeExecutions with the lock held
+func (m *MemoryStore) failNodeExecutions(nodeID string, class models.ErrorClass, errorMsg string) ([]string, error) {
+	node, ok := m.nodes[nodeID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	now := time.Now()
+	seen := make(map[string]bool)
+	var jobIDs []string
+	for _, exec := range m.executions {
+		if exec.NodeID != nodeID || !isOutstanding(exec) {
+			continue
+		}
+		exec.Status = models.JobStatusFailed
+		exec.CompletedAt = timePtr(now)
+		exec.ErrorClass = class
+		exec.ErrorMessage = errorMsg
+		exec.LeaseExpiresAt = nil
+		if !seen[exec.JobID] {
+			seen[exec.JobID] = true
+			jobIDs = append(jobIDs, exec.JobID)
+		}
+	}
+	m.refreshNodeStatus(node)
+	sort.Strings(jobIDs)
+	return jobIDs, nil
+}
+
+func (m *MemoryStore) GetRevokedExecutions(nodeID string, executionIDs []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var revoked []string
+	for _, id := range executionIDs {
+		exec := m.execution(id)
+		if exec == nil || exec.NodeID != nodeID || exec.Status != models.JobStatusRunning {
+			revoked = append(revoked, id)
+		}
+	}
+	return revoked, nil
+}
+
+func (m *MemoryStore) GetPreemptibleExecutions(belowPriority int) ([]*models.JobExecution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findExecutions(func(exec *models.JobExecution) bool {
+		job, ok := m.jobs[exec.JobID]
+		if !ok || !isOutstanding(exec) || job.Priority >= belowPriority || job.NonPreemptible {
+			return false
+		}
+		switch job.Status {
+		case models.JobStatusScheduled, models.JobStatusRunning, models.JobStatusVerifying:
+			return true
+		}
+		return false
+	}), nil
+}
+
+func (m *MemoryStore) GetDisputedExecutions(since time.Time) ([]*models.JobExecution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recent := func(exec *models.JobExecution) bool {
+		return exec.Status == models.JobStatusCompleted && exec.CompletedAt != nil && !exec.CompletedAt.Before(since)
+	}
+	hashes := make(map[string]map[string]bool)
+	for _, exec := range m.executions {
+		if recent(exec) && exec.ResultHash != "" {
+			if hashes[exec.JobID] == nil {
+				hashes[exec.JobID] = make(map[string]bool)
+			}
+			hashes[exec.JobID][exec.ResultHash] = true
+		}
+	}
+
+	executions := m.findExecutions(func(exec *models.JobExecution) bool {
+		return recent(exec) && len(hashes[exec.JobID]) > 1
+	})
+	sort.SliceStable(executions, func(i, j int) bool {
+		if executions[i].JobID != executions[j].JobID {
+			return executions[i].JobID < executions[j].JobID
+		}
+		return executions[i].CompletedAt.Before(*executions[j].CompletedAt)
+	})
+	return executions, nil
+}
+
+func (m *MemoryStore) GetExpiredExecutions() ([]*models.JobExecution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	return m.findExecutions(func(exec *models.JobExecution) bool {
+		return isOutstanding(exec) && exec.LeaseExpiresAt != nil && exec.LeaseExpiresAt.Before(now)
+	}), nil
+}
+
+func (m *MemoryStore) TimeOutOverrunExecutions(grace, pullAllowance time.Duration) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var nodeIDs []string
+	for _, exec := range m.executions {
+		job, ok := m.jobs[exec.JobID]
+		if !ok || exec.Status != models.JobStatusRunning || job.TimeoutSeconds <= 0 || exec.ClaimedAt == nil {
+			continue
+		}
+		started := exec.ClaimedAt.Add(pullAllowance.Truncate(time.Second))
+		if exec.RunStartedAt != nil {
+			started = *exec.RunStartedAt
+		}
+		limit := time.Duration(job.TimeoutSeconds)*time.Second + grace.Truncate(time.Second)
+		if !started.Add(limit).Before(now) {
+			continue
+		}
+		exec.Status = models.JobStatusFailed
+		exec.CompletedAt = timePtr(now)
+		exec.ErrorClass = models.ErrorClassTimedOut
+		exec.ErrorMessage = "Execution exceeded the job timeout"
+		exec.LeaseExpiresAt = nil
+		if node, ok := m.nodes[exec.NodeID]; ok {
+			m.refreshNodeStatus(node)
+		}
+		nodeIDs = append(nodeIDs, exec.NodeID)
+	}
+	return nodeIDs, nil
+}
+
+// Node flag operations
+
+func (m *MemoryStore) CreateNodeFlag(flag *models.NodeFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := copyFlag(flag)
+	stored.ClearedAt = nil
+	m.flags = append(m.flags, stored)
+	return nil
+}
+
+func (m *MemoryStore) FlagNode(flag *models.NodeFlag) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.nodes[flag.NodeID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	stored := copyFlag(flag)
+	stored.ClearedAt = nil
+	m.flags = append(m.flags, stored)
+	if !flag.Quarantined {
+		return nil, nil
+	}
+	return m.quarantineNode(flag.NodeID, "Node quarantined")
+}
+
+func (m *MemoryStore) GetNodeFlags(nodeID string) ([]*models.NodeFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var flags []*models.NodeFlag
+	for _, flag := range m.flags {
+		if nodeID == "" || flag.NodeID == nodeID {
+			flags = append(flags, copyFlag(flag))
+		}
+	}
+	sort.SliceStable(flags, func(i, j int) bool { return flags[i].FlaggedAt.After(flags[j].FlaggedAt) })
+	return flags, nil
+}
+
+func (m *MemoryStore) ClearNodeFlags(nodeID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cleared := 0
+	now := time.Now()
+	for _, flag := range m.flags {
+		if flag.NodeID == nodeID && flag.ClearedAt == nil {
+			flag.ClearedAt = timePtr(now)
+			cleared++
+		}
+	}
+	return cleared, nil
+}
+
+// Fair-share operations
+
+func (m *MemoryStore) GetSubmitterUsage(since time.Time) (map[string]float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	usage := make(map[string]float64)
+	for _, exec := range m.executions {
+		job, ok := m.jobs[exec.JobID]
+		if !ok || job.CanaryID != "" || exec.ClaimedAt == nil {
+			continue
+		}
+		end := now
+		if exec.CompletedAt != nil {
+			if exec.CompletedAt.Before(since) {
+				continue
+			}
+			end = *exec.CompletedAt
+		} else if exec.Status != models.JobStatusRunning {
+			continue
+		}
+		start := *exec.ClaimedAt
+		if start.Before(since) {
+			start = since
+		}
+		usage[job.SubmittedBy] += end.Sub(start).Seconds()
+	}
+	return usage, nil
+}
+
+func (m *MemoryStore) GetShareWeights() (map[string]float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	weights := make(map[string]float64, len(m.shares))
+	for submitter, weight := range m.shares {
+		weights[submitter] = weight
+	}
+	return weights, nil
+}
+
+func (m *MemoryStore) SetShareWeight(submitter string, weight float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.shares[submitter] = weight
+	return nil
+}
+
+// Canary operations
+
+func (m *MemoryStore) CreateCanary(canary *models.Canary) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.canaries[canary.ID] = copyCanary(canary)
+	return nil
+}
+
+func (m *MemoryStore) GetCanary(id string) (*models.Canary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	canary, ok := m.canaries[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyCanary(canary), nil
+}
+
+func (m *MemoryStore) findCanaries(match func(*models.Canary) bool) []*models.Canary {
+	var canaries []*models.Canary
+	for _, canary := range m.canaries {
+		if match(canary) {
+			canaries = append(canaries, copyCanary(canary))
+		}
+	}
+	sort.SliceStable(canaries, func(i, j int) bool { return canaries[i].CreatedAt.After(canaries[j].CreatedAt) })
+	return canaries
+}
+
+func (m *MemoryStore) GetAllCanaries() ([]*models.Canary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findCanaries(func(*models.Canary) bool { return true }), nil
+}
+
+func (m *MemoryStore) GetEnabledCanaries() ([]*models.Canary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.findCanaries(func(canary *models.Canary) bool { return canary.Enabled }), nil
+}
+
+func (m *MemoryStore) DisableCanary(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	canary, ok := m.canaries[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	canary.Enabled = false
+	return nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the numbered schema migrations, one directory per
+// dialect: <version>_<name>.up.sql applies a change, .down.sql reverts it.
+// Both directories carry the same versions.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew means the database was migrated by a newer coordinator,
+// whose schema this one doesn't know how to use or roll back
+var ErrSchemaTooNew = errors.New("database schema is newer than this coordinator")
+
+// Migration is one numbered schema change and its reversal
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // Nil while pending
+	Unknown   bool       // Applied by a newer coordinator
+}
+
+// loadMigrations reads a dialect's migrations in version order, checking
+// that versions run from 1 without gaps and that each has an up and a down
+func loadMigrations(dir string) ([]Migration, error) {
+	root := "migrations/" + dir
+	entries, err := fs.ReadDir(migrationFiles, root)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		var up bool
+		var base string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			up, base = true, strings.TrimSuffix(file, ".up.sql")
+		case strings.HasSuffix(file, ".down.sql"):
+			base = strings.TrimSuffix(file, ".down.sql")
+		default:
+			continue
+		}
+
+		number, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s/%s: expected <version>_<name>.up.sql or .down.sql", root, file)
+		}
+
+		body, err := fs.ReadFile(migrationFiles, root+"/"+file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %s/%s: version %d is already named %q", root, file, version, m.Name)
+		}
+		if up {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migrations in %s: version %d is missing", root, i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s/%04d_%s: needs both an up and a down file", root, m.Version, m.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrations lists every migration this coordinator knows, applied or
+// pending, followed by any applied ones it doesn't know
+func (d *Database) Migrations() ([]MigrationStatus, error) {
+	migrations, applied, err := d.migrationState()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			status.AppliedAt = a.AppliedAt
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	var unknown []MigrationStatus
+	for _, a := range applied {
+		a.Unknown = true
+		unknown = append(unknown, a)
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+	return append(statuses, unknown...), nil
+}
+
+// MigrateUp applies every pending migration in version order and returns how
+// many it applied. It refuses with ErrSchemaTooNew to touch a database a
+// newer coordinator has migrated.
+func (d *Database) MigrateUp() (int, error) {
+	migrations, applied, err := d.migrationState()
+	if err != nil {
+		return 0, err
+	}
+	if err := checkSchemaVersion(migrations, applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := d.runMigration(m, true); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations, newest first, and
+// returns how many it reverted
+func (d *Database) MigrateDown(steps int) (int, error) {
+	migrations, applied, err := d.migrationState()
+	if err != nil {
+		return 0, err
+	}
+	if err := checkSchemaVersion(migrations, applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		if _, ok := applied[migrations[i].Version]; !ok {
+			continue
+		}
+		if err := d.runMigration(migrations[i], false); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// migrationState loads the dialect's migrations and the versions recorded as
+// applied, creating the schema_migrations table on first use
+func (d *Database) migrationState() ([]Migration, map[int]MigrationStatus, error) {
+	migrations, err := loadMigrations(d.dialect.name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = d.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := d.db.Query(`SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationStatus)
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt time.Time
+		if err := rows.Scan(&status.Version, &status.Name, &appliedAt); err != nil {
+			return nil, nil, err
+		}
+		status.AppliedAt = &appliedAt
+		applied[status.Version] = status
+	}
+	return migrations, applied, rows.Err()
+}
+
+func checkSchemaVersion(migrations []Migration, applied map[int]MigrationStatus) error {
+	for version := range applied {
+		if version > len(migrations) {
+			return fmt.Errorf("%w: it is at version %d, this coordinator knows up to %d",
+				ErrSchemaTooNew, version, len(migrations))
+		}
+	}
+	return nil
+}
+
+// runMigration applies or reverts m and records it, in one transaction
+func (d *Database) runMigration(m Migration, up bool) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, record := m.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	if !up {
+		script, record = m.Down, `DELETE FROM schema_migrations WHERE version = $1 AND name = $2`
+	}
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.Exec(record, m.Version, m.Name); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+-- The schema the coordinator first shipped with. Databases created before
+-- migrations existed already have these tables, hence IF NOT EXISTS here and
+-- in the migrations that follow.
+CREATE TABLE IF NOT EXISTS jobs (
+	id VARCHAR(36) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	docker_image VARCHAR(255) NOT NULL,
+	command JSONB NOT NULL,
+	environment JSONB,
+	input_data TEXT,
+	required_cpu INTEGER DEFAULT 1,
+	required_memory INTEGER DEFAULT 1,
+	required_gpu BOOLEAN DEFAULT FALSE,
+	redundancy INTEGER DEFAULT 3,
+	consensus INTEGER DEFAULT 2,
+	status VARCHAR(50) NOT NULL,
+	submitted_by VARCHAR(255),
+	submitted_at TIMESTAMP NOT NULL,
+	started_at TIMESTAMP,
+	completed_at TIMESTAMP,
+	result TEXT,
+	error_message TEXT,
+	credits_required INTEGER DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS nodes (
+	id VARCHAR(36) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	region VARCHAR(100),
+	cpu_cores INTEGER NOT NULL,
+	memory_gb INTEGER NOT NULL,
+	gpu_enabled BOOLEAN DEFAULT FALSE,
+	gpu_model VARCHAR(255),
+	status VARCHAR(50) NOT NULL,
+	reputation_score REAL DEFAULT 100.0,
+	total_jobs_run INTEGER DEFAULT 0,
+	successful_jobs_run INTEGER DEFAULT 0,
+	failed_jobs INTEGER DEFAULT 0,
+	credits_earned INTEGER DEFAULT 0,
+	last_heartbeat TIMESTAMP NOT NULL,
+	registered_at TIMESTAMP NOT NULL,
+	current_job_id VARCHAR(36)
+);
+
+CREATE TABLE IF NOT EXISTS job_executions (
+	id VARCHAR(36) PRIMARY KEY,
+	job_id VARCHAR(36) NOT NULL REFERENCES jobs(id),
+	node_id VARCHAR(36) NOT NULL REFERENCES nodes(id),
+	status VARCHAR(50) NOT NULL,
+	started_at TIMESTAMP NOT NULL,
+	completed_at TIMESTAMP,
+	result TEXT,
+	result_hash VARCHAR(64),
+	error_message TEXT,
+	logs TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+CREATE INDEX IF NOT EXISTS idx_nodes_status ON nodes(status);
+CREATE INDEX IF NOT EXISTS idx_executions_job_id ON job_executions(job_id);
+CREATE INDEX IF NOT EXISTS idx_executions_node_id ON job_executions(node_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_executions_lease;
+
+ALTER TABLE job_executions DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE job_executions DROP COLUMN IF EXISTS claimed_at;
+ALTER TABLE job_executions DROP COLUMN IF EXISTS error_class;
+ALTER TABLE job_executions DROP COLUMN IF EXISTS stderr;
+ALTER TABLE job_executions RENAME COLUMN stdout TO logs;
@@ -0,0 +1,17 @@
+-- Executions are claimed under a lease, and keep stdout apart from stderr.
+-- The old combined logs column becomes stdout.
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns
+	           WHERE table_name = 'job_executions' AND column_name = 'logs') THEN
+		ALTER TABLE job_executions RENAME COLUMN logs TO stdout;
+	END IF;
+END $$;
+
+ALTER TABLE job_executions ADD COLUMN IF NOT EXISTS stdout TEXT;
+ALTER TABLE job_executions ADD COLUMN IF NOT EXISTS stderr TEXT;
+ALTER TABLE job_executions ADD COLUMN IF NOT EXISTS error_class VARCHAR(50);
+ALTER TABLE job_executions ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMP;
+ALTER TABLE job_executions ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_executions_lease ON job_executions(status, lease_expires_at);
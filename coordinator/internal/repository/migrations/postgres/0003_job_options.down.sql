@@ -0,0 +1,11 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS verification;
+ALTER TABLE jobs DROP COLUMN IF EXISTS max_redundancy;
+ALTER TABLE jobs DROP COLUMN IF EXISTS adaptive;
+ALTER TABLE jobs DROP COLUMN IF EXISTS tie_breakers;
+ALTER TABLE jobs DROP COLUMN IF EXISTS consensus_weight;
+ALTER TABLE jobs DROP COLUMN IF EXISTS comparator;
+ALTER TABLE jobs DROP COLUMN IF EXISTS normalize;
+ALTER TABLE jobs DROP COLUMN IF EXISTS output_file;
+ALTER TABLE jobs DROP COLUMN IF EXISTS deadline;
+ALTER TABLE jobs DROP COLUMN IF EXISTS timeout_seconds;
+ALTER TABLE jobs DROP COLUMN IF EXISTS disk_quota_gb;
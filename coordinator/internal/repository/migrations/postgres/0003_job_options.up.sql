@@ -0,0 +1,12 @@
+-- Per-job resource limits, timeouts, output handling and verification policy
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS disk_quota_gb INTEGER DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS timeout_seconds INTEGER DEFAULT 300;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS deadline TIMESTAMP;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS output_file TEXT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS normalize JSONB;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS comparator JSONB;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS consensus_weight REAL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS tie_breakers INTEGER DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS adaptive BOOLEAN DEFAULT FALSE;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS max_redundancy INTEGER DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS verification JSONB;
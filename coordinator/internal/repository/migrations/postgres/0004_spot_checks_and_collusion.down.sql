@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS node_flags;
+ALTER TABLE jobs DROP COLUMN IF EXISTS canary_id;
+DROP TABLE IF EXISTS canaries;
@@ -0,0 +1,33 @@
+-- Known-answer canary jobs, and the flags raised against colluding nodes
+CREATE TABLE IF NOT EXISTS canaries (
+	id VARCHAR(36) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	docker_image VARCHAR(255) NOT NULL,
+	command JSONB NOT NULL,
+	environment JSONB,
+	input_data TEXT,
+	required_cpu INTEGER DEFAULT 1,
+	required_memory INTEGER DEFAULT 1,
+	timeout_seconds INTEGER DEFAULT 300,
+	output_file TEXT,
+	normalize JSONB,
+	expected_hash VARCHAR(64) NOT NULL,
+	enabled BOOLEAN DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS canary_id VARCHAR(36) REFERENCES canaries(id);
+
+CREATE TABLE IF NOT EXISTS node_flags (
+	id VARCHAR(36) PRIMARY KEY,
+	node_id VARCHAR(36) NOT NULL REFERENCES nodes(id),
+	signal VARCHAR(50) NOT NULL,
+	explanation TEXT NOT NULL,
+	related_nodes JSONB,
+	quarantined BOOLEAN DEFAULT FALSE,
+	flagged_at TIMESTAMP NOT NULL,
+	cleared_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_flags_node_id ON node_flags(node_id);
@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS fair_shares;
+
+ALTER TABLE nodes DROP COLUMN IF EXISTS maintenance_end;
+ALTER TABLE nodes DROP COLUMN IF EXISTS maintenance_start;
+ALTER TABLE nodes DROP COLUMN IF EXISTS draining;
+ALTER TABLE nodes DROP COLUMN IF EXISTS cordoned;
+ALTER TABLE nodes DROP COLUMN IF EXISTS max_slots;
+ALTER TABLE nodes DROP COLUMN IF EXISTS taints;
+ALTER TABLE nodes DROP COLUMN IF EXISTS labels;
+ALTER TABLE nodes DROP COLUMN IF EXISTS price;
+ALTER TABLE nodes DROP COLUMN IF EXISTS host;
+ALTER TABLE nodes DROP COLUMN IF EXISTS owner;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS tolerations;
+ALTER TABLE jobs DROP COLUMN IF EXISTS affinity;
+ALTER TABLE jobs DROP COLUMN IF EXISTS node_selector;
+ALTER TABLE jobs DROP COLUMN IF EXISTS non_preemptible;
+ALTER TABLE jobs DROP COLUMN IF EXISTS priority;
+ALTER TABLE jobs DROP COLUMN IF EXISTS placement;
+ALTER TABLE jobs DROP COLUMN IF EXISTS spread;
@@ -0,0 +1,26 @@
+-- Placement, priority and node selection for jobs; capacity, ownership,
+-- labels and maintenance state for nodes; fair-share weights for submitters
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS spread JSONB;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS placement VARCHAR(50);
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS priority INTEGER DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS non_preemptible BOOLEAN DEFAULT FALSE;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS node_selector JSONB;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS affinity JSONB;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS tolerations JSONB;
+
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS owner VARCHAR(255);
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS host VARCHAR(255);
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS price REAL DEFAULT 1;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS labels JSONB;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS taints JSONB;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS max_slots INTEGER DEFAULT 1;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS cordoned BOOLEAN DEFAULT FALSE;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS draining BOOLEAN DEFAULT FALSE;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS maintenance_start TIMESTAMP;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS maintenance_end TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS fair_shares (
+	submitted_by VARCHAR(255) PRIMARY KEY,
+	weight REAL NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Workers poll for the executions scheduled on them by node and status
+CREATE INDEX IF NOT EXISTS idx_executions_node_status ON job_executions(node_id, status);
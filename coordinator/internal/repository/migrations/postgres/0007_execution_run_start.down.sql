@@ -0,0 +1 @@
+ALTER TABLE job_executions DROP COLUMN IF EXISTS run_started_at;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS job_executions;
+DROP TABLE IF EXISTS nodes;
+DROP TABLE IF EXISTS jobs;
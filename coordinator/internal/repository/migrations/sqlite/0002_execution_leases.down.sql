@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_executions_lease;
+
+ALTER TABLE job_executions DROP COLUMN lease_expires_at;
+ALTER TABLE job_executions DROP COLUMN claimed_at;
+ALTER TABLE job_executions DROP COLUMN error_class;
+ALTER TABLE job_executions DROP COLUMN stderr;
+ALTER TABLE job_executions RENAME COLUMN stdout TO logs;
@@ -0,0 +1,10 @@
+-- Executions are claimed under a lease, and keep stdout apart from stderr.
+-- The old combined logs column becomes stdout.
+ALTER TABLE job_executions RENAME COLUMN logs TO stdout;
+
+ALTER TABLE job_executions ADD COLUMN stderr TEXT;
+ALTER TABLE job_executions ADD COLUMN error_class VARCHAR(50);
+ALTER TABLE job_executions ADD COLUMN claimed_at TIMESTAMP;
+ALTER TABLE job_executions ADD COLUMN lease_expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_executions_lease ON job_executions(status, lease_expires_at);
@@ -0,0 +1,11 @@
+ALTER TABLE jobs DROP COLUMN verification;
+ALTER TABLE jobs DROP COLUMN max_redundancy;
+ALTER TABLE jobs DROP COLUMN adaptive;
+ALTER TABLE jobs DROP COLUMN tie_breakers;
+ALTER TABLE jobs DROP COLUMN consensus_weight;
+ALTER TABLE jobs DROP COLUMN comparator;
+ALTER TABLE jobs DROP COLUMN normalize;
+ALTER TABLE jobs DROP COLUMN output_file;
+ALTER TABLE jobs DROP COLUMN deadline;
+ALTER TABLE jobs DROP COLUMN timeout_seconds;
+ALTER TABLE jobs DROP COLUMN disk_quota_gb;
@@ -0,0 +1,12 @@
+-- Per-job resource limits, timeouts, output handling and verification policy
+ALTER TABLE jobs ADD COLUMN disk_quota_gb INTEGER DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN timeout_seconds INTEGER DEFAULT 300;
+ALTER TABLE jobs ADD COLUMN deadline TIMESTAMP;
+ALTER TABLE jobs ADD COLUMN output_file TEXT;
+ALTER TABLE jobs ADD COLUMN normalize JSONB;
+ALTER TABLE jobs ADD COLUMN comparator JSONB;
+ALTER TABLE jobs ADD COLUMN consensus_weight REAL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN tie_breakers INTEGER DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN adaptive BOOLEAN DEFAULT FALSE;
+ALTER TABLE jobs ADD COLUMN max_redundancy INTEGER DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN verification JSONB;
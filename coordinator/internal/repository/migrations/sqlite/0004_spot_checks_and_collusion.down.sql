@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS node_flags;
+ALTER TABLE jobs DROP COLUMN canary_id;
+DROP TABLE IF EXISTS canaries;
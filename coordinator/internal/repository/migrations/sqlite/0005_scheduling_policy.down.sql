@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS fair_shares;
+
+ALTER TABLE nodes DROP COLUMN maintenance_end;
+ALTER TABLE nodes DROP COLUMN maintenance_start;
+ALTER TABLE nodes DROP COLUMN draining;
+ALTER TABLE nodes DROP COLUMN cordoned;
+ALTER TABLE nodes DROP COLUMN max_slots;
+ALTER TABLE nodes DROP COLUMN taints;
+ALTER TABLE nodes DROP COLUMN labels;
+ALTER TABLE nodes DROP COLUMN price;
+ALTER TABLE nodes DROP COLUMN host;
+ALTER TABLE nodes DROP COLUMN owner;
+
+ALTER TABLE jobs DROP COLUMN tolerations;
+ALTER TABLE jobs DROP COLUMN affinity;
+ALTER TABLE jobs DROP COLUMN node_selector;
+ALTER TABLE jobs DROP COLUMN non_preemptible;
+ALTER TABLE jobs DROP COLUMN priority;
+ALTER TABLE jobs DROP COLUMN placement;
+ALTER TABLE jobs DROP COLUMN spread;
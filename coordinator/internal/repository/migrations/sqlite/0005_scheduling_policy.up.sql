@@ -0,0 +1,26 @@
+-- Placement, priority and node selection for jobs; capacity, ownership,
+-- labels and maintenance state for nodes; fair-share weights for submitters
+ALTER TABLE jobs ADD COLUMN spread JSONB;
+ALTER TABLE jobs ADD COLUMN placement VARCHAR(50);
+ALTER TABLE jobs ADD COLUMN priority INTEGER DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN non_preemptible BOOLEAN DEFAULT FALSE;
+ALTER TABLE jobs ADD COLUMN node_selector JSONB;
+ALTER TABLE jobs ADD COLUMN affinity JSONB;
+ALTER TABLE jobs ADD COLUMN tolerations JSONB;
+
+ALTER TABLE nodes ADD COLUMN owner VARCHAR(255);
+ALTER TABLE nodes ADD COLUMN host VARCHAR(255);
+ALTER TABLE nodes ADD COLUMN price REAL DEFAULT 1;
+ALTER TABLE nodes ADD COLUMN labels JSONB;
+ALTER TABLE nodes ADD COLUMN taints JSONB;
+ALTER TABLE nodes ADD COLUMN max_slots INTEGER DEFAULT 1;
+ALTER TABLE nodes ADD COLUMN cordoned BOOLEAN DEFAULT FALSE;
+ALTER TABLE nodes ADD COLUMN draining BOOLEAN DEFAULT FALSE;
+ALTER TABLE nodes ADD COLUMN maintenance_start TIMESTAMP;
+ALTER TABLE nodes ADD COLUMN maintenance_end TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS fair_shares (
+	submitted_by VARCHAR(255) PRIMARY KEY,
+	weight REAL NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_executions_node_status;
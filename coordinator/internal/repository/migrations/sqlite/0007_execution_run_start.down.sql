@@ -0,0 +1 @@
+ALTER TABLE job_executions DROP COLUMN run_started_at;
@@ -0,0 +1,3 @@
+-- Set when the worker reports that the container started, after the image
+-- pull, so the job timeout is enforced from there
+ALTER TABLE job_executions ADD COLUMN run_started_at TIMESTAMP;
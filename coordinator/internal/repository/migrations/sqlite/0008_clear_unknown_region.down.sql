@@ -0,0 +1,3 @@
+-- Cleared regions can't be told apart from unset ones, so there is nothing
+-- to restore
+SELECT 1;
@@ -0,0 +1,3 @@
+-- Workers used to report "unknown" when WORKER_REGION was unset. It names no
+-- region, so clear it rather than have spreading treat those nodes as one.
+UPDATE nodes SET region = '' WHERE region = 'unknown';
@@ -0,0 +1,405 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+// snapshot renders the state of the given jobs and nodes, and every execution
+// of those jobs, in the terms both stores must agree on
+func snapshot(t *testing.T, s Store, jobIDs, nodeIDs []string) string {
+	t.Helper()
+	var b strings.Builder
+	for _, id := range jobIDs {
+		job, err := s.GetJob(id)
+		if err != nil {
+			t.Fatalf("GetJob(%s): %v", id, err)
+		}
+		fmt.Fprintf(&b, "job %s: %s redundancy=%d tie_breakers=%d result=%q error=%q started=%t completed=%t\n",
+			job.ID, job.Status, job.Redundancy, job.TieBreakers, job.Result, job.ErrorMessage,
+			job.StartedAt != nil, job.CompletedAt != nil)
+
+		executions, err := s.GetJobExecutions(id)
+		if err != nil {
+			t.Fatalf("GetJobExecutions(%s): %v", id, err)
+		}
+		sort.Slice(executions, func(i, j int) bool { return executions[i].ID < executions[j].ID })
+		for _, exec := range executions {
+			fmt.Fprintf(&b, "  execution %s on %s: %s class=%q error=%q result=%q claimed=%t lease=%t completed=%t\n",
+				exec.ID, exec.NodeID, exec.Status, exec.ErrorClass, exec.ErrorMessage, exec.Result,
+				exec.ClaimedAt != nil, exec.LeaseExpiresAt != nil, exec.CompletedAt != nil)
+		}
+	}
+	for _, id := range nodeIDs {
+		node, err := s.GetNode(id)
+		if err != nil {
+			t.Fatalf("GetNode(%s): %v", id, err)
+		}
+		fmt.Fprintf(&b, "node %s: %s reputation=%.1f run=%d ok=%d failed=%d credits=%d active=%d cpu=%d memory=%d cordoned=%t draining=%t\n",
+			node.ID, node.Status, node.ReputationScore, node.TotalJobsRun, node.SuccessfulJobs, node.FailedJobs,
+			node.CreditsEarned, node.ActiveExecutions, node.UsedCPU, node.UsedMemory, node.Cordoned, node.Draining)
+	}
+	return b.String()
+}
+
+// outcome renders what a store call returned, so errors and returned IDs are
+// compared along with the state they leave
+func outcome(ids []string, err error) string {
+	sort.Strings(ids)
+	switch {
+	case err == nil:
+		return fmt.Sprintf("%v", ids)
+	case errors.Is(err, sql.ErrNoRows):
+		return "no rows"
+	case errors.Is(err, models.ErrInvalidTransition):
+		return "invalid transition"
+	}
+	return err.Error()
+}
+
+func TestStoresAgree(t *testing.T) {
+	nodeIDs := []string{"node-a", "node-b", "node-c"}
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Store) (log []string, jobIDs []string)
+	}{
+		{
+			name: "consensus reached",
+			run: func(t *testing.T, s Store) ([]string, []string) {
+				job := newJob("agree", time.Now())
+				job.Redundancy, job.Consensus = 3, 2
+				ids := schedule(t, s, job, nodeIDs...)
+				if _, err := s.ClaimJobExecution(ids[0], "node-a", time.Minute); err != nil {
+					t.Fatalf("ClaimJobExecution: %v", err)
+				}
+				_, renewErr := s.RenewJobExecutionLease(ids[0], "node-a", time.Minute)
+				_, stolenErr := s.RenewJobExecutionLease(ids[0], "node-b", time.Minute)
+				finish(t, s, ids[1], "node-b", models.JobStatusCompleted)
+				finish(t, s, ids[2], "node-c", models.JobStatusFailed)
+				err := s.FinalizeJob(job.ID, &models.JobOutcome{
+					Status: models.JobStatusCompleted, Result: "agreed",
+					Verification: &models.VerificationResult{JobID: job.ID, ConsensusReached: true},
+					Rewards: []models.NodeReward{
+						{NodeID: "node-b", Reputation: 2, Success: true, Credits: 5},
+						{NodeID: "node-c", Reputation: -10},
+					},
+				})
+				again := s.FinalizeJob(job.ID, &models.JobOutcome{Status: models.JobStatusFailed})
+				return []string{
+					"renew: " + outcome(nil, renewErr),
+					"renew on another node: " + outcome(nil, stolenErr),
+					"finalize: " + outcome(nil, err),
+					"finalize again: " + outcome(nil, again),
+				}, []string{job.ID}
+			},
+		},
+		{
+			name: "cancel",
+			run: func(t *testing.T, s Store) ([]string, []string) {
+				job := newJob("cancel", time.Now())
+				job.Redundancy = 2
+				ids := schedule(t, s, job, "node-a", "node-b")
+				if _, err := s.ClaimJobExecution(ids[0], "node-a", time.Minute); err != nil {
+					t.Fatalf("ClaimJobExecution: %v", err)
+				}
+				stopped, err := s.CancelJob(job.ID)
+				_, again := s.CancelJob(job.ID)
+				revoked, revokedErr := s.GetRevokedExecutions("node-a", []string{ids[0]})
+				return []string{
+					"cancel: " + outcome(stopped, err),
+					"cancel again: " + outcome(nil, again),
+					"revoked: " + outcome(revoked, revokedErr),
+				}, []string{job.ID}
+			},
+		},
+		{
+			name: "drain",
+			run: func(t *testing.T, s Store) ([]string, []string) {
+				now := time.Now()
+				running := scheduleOn(t, s, "running", "node-a", 0, now)
+				scheduleOn(t, s, "waiting", "node-a", 0, now.Add(time.Second))
+				if _, err := s.ClaimJobExecution(running, "node-a", time.Minute); err != nil {
+					t.Fatalf("ClaimJobExecution: %v", err)
+				}
+				drained, err := s.DrainNode("node-a", true)
+				early, earlyErr := s.FinishDrains()
+				finishErr := s.FinishJobExecution(&models.JobExecution{
+					ID: running, NodeID: "node-a", Status: models.JobStatusCompleted, CompletedAt: timePtr(time.Now()),
+				})
+				if finishErr != nil {
+					t.Fatalf("FinishJobExecution: %v", finishErr)
+				}
+				late, lateErr := s.FinishDrains()
+				return []string{
+					"drain: " + outcome(drained, err),
+					"finish drains while running: " + outcome(early, earlyErr),
+					"finish drains when idle: " + outcome(late, lateErr),
+				}, []string{"running", "waiting"}
+			},
+		},
+		{
+			name: "preempt and reassign",
+			run: func(t *testing.T, s Store) ([]string, []string) {
+				now := time.Now()
+				low := scheduleOn(t, s, "low", "node-a", 0, now)
+				// Its claim deadline has passed, so it can move to another node
+				moved := scheduleOn(t, s, "moved", "node-b", 0, now.Add(-2*claimWindow))
+				if _, err := s.ClaimJobExecution(low, "node-a", time.Minute); err != nil {
+					t.Fatalf("ClaimJobExecution: %v", err)
+				}
+				preemptible, preemptibleErr := s.GetPreemptibleExecutions(1)
+				var preemptibleIDs []string
+				for _, exec := range preemptible {
+					preemptibleIDs = append(preemptibleIDs, exec.ID)
+				}
+				preemptErr := s.PreemptJobExecution(low, "Preempted by a higher-priority job")
+				again := s.PreemptJobExecution(low, "again")
+				revoked, revokedErr := s.GetRevokedExecutions("node-a", []string{low})
+				reassignErr := s.ReassignJobExecution(moved, "node-c", now.Add(claimWindow))
+				claimedErr := s.ReassignJobExecution(moved, "node-a", now.Add(claimWindow))
+				return []string{
+					"preemptible: " + outcome(preemptibleIDs, preemptibleErr),
+					"preempt: " + outcome(nil, preemptErr),
+					"preempt again: " + outcome(nil, again),
+					"revoked: " + outcome(revoked, revokedErr),
+					"reassign: " + outcome(nil, reassignErr),
+					"reassign before the new deadline: " + outcome(nil, claimedErr),
+				}, []string{"low", "moved"}
+			},
+		},
+		{
+			name: "node lost",
+			run: func(t *testing.T, s Store) ([]string, []string) {
+				now := time.Now()
+				first := scheduleOn(t, s, "first", "node-a", 0, now)
+				scheduleOn(t, s, "second", "node-a", 0, now.Add(time.Second))
+				if _, err := s.ClaimJobExecution(first, "node-a", time.Minute); err != nil {
+					t.Fatalf("ClaimJobExecution: %v", err)
+				}
+				failed, err := s.FailNodeExecutions("node-a", models.ErrorClassNodeLost, "Node stopped responding")
+				statusErr := s.UpdateNodeStatus("node-a", models.NodeStatusOffline)
+				return []string{
+					"fail node executions: " + outcome(failed, err),
+					"mark offline: " + outcome(nil, statusErr),
+				}, []string{"first", "second"}
+			},
+		},
+		{
+			name: "tie-breakers",
+			run: func(t *testing.T, s Store) ([]string, []string) {
+				now := time.Now()
+				split := newJob("split", now)
+				split.Redundancy, split.Consensus = 2, 2
+				schedule(t, s, split, "node-a", "node-b")
+				pending := newJob("pending", now)
+				if err := s.CreateJob(pending); err != nil {
+					t.Fatalf("CreateJob: %v", err)
+				}
+				tieErr := s.AddTieBreakers(split.ID, 1)
+				redundancyErr := s.SetJobRedundancy(split.ID, 4)
+				pendingErr := s.AddTieBreakers(pending.ID, 1)
+				added, addErr := s.AddJobExecutions(split.ID, []*models.JobExecution{{
+					ID: "exec-split-node-c", JobID: split.ID, NodeID: "node-c",
+					Status: models.JobStatusScheduled, StartedAt: now,
+				}})
+				return []string{
+					"add tie-breaker: " + outcome(nil, tieErr),
+					"set redundancy: " + outcome(nil, redundancyErr),
+					"tie-breaker on pending job: " + outcome(nil, pendingErr),
+					fmt.Sprintf("add executions: %d %s", added, outcome(nil, addErr)),
+				}, []string{split.ID, pending.ID}
+			},
+		},
+		{
+			name: "quarantine",
+			run: func(t *testing.T, s Store) ([]string, []string) {
+				now := time.Now()
+				for _, nodeID := range []string{"node-a", "node-b"} {
+					err := s.CreateNodeFlag(&models.NodeFlag{
+						ID: "flag-" + nodeID, NodeID: nodeID, Signal: models.SignalMinorityAgreement,
+						Explanation: "Agrees on disputed jobs", RelatedNodes: []string{"node-c"},
+						Quarantined: true, FlaggedAt: now,
+					})
+					if err != nil {
+						t.Fatalf("CreateNodeFlag: %v", err)
+					}
+				}
+				reputationErr := s.UpdateNodeReputation("node-a", -500)
+				faultyErr := s.UpdateNodeStatus("node-a", models.NodeStatusFaulty)
+				flags, flagsErr := s.GetNodeFlags("")
+				var flagIDs []string
+				for _, flag := range flags {
+					flagIDs = append(flagIDs, flag.ID+"->"+strings.Join(flag.RelatedNodes, ","))
+				}
+				cleared, clearErr := s.ClearNodeFlags("node-a")
+				reinstateErr := s.ReinstateNode("node-a")
+				healthyErr := s.ReinstateNode("node-b")
+				return []string{
+					"lower reputation: " + outcome(nil, reputationErr),
+					"mark faulty: " + outcome(nil, faultyErr),
+					"flags: " + outcome(flagIDs, flagsErr),
+					fmt.Sprintf("cleared: %d %s", cleared, outcome(nil, clearErr)),
+					"reinstate: " + outcome(nil, reinstateErr),
+					"reinstate healthy node: " + outcome(nil, healthyErr),
+				}, nil
+			},
+		},
+		{
+			name: "shares and canaries",
+			run: func(t *testing.T, s Store) ([]string, []string) {
+				shareErr := s.SetShareWeight("team-a", 2)
+				overwriteErr := s.SetShareWeight("team-a", 3)
+				weights, weightsErr := s.GetShareWeights()
+				for _, id := range []string{"canary-1", "canary-2"} {
+					err := s.CreateCanary(&models.Canary{
+						ID: id, Name: id, DockerImage: "alpine:3", Command: []string{"echo", id},
+						RequiredCPU: 1, RequiredMemory: 1, TimeoutSeconds: 60,
+						ExpectedHash: "hash", Enabled: true, CreatedAt: time.Now(),
+					})
+					if err != nil {
+						t.Fatalf("CreateCanary: %v", err)
+					}
+				}
+				disableErr := s.DisableCanary("canary-1")
+				missingErr := s.DisableCanary("missing")
+				enabled, enabledErr := s.GetEnabledCanaries()
+				var enabledIDs []string
+				for _, canary := range enabled {
+					enabledIDs = append(enabledIDs, canary.ID)
+				}
+				return []string{
+					"set share: " + outcome(nil, shareErr),
+					"overwrite share: " + outcome(nil, overwriteErr),
+					fmt.Sprintf("weights: %v %s", weights, outcome(nil, weightsErr)),
+					"disable: " + outcome(nil, disableErr),
+					"disable missing: " + outcome(nil, missingErr),
+					"enabled: " + outcome(enabledIDs, enabledErr),
+				}, nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := make(map[string]string)
+			for name, s := range stores(t) {
+				for _, id := range nodeIDs {
+					registerNode(t, s, id, 2)
+				}
+				log, jobIDs := tt.run(t, s)
+				results[name] = strings.Join(log, "\n") + "\n" + snapshot(t, s, jobIDs, nodeIDs)
+			}
+			if results["memory"] != results["sqlite"] {
+				t.Errorf("stores disagree\nmemory:\n%s\nsqlite:\n%s", results["memory"], results["sqlite"])
+			}
+		})
+	}
+}
+
+func TestStoresRoundTripJobs(t *testing.T) {
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			job := newJob("detailed", time.Now())
+			job.Environment = map[string]string{"MODE": "fast"}
+			job.Deadline = &deadline
+			job.Normalize = []models.NormalizationRule{{Type: models.NormalizeStripRegex, Pattern: `\d+ms`}}
+			job.Comparator = models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 0.5}
+			job.Spread = models.SpreadPolicy{Domains: []models.SpreadDomain{models.SpreadOwner}, Mode: models.SpreadStrict}
+			job.NodeSelector = map[string]string{"arch": "amd64"}
+			job.Affinity = models.NodeAffinity{
+				Required:  []models.LabelExpression{{Key: "disk", Operator: models.LabelIn, Values: []string{"ssd"}}},
+				Preferred: []models.PreferredExpression{{Weight: 5, Expression: models.LabelExpression{Key: "zone", Operator: models.LabelExists}}},
+			}
+			job.Tolerations = []models.Toleration{{Key: "dedicated", Operator: models.TolerationEqual, Value: "ml"}}
+			want := copyJob(job)
+			if err := s.CreateJob(job); err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+
+			got, err := s.GetJob(job.ID)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			if got.Deadline == nil || !got.Deadline.Equal(deadline) {
+				t.Errorf("deadline = %v, want %v", got.Deadline, deadline)
+			}
+			fields := []struct {
+				name      string
+				got, want interface{}
+			}{
+				{"command", got.Command, want.Command},
+				{"environment", got.Environment, want.Environment},
+				{"normalize", got.Normalize, want.Normalize},
+				{"comparator", got.Comparator, want.Comparator},
+				{"spread", got.Spread, want.Spread},
+				{"node selector", got.NodeSelector, want.NodeSelector},
+				{"affinity", got.Affinity, want.Affinity},
+				{"tolerations", got.Tolerations, want.Tolerations},
+			}
+			for _, f := range fields {
+				if !reflect.DeepEqual(f.got, f.want) {
+					t.Errorf("%s = %+v, want %+v", f.name, f.got, f.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStoresDontShareJobState(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			job := newJob("isolated", time.Now())
+			job.Environment = map[string]string{"MODE": "fast"}
+			job.Normalize = []models.NormalizationRule{{Type: models.NormalizeTrimWhitespace}}
+			job.NodeSelector = map[string]string{"arch": "amd64"}
+			job.Affinity.Required = []models.LabelExpression{{Key: "disk", Operator: models.LabelIn, Values: []string{"ssd"}}}
+			if err := s.CreateJob(job); err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+
+			// Changing the submitted job or a returned copy leaves the stored
+			// job alone
+			job.Command[1] = "changed"
+			job.Environment["MODE"] = "changed"
+			job.Normalize[0].Type = models.NormalizeSortLines
+			job.NodeSelector["arch"] = "changed"
+			job.Affinity.Required[0].Values[0] = "changed"
+			got, err := s.GetJob(job.ID)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			got.Command[0] = "changed"
+			got.Environment["MODE"] = "changed"
+
+			stored, err := s.GetJob(job.ID)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			if stored.Command[0] != "echo" || stored.Command[1] != job.ID {
+				t.Errorf("command = %v, want it as submitted", stored.Command)
+			}
+			if stored.Environment["MODE"] != "fast" {
+				t.Errorf("environment = %v, want it as submitted", stored.Environment)
+			}
+			if stored.Normalize[0].Type != models.NormalizeTrimWhitespace {
+				t.Errorf("normalize = %v, want it as submitted", stored.Normalize)
+			}
+			if stored.NodeSelector["arch"] != "amd64" {
+				t.Errorf("node selector = %v, want it as submitted", stored.NodeSelector)
+			}
+			if stored.Affinity.Required[0].Values[0] != "ssd" {
+				t.Errorf("affinity = %+v, want it as submitted", stored.Affinity)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTimeFormat is how timestamps are stored in SQLite: fixed-width UTC
+// text, which sorts and compares correctly as a string and which both
+// julianday() and the driver read back
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000-07:00"
+
+var sqliteDialect = dialect{
+	name:     "sqlite",
+	epoch:    func(expr string) string { return "((julianday(" + expr + ") - 2440587.5) * 86400.0)" },
+	greatest: "MAX",
+	// SQLite has no row locks. Transactions take the database's write lock
+	// when they begin (_txlock=immediate), so they run one at a time.
+	lockRows: "",
+}
+
+// NewSQLite opens, or creates, an embedded SQLite database file for a
+// single-box deployment. MigrateUp brings the schema up to date. SQLite allows
+// one writer at a time, so the coordinator uses a single connection.
+func NewSQLite(path string) (*Database, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return &Database{db: sqliteConn{db}, dialect: sqliteDialect}, nil
+}
+
+// sqliteConn stores time parameters in sqliteTimeFormat
+type sqliteConn struct {
+	*sql.DB
+}
+
+func (c sqliteConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(query, sqliteArgs(args)...)
+}
+
+func (c sqliteConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.Query(query, sqliteArgs(args)...)
+}
+
+func (c sqliteConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRow(query, sqliteArgs(args)...)
+}
+
+func (c sqliteConn) Begin() (transaction, error) {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return sqliteTx{tx}, nil
+}
+
+// sqliteTx stores time parameters in sqliteTimeFormat, like sqliteConn
+type sqliteTx struct {
+	*sql.Tx
+}
+
+func (t sqliteTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(query, sqliteArgs(args)...)
+}
+
+func (t sqliteTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.Query(query, sqliteArgs(args)...)
+}
+
+func (t sqliteTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRow(query, sqliteArgs(args)...)
+}
+
+func sqliteArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			converted[i] = v.UTC().Format(sqliteTimeFormat)
+		case *time.Time:
+			if v != nil {
+				converted[i] = v.UTC().Format(sqliteTimeFormat)
+			}
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
@@ -0,0 +1,811 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+const claimWindow = 2 * time.Minute
+
+// stores returns an empty instance of every Store that runs without a server
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	sqlite, err := NewSQLite(filepath.Join(t.TempDir(), "coordinator.db"))
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if _, err := sqlite.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	return map[string]Store{"memory": NewMemoryStore(), "sqlite": sqlite}
+}
+
+func registerNode(t *testing.T, s Store, id string, slots int) {
+	t.Helper()
+	now := time.Now()
+	err := s.RegisterNode(&models.Node{
+		ID: id, Name: id, CPUCores: 8, MemoryGB: 16, Status: models.NodeStatusOnline,
+		ReputationScore: 100, LastHeartbeat: now, RegisteredAt: now, MaxSlots: slots,
+	})
+	if err != nil {
+		t.Fatalf("RegisterNode(%s): %v", id, err)
+	}
+}
+
+// scheduleOn creates a job and schedules one execution of it on nodeID,
+// returning the execution's ID
+func scheduleOn(t *testing.T, s Store, jobID, nodeID string, priority int, at time.Time) string {
+	t.Helper()
+	job := newJob(jobID, at)
+	job.Priority = priority
+	return schedule(t, s, job, nodeID)[0]
+}
+
+// newJob returns a pending single-replica job submitted at
+func newJob(id string, at time.Time) *models.Job {
+	return &models.Job{
+		ID: id, Name: id, DockerImage: "alpine:3", Command: []string{"echo", id},
+		RequiredCPU: 1, RequiredMemory: 1, Redundancy: 1, Consensus: 1,
+		Status: models.JobStatusPending, SubmittedAt: at,
+	}
+}
+
+// schedule creates job and schedules one execution of it on each of nodeIDs,
+// returning the executions' IDs
+func schedule(t *testing.T, s Store, job *models.Job, nodeIDs ...string) []string {
+	t.Helper()
+	if err := s.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob(%s): %v", job.ID, err)
+	}
+
+	deadline := job.SubmittedAt.Add(claimWindow)
+	var executions []*models.JobExecution
+	var ids []string
+	for i, nodeID := range nodeIDs {
+		id := "exec-" + job.ID
+		if i > 0 {
+			id += "-" + nodeID
+		}
+		executions = append(executions, &models.JobExecution{
+			ID: id, JobID: job.ID, NodeID: nodeID, Status: models.JobStatusScheduled,
+			StartedAt: job.SubmittedAt, LeaseExpiresAt: &deadline,
+		})
+		ids = append(ids, id)
+	}
+	if err := s.ScheduleJob(job.ID, executions); err != nil {
+		t.Fatalf("ScheduleJob(%s): %v", job.ID, err)
+	}
+	return ids
+}
+
+// finish claims an execution on its node and finishes it with status
+func finish(t *testing.T, s Store, executionID, nodeID string, status models.JobStatus) {
+	t.Helper()
+	if _, err := s.ClaimJobExecution(executionID, nodeID, time.Minute); err != nil {
+		t.Fatalf("ClaimJobExecution(%s): %v", executionID, err)
+	}
+	err := s.FinishJobExecution(&models.JobExecution{
+		ID: executionID, NodeID: nodeID, Status: status, CompletedAt: timePtr(time.Now()),
+	})
+	if err != nil {
+		t.Fatalf("FinishJobExecution(%s): %v", executionID, err)
+	}
+}
+
+// activeExecutions returns how many executions hold a slot on a node
+func activeExecutions(t *testing.T, s Store, nodeID string) int {
+	t.Helper()
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		t.Fatalf("GetNode(%s): %v", nodeID, err)
+	}
+	return node.ActiveExecutions
+}
+
+func TestGetScheduledExecutions(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			registerNode(t, s, "node-a", 4)
+			registerNode(t, s, "node-b", 4)
+
+			base := time.Now().Add(-time.Minute)
+			scheduleOn(t, s, "early", "node-a", 0, base)
+			scheduleOn(t, s, "late", "node-a", 0, base.Add(time.Second))
+			scheduleOn(t, s, "urgent", "node-a", 5, base.Add(2*time.Second))
+			scheduleOn(t, s, "elsewhere", "node-b", 0, base)
+			claimed := scheduleOn(t, s, "claimed", "node-a", 9, base)
+			if _, err := s.ClaimJobExecution(claimed, "node-a", time.Minute); err != nil {
+				t.Fatalf("ClaimJobExecution: %v", err)
+			}
+
+			pending, err := s.GetScheduledExecutions("node-a")
+			if err != nil {
+				t.Fatalf("GetScheduledExecutions: %v", err)
+			}
+
+			// Claimed executions and other nodes' are left out; the rest come
+			// most urgent first, then in the order they were scheduled
+			var order []string
+			for _, p := range pending {
+				order = append(order, p.Job.ID)
+			}
+			if got, want := strings.Join(order, ","), "urgent,early,late"; got != want {
+				t.Fatalf("jobs = %s, want %s", got, want)
+			}
+
+			for _, p := range pending {
+				exec, job := p.Execution, p.Job
+				if exec.ID != "exec-"+job.ID || exec.JobID != job.ID || exec.NodeID != "node-a" {
+					t.Errorf("execution %+v doesn't belong to job %s on node-a", exec, job.ID)
+				}
+				if exec.Status != models.JobStatusScheduled {
+					t.Errorf("execution %s status = %s, want scheduled", exec.ID, exec.Status)
+				}
+				if exec.LeaseExpiresAt == nil {
+					t.Errorf("execution %s has no claim deadline", exec.ID)
+				}
+				if job.DockerImage != "alpine:3" || len(job.Command) != 2 || job.Status != models.JobStatusScheduled {
+					t.Errorf("job %s not loaded in full: %+v", job.ID, job)
+				}
+			}
+
+			none, err := s.GetScheduledExecutions("node-unknown")
+			if err != nil || len(none) != 0 {
+				t.Errorf("GetScheduledExecutions(unknown node) = %v, %v; want none", none, err)
+			}
+		})
+	}
+}
+
+func TestGetScheduledExecutionsUsesIndex(t *testing.T) {
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "coordinator.db"))
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	rows, err := db.db.Query(`
+		EXPLAIN QUERY PLAN
+		SELECT id FROM job_executions WHERE node_id = $1 AND status = $2`,
+		"node-a", models.JobStatusScheduled,
+	)
+	if err != nil {
+		t.Fatalf("EXPLAIN QUERY PLAN: %v", err)
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		plan = append(plan, detail)
+	}
+	if got := strings.Join(plan, "; "); !strings.Contains(got, "idx_executions_node_status") {
+		t.Errorf("query plan %q doesn't use idx_executions_node_status", got)
+	}
+}
+
+func TestMigrationClearsUnknownRegion(t *testing.T) {
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "coordinator.db"))
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if _, err := db.MigrateDown(1); err != nil {
+		t.Fatalf("MigrateDown: %v", err)
+	}
+
+	// Registered by older workers before the migration
+	now := time.Now()
+	for id, region := range map[string]string{"node-a": "unknown", "node-b": "us-west"} {
+		err := db.RegisterNode(&models.Node{
+			ID: id, Name: id, Region: region, CPUCores: 8, MemoryGB: 16, Status: models.NodeStatusOnline,
+			ReputationScore: 100, LastHeartbeat: now, RegisteredAt: now, MaxSlots: 1,
+		})
+		if err != nil {
+			t.Fatalf("RegisterNode(%s): %v", id, err)
+		}
+	}
+
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	for id, want := range map[string]string{"node-a": "", "node-b": "us-west"} {
+		node, err := db.GetNode(id)
+		if err != nil {
+			t.Fatalf("GetNode(%s): %v", id, err)
+		}
+		if node.Region != want {
+			t.Errorf("%s region = %q after migrating, want %q", id, node.Region, want)
+		}
+	}
+}
+
+func TestFailJobStopsOutstandingExecutions(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"node-a", "node-b", "node-c"} {
+				registerNode(t, s, id, 2)
+			}
+
+			// Two of three replicas of a 2-of-3 job fail, so it can't reach
+			// consensus; the third is still waiting for its node
+			job := newJob("split", time.Now())
+			job.Redundancy, job.Consensus = 3, 2
+			ids := schedule(t, s, job, "node-a", "node-b", "node-c")
+			finish(t, s, ids[0], "node-a", models.JobStatusFailed)
+			finish(t, s, ids[1], "node-b", models.JobStatusFailed)
+			if n := activeExecutions(t, s, "node-c"); n != 1 {
+				t.Fatalf("node-c has %d active executions before the job fails, want 1", n)
+			}
+
+			nodeIDs, err := s.FailJob(job.ID, "Too many execution failures")
+			if err != nil {
+				t.Fatalf("FailJob: %v", err)
+			}
+			if len(nodeIDs) != 1 || nodeIDs[0] != "node-c" {
+				t.Errorf("FailJob stopped executions on %v, want [node-c]", nodeIDs)
+			}
+
+			stored, err := s.GetJob(job.ID)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			if stored.Status != models.JobStatusFailed {
+				t.Errorf("job status = %s, want failed", stored.Status)
+			}
+			exec, err := s.GetJobExecution(ids[2])
+			if err != nil {
+				t.Fatalf("GetJobExecution: %v", err)
+			}
+			if exec.Status != models.JobStatusCancelled {
+				t.Errorf("outstanding execution status = %s, want cancelled", exec.Status)
+			}
+			if n := activeExecutions(t, s, "node-c"); n != 0 {
+				t.Errorf("node-c has %d active executions after the job failed, want 0", n)
+			}
+
+			if _, err := s.FailJob(job.ID, "again"); !errors.Is(err, models.ErrInvalidTransition) {
+				t.Errorf("failing a failed job returned %v, want ErrInvalidTransition", err)
+			}
+		})
+	}
+}
+
+func TestFinalizedJobStaysFinished(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"node-a", "node-b", "node-c"} {
+				registerNode(t, s, id, 2)
+			}
+
+			// Two of three replicas agree before the third is claimed
+			job := newJob("agreed", time.Now())
+			job.Redundancy, job.Consensus = 3, 2
+			ids := schedule(t, s, job, "node-a", "node-b", "node-c")
+			finish(t, s, ids[0], "node-a", models.JobStatusCompleted)
+			finish(t, s, ids[1], "node-b", models.JobStatusCompleted)
+
+			err := s.FinalizeJob(job.ID, &models.JobOutcome{
+				Status: models.JobStatusCompleted,
+				Result: "agreed",
+				Rewards: []models.NodeReward{
+					{NodeID: "node-a", Reputation: 5, Success: true},
+					{NodeID: "node-b", Reputation: 5, Success: true},
+				},
+			})
+			if err != nil {
+				t.Fatalf("FinalizeJob: %v", err)
+			}
+
+			exec, err := s.GetJobExecution(ids[2])
+			if err != nil {
+				t.Fatalf("GetJobExecution: %v", err)
+			}
+			if exec.Status != models.JobStatusCancelled {
+				t.Errorf("unneeded replica status = %s, want cancelled", exec.Status)
+			}
+			if n := activeExecutions(t, s, "node-c"); n != 0 {
+				t.Errorf("node-c has %d active executions after the job completed, want 0", n)
+			}
+
+			// Nothing moves a finished job on, or pays its nodes twice
+			if err := s.FinalizeJob(job.ID, &models.JobOutcome{Status: models.JobStatusFailed}); !errors.Is(err, models.ErrInvalidTransition) {
+				t.Errorf("FinalizeJob on a completed job returned %v, want ErrInvalidTransition", err)
+			}
+			if _, err := s.CancelJob(job.ID); !errors.Is(err, models.ErrInvalidTransition) {
+				t.Errorf("CancelJob on a completed job returned %v, want ErrInvalidTransition", err)
+			}
+			if _, err := s.TimeOutJob(job.ID, "late"); !errors.Is(err, models.ErrInvalidTransition) {
+				t.Errorf("TimeOutJob on a completed job returned %v, want ErrInvalidTransition", err)
+			}
+			if err := s.UpdateJobStatus(job.ID, models.JobStatusRunning, "", ""); !errors.Is(err, models.ErrInvalidTransition) {
+				t.Errorf("UpdateJobStatus on a completed job returned %v, want ErrInvalidTransition", err)
+			}
+			if err := s.AddTieBreakers(job.ID, 1); err != sql.ErrNoRows {
+				t.Errorf("AddTieBreakers on a completed job returned %v, want sql.ErrNoRows", err)
+			}
+			if err := s.ReassignJobExecution(ids[2], "node-c", time.Now().Add(claimWindow)); err != ErrLeaseNotHeld {
+				t.Errorf("ReassignJobExecution on a completed job returned %v, want ErrLeaseNotHeld", err)
+			}
+
+			stored, err := s.GetJob(job.ID)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			if stored.Status != models.JobStatusCompleted || stored.Result != "agreed" || stored.Redundancy != 3 {
+				t.Errorf("completed job changed: status %s, result %q, redundancy %d",
+					stored.Status, stored.Result, stored.Redundancy)
+			}
+			node, err := s.GetNode("node-a")
+			if err != nil {
+				t.Fatalf("GetNode: %v", err)
+			}
+			if node.ReputationScore != 105 || node.TotalJobsRun != 1 {
+				t.Errorf("node-a reputation %.0f after %d jobs, want 105 after 1",
+					node.ReputationScore, node.TotalJobsRun)
+			}
+		})
+	}
+}
+
+// backdate moves an execution's claim and reported start back by ago, as if
+// they had happened that long before
+func backdate(t *testing.T, s Store, executionID string, ago time.Duration) {
+	t.Helper()
+	switch s := s.(type) {
+	case *MemoryStore:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		exec := s.execution(executionID)
+		for _, at := range []*time.Time{exec.ClaimedAt, exec.RunStartedAt} {
+			if at != nil {
+				*at = at.Add(-ago)
+			}
+		}
+	case *Database:
+		exec, err := s.GetJobExecution(executionID)
+		if err != nil {
+			t.Fatalf("GetJobExecution: %v", err)
+		}
+		var started *time.Time
+		if exec.RunStartedAt != nil {
+			started = timePtr(exec.RunStartedAt.Add(-ago))
+		}
+		_, err = s.db.Exec(`UPDATE job_executions SET claimed_at = $1, run_started_at = $2 WHERE id = $3`,
+			exec.ClaimedAt.Add(-ago), started, executionID)
+		if err != nil {
+			t.Fatalf("backdating execution: %v", err)
+		}
+	}
+}
+
+func TestTimeOutOverrunExecutionsCountsFromStart(t *testing.T) {
+	const grace, pullAllowance = time.Minute, 10 * time.Minute
+
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			registerNode(t, s, "node-a", 4)
+
+			claim := func(jobID string) string {
+				job := newJob(jobID, time.Now())
+				job.TimeoutSeconds = 60
+				id := schedule(t, s, job, "node-a")[0]
+				if _, err := s.ClaimJobExecution(id, "node-a", time.Hour); err != nil {
+					t.Fatalf("ClaimJobExecution(%s): %v", id, err)
+				}
+				return id
+			}
+
+			// Still pulling a large image five minutes after the claim
+			pulling := claim("pulling")
+			backdate(t, s, pulling, 5*time.Minute)
+
+			// Started half a minute ago after a seven-minute pull, which the
+			// claim time alone would count against its one-minute timeout
+			slowPull := claim("slow-pull")
+			backdate(t, s, slowPull, 7*time.Minute)
+			if err := s.StartJobExecution(slowPull, "node-a"); err != nil {
+				t.Fatalf("StartJobExecution: %v", err)
+			}
+			backdate(t, s, slowPull, 30*time.Second)
+
+			// Running three minutes past a reported start
+			overrun := claim("overrun")
+			if err := s.StartJobExecution(overrun, "node-b"); err != ErrLeaseNotHeld {
+				t.Errorf("StartJobExecution from another node returned %v, want ErrLeaseNotHeld", err)
+			}
+			if err := s.StartJobExecution(overrun, "node-a"); err != nil {
+				t.Fatalf("StartJobExecution: %v", err)
+			}
+			backdate(t, s, overrun, 3*time.Minute)
+
+			// Never reported a start, and past the pull allowance as well
+			silent := claim("silent")
+			backdate(t, s, silent, pullAllowance+3*time.Minute)
+
+			nodeIDs, err := s.TimeOutOverrunExecutions(grace, pullAllowance)
+			if err != nil {
+				t.Fatalf("TimeOutOverrunExecutions: %v", err)
+			}
+			if len(nodeIDs) != 2 {
+				t.Errorf("timed out %d executions, want 2", len(nodeIDs))
+			}
+			for id, want := range map[string]models.JobStatus{
+				pulling: models.JobStatusRunning, slowPull: models.JobStatusRunning,
+				overrun: models.JobStatusFailed, silent: models.JobStatusFailed,
+			} {
+				exec, err := s.GetJobExecution(id)
+				if err != nil {
+					t.Fatalf("GetJobExecution(%s): %v", id, err)
+				}
+				if exec.Status != want {
+					t.Errorf("execution %s is %s, want %s", id, exec.Status, want)
+				}
+			}
+		})
+	}
+}
+
+// race runs fns at the same time and waits for all of them
+func race(fns ...func()) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, fn := range fns {
+		wg.Add(1)
+		go func(fn func()) {
+			defer wg.Done()
+			<-start
+			fn()
+		}(fn)
+	}
+	close(start)
+	wg.Wait()
+}
+
+// raceRounds is how many times each concurrent test races its calls, to try
+// them in different orders
+const raceRounds = 10
+
+func TestClaimRacesCancel(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			registerNode(t, s, "node-a", raceRounds)
+
+			for i := 0; i < raceRounds; i++ {
+				job := newJob(fmt.Sprintf("job-%d", i), time.Now())
+				id := schedule(t, s, job, "node-a")[0]
+
+				var claimErr, cancelErr error
+				race(
+					func() { _, claimErr = s.ClaimJobExecution(id, "node-a", time.Minute) },
+					func() { _, cancelErr = s.CancelJob(job.ID) },
+				)
+				if cancelErr != nil {
+					t.Fatalf("CancelJob: %v", cancelErr)
+				}
+				if claimErr != nil && claimErr != ErrLeaseNotHeld {
+					t.Fatalf("ClaimJobExecution: %v", claimErr)
+				}
+
+				// However they interleave, the claim never outlives the job
+				exec, err := s.GetJobExecution(id)
+				if err != nil {
+					t.Fatalf("GetJobExecution: %v", err)
+				}
+				if exec.Status != models.JobStatusCancelled {
+					t.Errorf("round %d: execution of a cancelled job is %s (claim returned %v)", i, exec.Status, claimErr)
+				}
+				stored, _ := s.GetJob(job.ID)
+				if stored.Status != models.JobStatusCancelled {
+					t.Errorf("round %d: cancelled job is %s", i, stored.Status)
+				}
+			}
+			if n := activeExecutions(t, s, "node-a"); n != 0 {
+				t.Errorf("node-a has %d active executions after every job was cancelled, want 0", n)
+			}
+		})
+	}
+}
+
+func TestPreemptRacesFinalize(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			registerNode(t, s, "node-a", raceRounds)
+			registerNode(t, s, "node-b", raceRounds)
+
+			for i := 0; i < raceRounds; i++ {
+				// One replica is enough; the other is still running
+				job := newJob(fmt.Sprintf("job-%d", i), time.Now())
+				job.Redundancy = 2
+				ids := schedule(t, s, job, "node-a", "node-b")
+				finish(t, s, ids[0], "node-a", models.JobStatusCompleted)
+				if _, err := s.ClaimJobExecution(ids[1], "node-b", time.Minute); err != nil {
+					t.Fatalf("ClaimJobExecution: %v", err)
+				}
+
+				var preemptErr, finalizeErr error
+				race(
+					func() { preemptErr = s.PreemptJobExecution(ids[1], "Preempted") },
+					func() {
+						finalizeErr = s.FinalizeJob(job.ID, &models.JobOutcome{Status: models.JobStatusCompleted})
+					},
+				)
+				if finalizeErr != nil {
+					t.Fatalf("FinalizeJob: %v", finalizeErr)
+				}
+				if preemptErr != nil && preemptErr != sql.ErrNoRows {
+					t.Fatalf("PreemptJobExecution: %v", preemptErr)
+				}
+
+				exec, err := s.GetJobExecution(ids[1])
+				if err != nil {
+					t.Fatalf("GetJobExecution: %v", err)
+				}
+				preempted := exec.Status == models.JobStatusFailed && exec.ErrorClass == models.ErrorClassPreempted
+				if preempted != (preemptErr == nil) {
+					t.Errorf("round %d: execution is %s (%s) but preemption returned %v",
+						i, exec.Status, exec.ErrorClass, preemptErr)
+				}
+				if !preempted && exec.Status != models.JobStatusCancelled {
+					t.Errorf("round %d: leftover replica of a completed job is %s", i, exec.Status)
+				}
+			}
+			if n := activeExecutions(t, s, "node-b"); n != 0 {
+				t.Errorf("node-b has %d active executions after every job completed, want 0", n)
+			}
+		})
+	}
+}
+
+func TestFailNodeExecutionsRacesCancel(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			registerNode(t, s, "node-a", 2*raceRounds)
+
+			for i := 0; i < raceRounds; i++ {
+				now := time.Now()
+				cancelled := scheduleOn(t, s, fmt.Sprintf("cancelled-%d", i), "node-a", 0, now)
+				lost := scheduleOn(t, s, fmt.Sprintf("lost-%d", i), "node-a", 0, now)
+				if _, err := s.ClaimJobExecution(cancelled, "node-a", time.Minute); err != nil {
+					t.Fatalf("ClaimJobExecution: %v", err)
+				}
+
+				var jobIDs []string
+				var failErr, cancelErr error
+				race(
+					func() {
+						jobIDs, failErr = s.FailNodeExecutions("node-a", models.ErrorClassNodeLost, "Node went offline")
+					},
+					func() { _, cancelErr = s.CancelJob(fmt.Sprintf("cancelled-%d", i)) },
+				)
+				if failErr != nil {
+					t.Fatalf("FailNodeExecutions: %v", failErr)
+				}
+				if cancelErr != nil {
+					t.Fatalf("CancelJob: %v", cancelErr)
+				}
+
+				// Each execution ends one way, and the node's report names
+				// exactly the jobs whose executions it failed
+				reported := make(map[string]bool)
+				for _, jobID := range jobIDs {
+					reported[jobID] = true
+				}
+				for _, id := range []string{cancelled, lost} {
+					exec, err := s.GetJobExecution(id)
+					if err != nil {
+						t.Fatalf("GetJobExecution: %v", err)
+					}
+					failed := exec.Status == models.JobStatusFailed && exec.ErrorClass == models.ErrorClassNodeLost
+					if !failed && exec.Status != models.JobStatusCancelled {
+						t.Errorf("round %d: execution %s is %s, want failed or cancelled", i, id, exec.Status)
+					}
+					if failed != reported[exec.JobID] {
+						t.Errorf("round %d: execution %s is %s but FailNodeExecutions returned %v",
+							i, id, exec.Status, jobIDs)
+					}
+				}
+				if !reported[fmt.Sprintf("lost-%d", i)] {
+					t.Errorf("round %d: FailNodeExecutions returned %v, want the uncancelled job", i, jobIDs)
+				}
+			}
+			if n := activeExecutions(t, s, "node-a"); n != 0 {
+				t.Errorf("node-a has %d active executions after they all failed, want 0", n)
+			}
+		})
+	}
+}
+
+func TestTimeOutOverrunRacesFinish(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			registerNode(t, s, "node-a", raceRounds)
+
+			for i := 0; i < raceRounds; i++ {
+				job := newJob(fmt.Sprintf("job-%d", i), time.Now())
+				job.TimeoutSeconds = 60
+				id := schedule(t, s, job, "node-a")[0]
+				if _, err := s.ClaimJobExecution(id, "node-a", time.Hour); err != nil {
+					t.Fatalf("ClaimJobExecution: %v", err)
+				}
+				if err := s.StartJobExecution(id, "node-a"); err != nil {
+					t.Fatalf("StartJobExecution: %v", err)
+				}
+				backdate(t, s, id, 5*time.Minute)
+
+				var nodeIDs []string
+				var timeOutErr, finishErr error
+				race(
+					func() { nodeIDs, timeOutErr = s.TimeOutOverrunExecutions(time.Minute, time.Minute) },
+					func() {
+						finishErr = s.FinishJobExecution(&models.JobExecution{
+							ID: id, NodeID: "node-a", Status: models.JobStatusCompleted, CompletedAt: timePtr(time.Now()),
+						})
+					},
+				)
+				if timeOutErr != nil {
+					t.Fatalf("TimeOutOverrunExecutions: %v", timeOutErr)
+				}
+				if finishErr != nil && finishErr != ErrLeaseNotHeld {
+					t.Fatalf("FinishJobExecution: %v", finishErr)
+				}
+
+				// Exactly one of them ends the execution
+				timedOut := len(nodeIDs) == 1
+				if timedOut == (finishErr == nil) {
+					t.Fatalf("round %d: timed out %v and finish returned %v", i, nodeIDs, finishErr)
+				}
+				exec, err := s.GetJobExecution(id)
+				if err != nil {
+					t.Fatalf("GetJobExecution: %v", err)
+				}
+				want := models.JobStatusCompleted
+				if timedOut {
+					want = models.JobStatusFailed
+				}
+				if exec.Status != want {
+					t.Errorf("round %d: execution is %s, want %s", i, exec.Status, want)
+				}
+			}
+			if n := activeExecutions(t, s, "node-a"); n != 0 {
+				t.Errorf("node-a has %d active executions after they all ended, want 0", n)
+			}
+		})
+	}
+}
+
+func TestTakeNodeOffline(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			registerNode(t, s, "fresh", 2)
+			err := s.RegisterNode(&models.Node{
+				ID: "stale", Name: "stale", CPUCores: 8, MemoryGB: 16, Status: models.NodeStatusOnline,
+				ReputationScore: 100, LastHeartbeat: now.Add(-5 * time.Minute), RegisteredAt: now, MaxSlots: 2,
+			})
+			if err != nil {
+				t.Fatalf("RegisterNode: %v", err)
+			}
+			running := scheduleOn(t, s, "running", "stale", 0, now)
+			waiting := scheduleOn(t, s, "waiting", "stale", 0, now)
+			if _, err := s.ClaimJobExecution(running, "stale", time.Minute); err != nil {
+				t.Fatalf("ClaimJobExecution: %v", err)
+			}
+
+			staleBefore := now.Add(-2 * time.Minute)
+			if _, err := s.TakeNodeOffline("fresh", staleBefore, 20, "Node went offline"); err != sql.ErrNoRows {
+				t.Errorf("TakeNodeOffline on a node with a recent heartbeat returned %v, want sql.ErrNoRows", err)
+			}
+
+			jobIDs, err := s.TakeNodeOffline("stale", staleBefore, 20, "Node went offline")
+			if err != nil {
+				t.Fatalf("TakeNodeOffline: %v", err)
+			}
+			if strings.Join(jobIDs, ",") != "running,waiting" {
+				t.Errorf("TakeNodeOffline returned jobs %v, want [running waiting]", jobIDs)
+			}
+			node, err := s.GetNode("stale")
+			if err != nil {
+				t.Fatalf("GetNode: %v", err)
+			}
+			if node.Status != models.NodeStatusOffline || node.ReputationScore != 80 || node.ActiveExecutions != 0 {
+				t.Errorf("stale node is %s with reputation %.0f and %d active executions, want offline, 80, 0",
+					node.Status, node.ReputationScore, node.ActiveExecutions)
+			}
+			for _, id := range []string{running, waiting} {
+				exec, err := s.GetJobExecution(id)
+				if err != nil {
+					t.Fatalf("GetJobExecution: %v", err)
+				}
+				if exec.Status != models.JobStatusFailed || exec.ErrorClass != models.ErrorClassNodeLost {
+					t.Errorf("execution %s is %s (%s), want failed as node_lost", id, exec.Status, exec.ErrorClass)
+				}
+			}
+
+			// Once offline, it isn't taken offline and penalized again
+			if _, err := s.TakeNodeOffline("stale", staleBefore, 20, "Node went offline"); err != sql.ErrNoRows {
+				t.Errorf("TakeNodeOffline on an offline node returned %v, want sql.ErrNoRows", err)
+			}
+		})
+	}
+}
+
+func TestQuarantineNode(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			registerNode(t, s, "node-a", 2)
+			registerNode(t, s, "node-b", 2)
+			id := scheduleOn(t, s, "job", "node-a", 0, time.Now())
+			if _, err := s.ClaimJobExecution(id, "node-a", time.Minute); err != nil {
+				t.Fatalf("ClaimJobExecution: %v", err)
+			}
+
+			jobIDs, err := s.QuarantineNode("node-a", "Node quarantined")
+			if err != nil {
+				t.Fatalf("QuarantineNode: %v", err)
+			}
+			if len(jobIDs) != 1 || jobIDs[0] != "job" {
+				t.Errorf("QuarantineNode returned jobs %v, want [job]", jobIDs)
+			}
+			node, _ := s.GetNode("node-a")
+			if node.Status != models.NodeStatusFaulty || node.ActiveExecutions != 0 {
+				t.Errorf("quarantined node is %s with %d active executions, want faulty with 0",
+					node.Status, node.ActiveExecutions)
+			}
+
+			// A collusion flag that doesn't call for quarantine leaves the
+			// node alone; one that does quarantines it with the flag
+			flag := &models.NodeFlag{
+				ID: "flag-1", NodeID: "node-b", Signal: models.SignalRegistrationPattern,
+				Explanation: "Registered with others", FlaggedAt: time.Now(),
+			}
+			if _, err := s.FlagNode(flag); err != nil {
+				t.Fatalf("FlagNode: %v", err)
+			}
+			if node, _ := s.GetNode("node-b"); node.Status != models.NodeStatusOnline {
+				t.Errorf("flagged node is %s, want online", node.Status)
+			}
+			flag.ID, flag.Signal, flag.Quarantined = "flag-2", models.SignalVotingBloc, true
+			if _, err := s.FlagNode(flag); err != nil {
+				t.Fatalf("FlagNode: %v", err)
+			}
+			if node, _ := s.GetNode("node-b"); node.Status != models.NodeStatusFaulty {
+				t.Errorf("node flagged for quarantine is %s, want faulty", node.Status)
+			}
+
+			// Nothing is recorded for a node that doesn't exist
+			flag.ID, flag.NodeID = "flag-3", "missing"
+			if _, err := s.FlagNode(flag); err != sql.ErrNoRows {
+				t.Errorf("FlagNode on a missing node returned %v, want sql.ErrNoRows", err)
+			}
+			flags, err := s.GetNodeFlags("missing")
+			if err != nil {
+				t.Fatalf("GetNodeFlags: %v", err)
+			}
+			if len(flags) != 0 {
+				t.Errorf("missing node has %d flags after a failed quarantine, want 0", len(flags))
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+	log "github.com/sirupsen/logrus"
+)
+
+// trustedReputation is the reputation a node needs before an adaptive job
+// relies on it without extra replicas. New nodes start at 100 and gain 5 per
+// result that matches consensus.
+const trustedReputation = 150.0
+
+func allTrusted(nodes []*models.Node) bool {
+	for _, node := range nodes {
+		if node.ReputationScore < trustedReputation {
+			return false
+		}
+	}
+	return true
+}
+
+// redundancyLimit is the most executions job may have, tie-breakers and
+// adaptive escalation included. Jobs without an explicit max_redundancy may
+// grow by the coordinator's tie-breaker budget.
+func (s *Scheduler) redundancyLimit(job *models.Job) int {
+	limit := job.MaxRedundancy
+	if limit == 0 {
+		limit = job.Redundancy - job.TieBreakers + s.maxTieBreakers
+	}
+	if limit > models.MaxRedundancy {
+		limit = models.MaxRedundancy
+	}
+	return limit
+}
+
+// escalate raises an adaptive job's redundancy so that, besides the replicas
+// consensus needs and any tie-breakers, it has one extra execution for every
+// replica that failed and for every replica on a node that isn't trusted,
+// e.g. because its reputation dropped after the job was scheduled.
+// Redundancy never goes down.
+func (s *Scheduler) escalate(job *models.Job, executions []*models.JobExecution) {
+	failed, untrusted := 0, 0
+	for _, exec := range executions {
+		if exec.ErrorClass.IsLost() || exec.Status == models.JobStatusCancelled {
+			continue
+		}
+		if exec.Status == models.JobStatusFailed {
+			failed++
+			continue
+		}
+		node, err := s.db.GetNode(exec.NodeID)
+		if err != nil {
+			log.Warnf("Failed to get node %s: %v", exec.NodeID, err)
+			continue
+		}
+		if node.ReputationScore < trustedReputation {
+			untrusted++
+		}
+	}
+
+	desired := job.Consensus + job.TieBreakers + failed + untrusted
+	if limit := s.redundancyLimit(job); desired > limit {
+		desired = limit
+	}
+	if desired <= job.Redundancy {
+		return
+	}
+
+	err := s.db.SetJobRedundancy(job.ID, desired)
+	switch {
+	case err == sql.ErrNoRows:
+		// Finished since it was listed
+		return
+	case errors.Is(err, repository.ErrLocked):
+		log.Infof("Job %s is locked, will escalate it later: %v", job.ID, err)
+		return
+	case err != nil:
+		log.Errorf("Failed to escalate job %s: %v", job.ID, err)
+		return
+	}
+
+	log.Warnf("Job %s has %d failed replica(s) and %d on untrusted nodes, escalating redundancy %d -> %d",
+		job.ID, failed, untrusted, job.Redundancy, desired)
+	job.Redundancy = desired
+}
+
+// failureBudget is how many of job's executions may fail before it can no
+// longer reach consensus. Adaptive jobs start with fewer replicas than they
+// may grow to and replace failed ones, so their budget is set by their limit.
+func (s *Scheduler) failureBudget(job *models.Job) int {
+	if job.Adaptive {
+		return s.redundancyLimit(job) - job.Consensus
+	}
+	return job.Redundancy - job.Consensus
+}
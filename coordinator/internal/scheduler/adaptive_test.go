@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+	"github.com/HildaPosada/distributeai/coordinator/internal/verification"
+)
+
+func newTestScheduler(t *testing.T, db repository.Store) *Scheduler {
+	t.Helper()
+	placement, err := NewPlacement(models.PlacementReputation)
+	if err != nil {
+		t.Fatalf("NewPlacement: %v", err)
+	}
+	return NewScheduler(db, verification.NewVerifier(db), 2, 0, placement, time.Hour, 0,
+		models.TrustLevelPolicies[models.TrustLevelStandard])
+}
+
+// registerTrusted registers online single-slot nodes that adaptive jobs trust
+func registerTrusted(t *testing.T, db repository.Store, ids ...string) {
+	t.Helper()
+	now := time.Now()
+	for _, id := range ids {
+		err := db.RegisterNode(&models.Node{
+			ID: id, Name: id, CPUCores: 4, MemoryGB: 8, Status: models.NodeStatusOnline,
+			ReputationScore: trustedReputation + 50, LastHeartbeat: now, RegisteredAt: now, MaxSlots: 1,
+		})
+		if err != nil {
+			t.Fatalf("RegisterNode(%s): %v", id, err)
+		}
+	}
+}
+
+// failOutstanding claims and fails the job's first scheduled execution,
+// returning its node
+func failOutstanding(t *testing.T, db repository.Store, jobID string) string {
+	t.Helper()
+	executions, err := db.GetJobExecutions(jobID)
+	if err != nil {
+		t.Fatalf("GetJobExecutions: %v", err)
+	}
+	for _, exec := range executions {
+		if exec.Status != models.JobStatusScheduled {
+			continue
+		}
+		if _, err := db.ClaimJobExecution(exec.ID, exec.NodeID, time.Minute); err != nil {
+			t.Fatalf("ClaimJobExecution: %v", err)
+		}
+		now := time.Now()
+		exec.Status, exec.CompletedAt, exec.ErrorMessage = models.JobStatusFailed, &now, "exit code 1"
+		if err := db.FinishJobExecution(exec); err != nil {
+			t.Fatalf("FinishJobExecution: %v", err)
+		}
+		return exec.NodeID
+	}
+	t.Fatalf("job %s has no scheduled execution to fail", jobID)
+	return ""
+}
+
+func TestAdaptiveJobReplacesFailedReplica(t *testing.T) {
+	db := repository.NewMemoryStore()
+	s := newTestScheduler(t, db)
+	registerTrusted(t, db, "node-a", "node-b", "node-c")
+
+	job := &models.Job{
+		ID: "adaptive", Name: "adaptive", DockerImage: "alpine:3", Command: []string{"true"},
+		RequiredCPU: 1, RequiredMemory: 1, Redundancy: 3, Consensus: 2, TimeoutSeconds: 60,
+		Adaptive: true, MaxRedundancy: 3, Status: models.JobStatusPending, SubmittedAt: time.Now(),
+	}
+	if err := db.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	if err := s.scheduleJob(job); err != nil {
+		t.Fatalf("scheduleJob: %v", err)
+	}
+
+	stored, _ := db.GetJob(job.ID)
+	if stored.Status != models.JobStatusScheduled || stored.Redundancy != 2 {
+		t.Fatalf("adaptive job is %s with redundancy %d, want scheduled with 2 trusted replicas",
+			stored.Status, stored.Redundancy)
+	}
+
+	// The first failure is replaced by a replica on the spare node, up to the
+	// job's max_redundancy, instead of failing the job
+	failOutstanding(t, db, job.ID)
+	s.checkRunningJobs()
+
+	stored, _ = db.GetJob(job.ID)
+	if stored.Status.IsFinished() {
+		t.Fatalf("adaptive job %s after its first failed replica: %s", stored.Status, stored.ErrorMessage)
+	}
+	if stored.Redundancy != 3 {
+		t.Errorf("adaptive job redundancy = %d after a failure, want 3", stored.Redundancy)
+	}
+	executions, _ := db.GetJobExecutions(job.ID)
+	scheduled := 0
+	for _, exec := range executions {
+		if exec.Status == models.JobStatusScheduled {
+			scheduled++
+		}
+	}
+	if len(executions) != 3 || scheduled != 2 {
+		t.Fatalf("adaptive job has %d executions, %d scheduled; want 3, 2", len(executions), scheduled)
+	}
+
+	// A second failure leaves too few replicas to agree even at the limit
+	failOutstanding(t, db, job.ID)
+	s.checkRunningJobs()
+
+	stored, _ = db.GetJob(job.ID)
+	if stored.Status != models.JobStatusFailed {
+		t.Fatalf("adaptive job is %s after failures exhausted max_redundancy, want failed", stored.Status)
+	}
+	executions, _ = db.GetJobExecutions(job.ID)
+	for _, exec := range executions {
+		if exec.Status == models.JobStatusScheduled || exec.Status == models.JobStatusRunning {
+			t.Errorf("execution %s on %s still %s after the job failed", exec.ID, exec.NodeID, exec.Status)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/normalize"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// canaryPenalty is the reputation a node loses for a wrong spot-check answer.
+// Unlike a consensus disagreement there is no doubt about the right result,
+// so it is far steeper than the usual -10.
+const canaryPenalty = 50.0
+
+// scheduleNextCanary picks when the next spot check is injected, jittered
+// around the configured interval so workers can't predict it
+func (s *Scheduler) scheduleNextCanary(now time.Time) {
+	if s.canaryInterval <= 0 {
+		return
+	}
+	jitter := time.Duration(rand.Int63n(int64(s.canaryInterval)))
+	s.nextCanary = now.Add(s.canaryInterval/2 + jitter)
+}
+
+// maybeInjectCanary runs a spot check when one is due
+func (s *Scheduler) maybeInjectCanary() {
+	now := time.Now()
+	if s.canaryInterval <= 0 || now.Before(s.nextCanary) {
+		return
+	}
+	s.scheduleNextCanary(now)
+
+	if err := s.injectCanary(); err != nil {
+		log.Errorf("Failed to inject spot check: %v", err)
+	}
+}
+
+// injectCanary schedules a random known-answer workload from the catalog on
+// random available nodes. It is submitted with the defaults of a job that asks
+// for nothing in particular and scheduled the same way, so the nodes can't
+// tell it apart from real work.
+func (s *Scheduler) injectCanary() error {
+	canaries, err := s.db.GetEnabledCanaries()
+	if err != nil {
+		return fmt.Errorf("failed to get canaries: %w", err)
+	}
+	if len(canaries) == 0 {
+		return nil
+	}
+	canary := canaries[rand.Intn(len(canaries))]
+
+	job := &models.Job{
+		ID:              uuid.New().String(),
+		Name:            canary.Name,
+		Description:     canary.Description,
+		DockerImage:     canary.DockerImage,
+		Command:         canary.Command,
+		Environment:     canary.Environment,
+		InputData:       canary.InputData,
+		RequiredCPU:     canary.RequiredCPU,
+		RequiredMemory:  canary.RequiredMemory,
+		TimeoutSeconds:  canary.TimeoutSeconds,
+		OutputFile:      canary.OutputFile,
+		Normalize:       canary.Normalize,
+		Spread:          models.DefaultSpread(),
+		Redundancy:      s.defaultPolicy.Redundancy,
+		Consensus:       s.defaultPolicy.Consensus,
+		Status:          models.JobStatusPending,
+		SubmittedBy:     "user",
+		SubmittedAt:     time.Now(),
+		CreditsRequired: 1,
+		CanaryID:        canary.ID,
+	}
+
+	nodes, err := s.db.GetAvailableNodes(job.RequiredCPU, job.RequiredMemory, job.RequiredGPU)
+	if err != nil {
+		return fmt.Errorf("failed to get available nodes: %w", err)
+	}
+	// Tainted nodes are kept out of spot checks as they are out of other
+	// untolerating jobs, so a canary doesn't stand out there
+	nodes = admittedNodes(job, nodes, time.Now())
+	rand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+	nodes, _ = placeReplicas(job, nodes, nil, job.Redundancy, time.Now())
+	if len(nodes) < job.Redundancy {
+		log.Debugf("Not enough nodes available for spot check %s", canary.ID)
+		return nil
+	}
+
+	if err := s.db.CreateJob(job); err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+
+	// Scheduled like any other job; one that loses its nodes meanwhile stays
+	// pending and is picked up by the scheduling loop
+	err = s.db.ScheduleJob(job.ID, newExecutions(job, nodes))
+	switch {
+	case errors.Is(err, repository.ErrLocked), errors.Is(err, repository.ErrNoCapacity):
+		log.Infof("Spot check %s not scheduled, will retry: %v", job.ID, err)
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to schedule job: %w", err)
+	}
+
+	log.Infof("Spot check %s (canary %s) scheduled on %d nodes", job.ID, canary.ID, len(nodes))
+	return nil
+}
+
+// auditCanary checks the completed executions of a spot-check job against the
+// catalog's known answer. Nodes that got it right are rewarded like any
+// consensus vote; a node that got it wrong is penalized and quarantined. The
+// verdict and the rewards are saved together.
+func (s *Scheduler) auditCanary(job *models.Job, executions []*models.JobExecution) {
+	canary, err := s.db.GetCanary(job.CanaryID)
+	if err != nil {
+		log.Errorf("Failed to get canary %s for job %s: %v", job.CanaryID, job.ID, err)
+		return
+	}
+
+	outcome := &models.JobOutcome{Status: models.JobStatusCompleted}
+	var failedNodes []string
+	for _, exec := range executions {
+		if exec.Status != models.JobStatusCompleted {
+			continue
+		}
+
+		// The worker normalized the result with the canary's rules already;
+		// hash it rather than trust the worker's hash
+		if normalize.Hash(exec.Result) == canary.ExpectedHash {
+			outcome.Result = exec.Result
+			outcome.Rewards = append(outcome.Rewards,
+				models.NodeReward{NodeID: exec.NodeID, Reputation: 5.0, Success: true, Credits: 1})
+			continue
+		}
+
+		log.Warnf("Node %s failed spot check %s (canary %s)", exec.NodeID, job.ID, canary.ID)
+		failedNodes = append(failedNodes, exec.NodeID)
+		outcome.Rewards = append(outcome.Rewards, models.NodeReward{NodeID: exec.NodeID, Reputation: -canaryPenalty})
+	}
+
+	if len(failedNodes) > 0 {
+		outcome.Status = models.JobStatusFailed
+		outcome.Result = ""
+		outcome.ErrorMessage = fmt.Sprintf("Spot check failed: wrong answer from node %s", failedNodes[0])
+	}
+	if err := s.db.FinalizeJob(job.ID, outcome); err != nil {
+		// Another coordinator audited it first, or it was stopped meanwhile
+		log.Infof("Spot check %s not finalized: %v", job.ID, err)
+		return
+	}
+
+	for _, nodeID := range failedNodes {
+		s.quarantineNode(nodeID)
+	}
+}
+
+// quarantineNode marks a node faulty so it gets no more work until an admin
+// reinstates it, and moves its outstanding executions to other nodes
+func (s *Scheduler) quarantineNode(nodeID string) {
+	jobIDs, err := s.db.QuarantineNode(nodeID, "Node quarantined")
+	if err != nil {
+		log.Errorf("Failed to quarantine node %s: %v", nodeID, err)
+		return
+	}
+	log.Warnf("Node %s quarantined", nodeID)
+
+	s.replaceNodeExecutions(nodeID, jobIDs, "Node quarantined")
+}
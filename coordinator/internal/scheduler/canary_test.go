@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/normalize"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+)
+
+func TestCanaryAcceptsResultNormalizedByWorker(t *testing.T) {
+	db := repository.NewMemoryStore()
+	s := newTestScheduler(t, db)
+	registerTrusted(t, db, "node-a", "node-b", "node-c")
+
+	// Stripping "ab" isn't idempotent: the worker turns "aabb" into "ab",
+	// which a second pass would turn into ""
+	rules := []models.NormalizationRule{{Type: models.NormalizeStripRegex, Pattern: "ab"}}
+	expected, err := normalize.Apply("aabb", rules)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	err = db.CreateCanary(&models.Canary{
+		ID: "canary-1", Name: "build", DockerImage: "alpine:3", Command: []string{"echo", "aabb"},
+		RequiredCPU: 1, RequiredMemory: 1, TimeoutSeconds: 60, Normalize: rules,
+		ExpectedHash: normalize.Hash(expected), Enabled: true, CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("CreateCanary: %v", err)
+	}
+
+	if err := s.injectCanary(); err != nil {
+		t.Fatalf("injectCanary: %v", err)
+	}
+	jobs, err := db.GetActiveJobs()
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("GetActiveJobs = %d jobs, %v; want the spot check", len(jobs), err)
+	}
+	executions, err := db.GetJobExecutions(jobs[0].ID)
+	if err != nil || len(executions) != 3 {
+		t.Fatalf("GetJobExecutions = %d executions, %v; want 3", len(executions), err)
+	}
+
+	// The workers report the output after normalizing it once
+	for _, exec := range executions {
+		if _, err := db.ClaimJobExecution(exec.ID, exec.NodeID, time.Minute); err != nil {
+			t.Fatalf("ClaimJobExecution: %v", err)
+		}
+		now := time.Now()
+		exec.Status, exec.CompletedAt = models.JobStatusCompleted, &now
+		exec.Result, exec.ResultHash = expected, normalize.Hash(expected)
+		if err := db.FinishJobExecution(exec); err != nil {
+			t.Fatalf("FinishJobExecution: %v", err)
+		}
+	}
+
+	s.checkRunningJobs()
+
+	job, _ := db.GetJob(jobs[0].ID)
+	if job.Status != models.JobStatusCompleted || job.Result != expected {
+		t.Errorf("spot check %s with result %q, want completed with %q (%s)",
+			job.Status, job.Result, expected, job.ErrorMessage)
+	}
+	for _, id := range []string{"node-a", "node-b", "node-c"} {
+		node, _ := db.GetNode(id)
+		if node.Status == models.NodeStatusFaulty || node.ReputationScore < trustedReputation+50 {
+			t.Errorf("honest node %s is %s with reputation %.0f after a correct spot check",
+				id, node.Status, node.ReputationScore)
+		}
+	}
+}
+
+func TestCanaryLooksLikeSubmittedJob(t *testing.T) {
+	db := repository.NewMemoryStore()
+	s := newTestScheduler(t, db)
+	err := db.CreateCanary(&models.Canary{
+		ID: "canary-1", Name: "build", DockerImage: "alpine:3", Command: []string{"echo", "ok"},
+		RequiredCPU: 1, RequiredMemory: 1, TimeoutSeconds: 60,
+		ExpectedHash: normalize.Hash("ok"), Enabled: true, CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("CreateCanary: %v", err)
+	}
+
+	// Too few nodes for the default policy: nothing is left behind
+	registerTrusted(t, db, "node-a", "node-b")
+	if err := s.injectCanary(); err != nil {
+		t.Fatalf("injectCanary: %v", err)
+	}
+	if jobs, _ := db.GetActiveJobs(); len(jobs) != 0 {
+		t.Fatalf("spot check without enough nodes left %d active jobs", len(jobs))
+	}
+	if jobs, _ := db.GetPendingJobs(); len(jobs) != 0 {
+		t.Fatalf("spot check without enough nodes left %d pending jobs", len(jobs))
+	}
+
+	registerTrusted(t, db, "node-c")
+	if err := s.injectCanary(); err != nil {
+		t.Fatalf("injectCanary: %v", err)
+	}
+	jobs, err := db.GetActiveJobs()
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("GetActiveJobs = %d jobs, %v; want the spot check", len(jobs), err)
+	}
+	job := jobs[0]
+
+	policy := s.defaultPolicy
+	if job.Redundancy != policy.Redundancy || job.Consensus != policy.Consensus {
+		t.Errorf("spot check is %d-of-%d, want the default %d-of-%d",
+			job.Consensus, job.Redundancy, policy.Consensus, policy.Redundancy)
+	}
+	if !reflect.DeepEqual(job.Spread, models.DefaultSpread()) {
+		t.Errorf("spot check spread = %+v, want the default %+v", job.Spread, models.DefaultSpread())
+	}
+	executions, err := db.GetJobExecutions(job.ID)
+	if err != nil || len(executions) != policy.Redundancy {
+		t.Fatalf("GetJobExecutions = %d executions, %v; want %d", len(executions), err, policy.Redundancy)
+	}
+	nodes := make(map[string]bool)
+	for _, exec := range executions {
+		nodes[exec.NodeID] = true
+	}
+	if len(nodes) != policy.Redundancy {
+		t.Errorf("spot check placed on %d distinct nodes, want %d", len(nodes), policy.Redundancy)
+	}
+}
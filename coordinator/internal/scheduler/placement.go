@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/selector"
+	log "github.com/sirupsen/logrus"
+)
+
+// spreadValue returns a node's value in a spread domain, or "" if it didn't
+// report one. Nodes without a value are never taken to share a domain.
+func spreadValue(node *models.Node, domain models.SpreadDomain) string {
+	switch domain {
+	case models.SpreadOwner:
+		return node.Owner
+	case models.SpreadRegion:
+		return node.Region
+	case models.SpreadHost:
+		return node.Host
+	default:
+		return ""
+	}
+}
+
+// admits reports whether job may be placed on node now, and if not why: the
+// node must pass the job's selectors and taints, and have no maintenance
+// window before a full run would finish
+func admits(job *models.Job, node *models.Node, now time.Time) (bool, string) {
+	if node.InMaintenance(now, now.Add(time.Duration(job.TimeoutSeconds)*time.Second)) {
+		return false, "maintenance window ahead"
+	}
+	return selector.Admits(job, node)
+}
+
+// admittedNodes returns the nodes job may be placed on now, in order
+func admittedNodes(job *models.Job, nodes []*models.Node, now time.Time) []*models.Node {
+	var admitted []*models.Node
+	for _, node := range nodes {
+		if ok, _ := admits(job, node, now); ok {
+			admitted = append(admitted, node)
+		}
+	}
+	return admitted
+}
+
+// canRelaxSpread reports whether job may give up spread domains to be placed
+func canRelaxSpread(job *models.Job, now time.Time) bool {
+	if job.Spread.Mode == models.SpreadStrict {
+		return false
+	}
+	relaxAt := job.SubmittedAt.Add(time.Duration(job.Spread.RelaxAfterSeconds) * time.Second)
+	return !now.Before(relaxAt)
+}
+
+// placeReplicas picks up to count nodes from candidates, which are ordered
+// best first, so that no two of the job's replicas share a value in any of its
+// spread domains, including replicas already placed. If the job may relax its
+// spread, domains are dropped from last to first until count nodes are found.
+// It returns the nodes and the domains that were still enforced.
+func placeReplicas(job *models.Job, candidates, placed []*models.Node, count int, now time.Time) ([]*models.Node, []models.SpreadDomain) {
+	domains := job.Spread.Domains
+	relax := canRelaxSpread(job, now)
+
+	var selected []*models.Node
+	for {
+		selected = append(selected, pickSpread(candidates, append(placed, selected...), domains, count-len(selected))...)
+		if len(selected) >= count || !relax || len(domains) == 0 {
+			return selected, domains
+		}
+		domains = domains[:len(domains)-1]
+	}
+}
+
+// pickSpread takes up to count candidates, in order, that share no domain
+// value with the taken nodes or each other
+func pickSpread(candidates, taken []*models.Node, domains []models.SpreadDomain, count int) []*models.Node {
+	used := make(map[models.SpreadDomain]map[string]bool)
+	takenIDs := make(map[string]bool)
+	mark := func(node *models.Node) {
+		takenIDs[node.ID] = true
+		for _, domain := range domains {
+			if used[domain] == nil {
+				used[domain] = make(map[string]bool)
+			}
+			if value := spreadValue(node, domain); value != "" {
+				used[domain][value] = true
+			}
+		}
+	}
+	for _, node := range taken {
+		mark(node)
+	}
+
+	var picked []*models.Node
+	for _, node := range candidates {
+		if len(picked) == count {
+			break
+		}
+		if takenIDs[node.ID] || conflicts(node, domains, used) {
+			continue
+		}
+		picked = append(picked, node)
+		mark(node)
+	}
+	return picked
+}
+
+func conflicts(node *models.Node, domains []models.SpreadDomain, used map[models.SpreadDomain]map[string]bool) bool {
+	for _, domain := range domains {
+		if value := spreadValue(node, domain); value != "" && used[domain][value] {
+			return true
+		}
+	}
+	return false
+}
+
+// replicaNodes returns the nodes holding job's live or completed replicas,
+// which new replicas must be spread away from
+func (s *Scheduler) replicaNodes(executions []*models.JobExecution) []*models.Node {
+	var nodes []*models.Node
+	for _, exec := range executions {
+		switch exec.Status {
+		case models.JobStatusScheduled, models.JobStatusRunning, models.JobStatusCompleted:
+		default:
+			continue
+		}
+		node, err := s.db.GetNode(exec.NodeID)
+		if err != nil {
+			log.Warnf("Failed to get node %s: %v", exec.NodeID, err)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// logRelaxedSpread notes when a job's replicas had to share spread domains
+func logRelaxedSpread(job *models.Job, enforced []models.SpreadDomain) {
+	if len(enforced) < len(job.Spread.Domains) {
+		log.Warnf("Job %s: relaxed spread over %v to place its replicas", job.ID, job.Spread.Domains[len(enforced):])
+	}
+}
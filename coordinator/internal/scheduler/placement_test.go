@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+func TestPlaceReplicasTreatsMissingDomainAsDistinct(t *testing.T) {
+	now := time.Now()
+	job := &models.Job{
+		ID:          "job-1",
+		Spread:      models.SpreadPolicy{Domains: models.DefaultSpreadDomains, Mode: models.SpreadStrict},
+		SubmittedAt: now,
+	}
+
+	tests := []struct {
+		name    string
+		regions []string
+		placed  int
+	}{
+		{"unset", []string{"", "", ""}, 3},
+		{"shared", []string{"us-west", "us-west", "eu-west"}, 2},
+	}
+
+	for _, tt := range tests {
+		var candidates []*models.Node
+		for i, region := range tt.regions {
+			candidates = append(candidates, &models.Node{
+				ID: string(rune('a' + i)), Owner: string(rune('a' + i)), Region: region,
+			})
+		}
+
+		selected, enforced := placeReplicas(job, candidates, nil, 3, now)
+		if len(selected) != tt.placed {
+			t.Errorf("%s regions: placed %d replicas, want %d", tt.name, len(selected), tt.placed)
+		}
+		if len(enforced) != len(job.Spread.Domains) {
+			t.Errorf("%s regions: spread relaxed to %v", tt.name, enforced)
+		}
+	}
+}
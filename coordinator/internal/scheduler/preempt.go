@@ -0,0 +1,180 @@
+package scheduler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+	log "github.com/sirupsen/logrus"
+)
+
+// eviction is the set of executions that must leave a node to fit a job
+type eviction struct {
+	node       *models.Node
+	executions []*models.JobExecution
+	worst      int // Highest priority among the evicted jobs
+}
+
+// preemptFor revokes executions of lower-priority jobs so that job fits on
+// needed more nodes, spread away from the nodes already picked for it. Each
+// node gives up its lowest-priority, least-advanced executions first, and
+// only as many as the job needs room for; nodes costing the least important
+// work are used first. Nothing is revoked unless the job can then be placed
+// in full. It returns how many executions were preempted.
+func (s *Scheduler) preemptFor(job *models.Job, placed []*models.Node, needed int, now time.Time) int {
+	if job.Priority < s.preemptPriority || needed <= 0 {
+		return 0
+	}
+
+	victims, err := s.db.GetPreemptibleExecutions(job.Priority)
+	if err != nil {
+		log.Errorf("Failed to get preemptible executions: %v", err)
+		return 0
+	}
+	if len(victims) == 0 {
+		return 0
+	}
+
+	jobs, err := s.victimJobs(victims)
+	if err != nil {
+		log.Errorf("Failed to get jobs of preemptible executions: %v", err)
+		return 0
+	}
+	byNode := make(map[string][]*models.JobExecution)
+	for _, exec := range victims {
+		if jobs[exec.JobID] != nil {
+			byNode[exec.NodeID] = append(byNode[exec.NodeID], exec)
+		}
+	}
+
+	nodes, err := s.db.GetLiveNodes(job.RequiredCPU, job.RequiredMemory, job.RequiredGPU)
+	if err != nil {
+		log.Errorf("Failed to get nodes: %v", err)
+		return 0
+	}
+	nodes = admittedNodes(job, nodes, now)
+
+	taken := make(map[string]bool)
+	for _, node := range placed {
+		taken[node.ID] = true
+	}
+	var evictions []*eviction
+	for _, node := range nodes {
+		if taken[node.ID] || len(byNode[node.ID]) == 0 {
+			continue
+		}
+		if ev := planEviction(job, node, byNode[node.ID], jobs); ev != nil {
+			evictions = append(evictions, ev)
+		}
+	}
+	sort.SliceStable(evictions, func(i, j int) bool {
+		if evictions[i].worst != evictions[j].worst {
+			return evictions[i].worst < evictions[j].worst
+		}
+		return len(evictions[i].executions) < len(evictions[j].executions)
+	})
+
+	candidates := make([]*models.Node, len(evictions))
+	byID := make(map[string]*eviction)
+	for i, ev := range evictions {
+		candidates[i] = ev.node
+		byID[ev.node.ID] = ev
+	}
+	chosen, _ := placeReplicas(job, candidates, placed, needed, now)
+	if len(chosen) < needed {
+		log.Debugf("Job %s: preempting lower-priority work would free only %d of %d nodes", job.ID, len(chosen), needed)
+		return 0
+	}
+
+	preempted := 0
+	reason := fmt.Sprintf("Preempted by job %s (priority %d)", job.ID, job.Priority)
+	for _, node := range chosen {
+		for _, exec := range byID[node.ID].executions {
+			err := s.db.PreemptJobExecution(exec.ID, reason)
+			if err == sql.ErrNoRows {
+				continue // Finished meanwhile, which freed the room anyway
+			}
+			if errors.Is(err, repository.ErrLocked) {
+				log.Debugf("Execution %s is being updated, not preempted this round", exec.ID)
+				continue
+			}
+			if err != nil {
+				log.Errorf("Failed to preempt execution %s: %v", exec.ID, err)
+				continue
+			}
+			preempted++
+			log.Warnf("Preempted execution %s of job %s (priority %d) on node %s for job %s (priority %d)",
+				exec.ID, exec.JobID, jobs[exec.JobID].Priority, node.ID, job.ID, job.Priority)
+		}
+	}
+	return preempted
+}
+
+// victimJobs loads the jobs of the given executions by ID
+func (s *Scheduler) victimJobs(executions []*models.JobExecution) (map[string]*models.Job, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, exec := range executions {
+		if !seen[exec.JobID] {
+			seen[exec.JobID] = true
+			ids = append(ids, exec.JobID)
+		}
+	}
+
+	jobs, err := s.db.GetJobs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.Job, len(jobs))
+	for _, job := range jobs {
+		byID[job.ID] = job
+	}
+	return byID, nil
+}
+
+// planEviction picks the executions node must give up for job to fit, or
+// returns nil if evicting every candidate still wouldn't make room. Unclaimed
+// executions go first since no work is lost, then the most recently claimed.
+func planEviction(job *models.Job, node *models.Node, candidates []*models.JobExecution, jobs map[string]*models.Job) *eviction {
+	ordered := append([]*models.JobExecution(nil), candidates...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if pa, pb := jobs[a.JobID].Priority, jobs[b.JobID].Priority; pa != pb {
+			return pa < pb
+		}
+		if (a.ClaimedAt == nil) != (b.ClaimedAt == nil) {
+			return a.ClaimedAt == nil
+		}
+		return a.ClaimedAt != nil && a.ClaimedAt.After(*b.ClaimedAt)
+	})
+
+	usedCPU, usedMemory, usedSlots := node.UsedCPU, node.UsedMemory, node.ActiveExecutions
+	fits := func() bool {
+		return usedSlots < node.MaxSlots &&
+			node.CPUCores-usedCPU >= job.RequiredCPU &&
+			node.MemoryGB-usedMemory >= job.RequiredMemory
+	}
+
+	ev := &eviction{node: node}
+	for _, exec := range ordered {
+		if fits() {
+			break
+		}
+		victim := jobs[exec.JobID]
+		usedCPU -= victim.RequiredCPU
+		usedMemory -= victim.RequiredMemory
+		usedSlots--
+		ev.executions = append(ev.executions, exec)
+		if len(ev.executions) == 1 || victim.Priority > ev.worst {
+			ev.worst = victim.Priority
+		}
+	}
+	if !fits() || len(ev.executions) == 0 {
+		return nil
+	}
+	return ev
+}
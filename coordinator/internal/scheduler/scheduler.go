@@ -1,28 +1,63 @@
 package scheduler
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/HildaPosada/distributeai/coordinator/internal/fairshare"
 	"github.com/HildaPosada/distributeai/coordinator/internal/models"
 	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
 	"github.com/HildaPosada/distributeai/coordinator/internal/verification"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
+// claimTimeout is how long a scheduled execution waits for its node to claim it
+const claimTimeout = 2 * time.Minute
+
+// timeoutGrace is how long past a job's timeout an execution may keep running
+// before the coordinator fails it, leaving the worker time to report the timeout
+const timeoutGrace = time.Minute
+
+// pullAllowance is how long after claiming an execution a worker may take to
+// pull the image and start the container before its timeout counts, until it
+// reports the container started
+const pullAllowance = 10 * time.Minute
+
+// staleNodePenalty is the reputation a node loses for going offline unannounced
+const staleNodePenalty = 20.0
+
 // Scheduler handles job scheduling and distribution to worker nodes
 type Scheduler struct {
-	db       *repository.Database
-	verifier *verification.Verifier
-	stopChan chan struct{}
+	db              repository.Store
+	verifier        *verification.Verifier
+	maxTieBreakers  int           // Extra executions a job may get to break a consensus split
+	canaryInterval  time.Duration // Average time between spot checks; 0 disables them
+	nextCanary      time.Time
+	placement       Placement                 // For jobs that don't choose a strategy
+	fairShare       time.Duration             // How far back submitters' usage counts
+	preemptPriority int                       // Jobs from this priority up may preempt lower-priority executions
+	defaultPolicy   models.VerificationPolicy // Spot checks use it, like jobs that don't ask for one
+	stopChan        chan struct{}
 }
 
-func NewScheduler(db *repository.Database, verifier *verification.Verifier) *Scheduler {
+func NewScheduler(db repository.Store, verifier *verification.Verifier, maxTieBreakers int,
+	canaryInterval time.Duration, placement Placement, fairShareWindow time.Duration, preemptPriority int,
+	defaultPolicy models.VerificationPolicy) *Scheduler {
 	return &Scheduler{
-		db:       db,
-		verifier: verifier,
-		stopChan: make(chan struct{}),
+		db:              db,
+		verifier:        verifier,
+		maxTieBreakers:  maxTieBreakers,
+		canaryInterval:  canaryInterval,
+		placement:       placement,
+		fairShare:       fairShareWindow,
+		preemptPriority: preemptPriority,
+		defaultPolicy:   defaultPolicy,
+		stopChan:        make(chan struct{}),
 	}
 }
 
@@ -32,13 +67,18 @@ func (s *Scheduler) Start() {
 	defer ticker.Stop()
 
 	log.Info("Scheduler started")
+	s.scheduleNextCanary(time.Now())
 
 	for {
 		select {
 		case <-ticker.C:
 			s.schedulePendingJobs()
+			s.reclaimExpiredLeases()
+			s.enforceExecutionTimeouts()
 			s.checkRunningJobs()
 			s.detectStaleNodes()
+			s.finishDrains()
+			s.maybeInjectCanary()
 		case <-s.stopChan:
 			log.Info("Scheduler stopped")
 			return
@@ -51,9 +91,10 @@ func (s *Scheduler) Stop() {
 	close(s.stopChan)
 }
 
-// schedulePendingJobs assigns pending jobs to available nodes
+// schedulePendingJobs assigns pending jobs to available nodes, interleaving
+// submitters by fair share
 func (s *Scheduler) schedulePendingJobs() {
-	jobs, err := s.db.GetPendingJobs()
+	jobs, _, err := fairshare.Snapshot(s.db, s.fairShare)
 	if err != nil {
 		log.Errorf("Failed to get pending jobs: %v", err)
 		return
@@ -68,63 +109,346 @@ func (s *Scheduler) schedulePendingJobs() {
 
 // scheduleJob assigns a specific job to worker nodes
 func (s *Scheduler) scheduleJob(job *models.Job) error {
+	// A job whose policy can never be satisfied would otherwise wait forever
+	if job.Consensus < 1 || job.Consensus > job.Redundancy {
+		s.failJob(job, fmt.Sprintf("Invalid verification policy: %d of %d", job.Consensus, job.Redundancy))
+		return nil
+	}
+
+	// Each submitter's jobs are offered by priority, then earliest deadline
+	// first; one that has waited too long to finish a full run in time is given up on
+	if !meetsDeadline(job, time.Now()) {
+		s.timeOutJob(job, "Deadline can no longer be met")
+		return nil
+	}
+
 	// Get available nodes that meet the requirements
 	nodes, err := s.db.GetAvailableNodes(job.RequiredCPU, job.RequiredMemory, job.RequiredGPU)
 	if err != nil {
 		return fmt.Errorf("failed to get available nodes: %w", err)
 	}
 
-	if len(nodes) < job.Redundancy {
-		log.Warnf("Not enough nodes available for job %s (need %d, have %d)",
-			job.ID, job.Redundancy, len(nodes))
+	nodes, ranking := s.rankNodes(job, nodes)
+	now := time.Now()
+
+	// Adaptive jobs start with just enough replicas to agree when the best
+	// nodes are trusted, and escalate later if needed
+	count := job.Redundancy
+	if job.Adaptive && job.Consensus < job.Redundancy {
+		if trial, _ := placeReplicas(job, nodes, nil, job.Consensus, now); len(trial) == job.Consensus && allTrusted(trial) {
+			count = job.Consensus
+		}
+	}
+
+	// Spread replicas across operators, regions and hosts as the job asks
+	selectedNodes, enforced := placeReplicas(job, nodes, nil, count, now)
+
+	// An urgent job may take the room it lacks from lower-priority work
+	if len(selectedNodes) < count && s.preemptFor(job, selectedNodes, count-len(selectedNodes), now) > 0 {
+		nodes, err = s.db.GetAvailableNodes(job.RequiredCPU, job.RequiredMemory, job.RequiredGPU)
+		if err != nil {
+			return fmt.Errorf("failed to get available nodes: %w", err)
+		}
+		nodes, ranking = s.rankNodes(job, nodes)
+		selectedNodes, enforced = placeReplicas(job, nodes, nil, count, now)
+	}
+
+	if len(selectedNodes) < count {
+		log.Warnf("Not enough nodes available for job %s (need %d spread over %v, have %d)",
+			job.ID, count, enforced, len(selectedNodes))
 		return nil // Don't return error, just wait for more nodes
 	}
+	logRelaxedSpread(job, enforced)
+	ranking.logChoice(job, selectedNodes)
+
+	if count < job.Redundancy {
+		log.Infof("Job %s is adaptive: starting with %d trusted replicas instead of %d",
+			job.ID, count, job.Redundancy)
+	}
 
-	// Select top nodes based on reputation
-	selectedNodes := nodes[:job.Redundancy]
+	log.Infof("Scheduling job %s to %d nodes (%d must agree)", job.ID, len(selectedNodes), job.Consensus)
+
+	// The job, its executions and its nodes' status change together or not
+	// at all, and only if no other coordinator got to the job or the nodes first
+	err = s.db.ScheduleJob(job.ID, newExecutions(job, selectedNodes))
+	switch {
+	case errors.Is(err, repository.ErrLocked), errors.Is(err, repository.ErrNoCapacity):
+		log.Infof("Job %s not scheduled, will retry: %v", job.ID, err)
+		return nil
+	case errors.Is(err, models.ErrInvalidTransition):
+		// Scheduled elsewhere, cancelled or timed out since it was listed
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to schedule job: %w", err)
+	}
 
-	log.Infof("Scheduling job %s to %d nodes", job.ID, len(selectedNodes))
+	return nil
+}
 
-	// Create job executions for each selected node
-	for _, node := range selectedNodes {
-		execution := &models.JobExecution{
-			ID:        uuid.New().String(),
-			JobID:     job.ID,
-			NodeID:    node.ID,
-			Status:    models.JobStatusScheduled,
-			StartedAt: time.Now(),
+// newExecutions returns one scheduled execution of job for each of nodes,
+// waiting for its node to claim it
+func newExecutions(job *models.Job, nodes []*models.Node) []*models.JobExecution {
+	var executions []*models.JobExecution
+	for _, node := range nodes {
+		claimDeadline := time.Now().Add(claimTimeout)
+		executions = append(executions, &models.JobExecution{
+			ID:             uuid.New().String(),
+			JobID:          job.ID,
+			NodeID:         node.ID,
+			Status:         models.JobStatusScheduled,
+			StartedAt:      time.Now(),
+			LeaseExpiresAt: &claimDeadline,
+		})
+	}
+	return executions
+}
+
+// addExecutions schedules executions of an active job on nodes, as many as it
+// is short of its redundancy, and returns how many were created
+func (s *Scheduler) addExecutions(job *models.Job, nodes []*models.Node) int {
+	created, err := s.db.AddJobExecutions(job.ID, newExecutions(job, nodes))
+	if err != nil && err != sql.ErrNoRows {
+		log.Errorf("Failed to add executions to job %s: %v", job.ID, err)
+	}
+	return created
+}
+
+// replaceLostExecutions schedules one replacement for every execution of job
+// that was lost with its node or preempted, on nodes that haven't run the job
+// yet; a node that only had it preempted may take it back. Completed results
+// from healthy nodes are kept as they are.
+func (s *Scheduler) replaceLostExecutions(job *models.Job, executions []*models.JobExecution) error {
+	needed := unfilledSlots(job, executions)
+	if needed <= 0 {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	for _, exec := range executions {
+		if exec.ErrorClass != models.ErrorClassPreempted {
+			used[exec.NodeID] = true
 		}
+	}
 
-		if err := s.db.CreateJobExecution(execution); err != nil {
-			log.Errorf("Failed to create execution for node %s: %v", node.ID, err)
-			continue
+	// A replacement that can't finish before the deadline is not worth starting
+	if !meetsDeadline(job, time.Now()) {
+		log.Warnf("Job %s lost %d executions too close to its deadline to replace them", job.ID, needed)
+		return nil
+	}
+
+	nodes, err := s.db.GetAvailableNodes(job.RequiredCPU, job.RequiredMemory, job.RequiredGPU)
+	if err != nil {
+		return fmt.Errorf("failed to get available nodes: %w", err)
+	}
+
+	var candidates []*models.Node
+	for _, node := range nodes {
+		if !used[node.ID] {
+			candidates = append(candidates, node)
+		}
+	}
+	candidates, ranking := s.rankNodes(job, candidates)
+	candidates, enforced := placeReplicas(job, candidates, s.replicaNodes(executions), needed, time.Now())
+	logRelaxedSpread(job, enforced)
+	ranking.logChoice(job, candidates)
+
+	created := s.addExecutions(job, candidates)
+	if created < needed {
+		log.Warnf("Job %s needs %d replacement executions, scheduled %d; will retry",
+			job.ID, needed, created)
+	} else {
+		log.Infof("Scheduled %d replacement executions for job %s", created, job.ID)
+	}
+
+	return nil
+}
+
+// unfilledSlots returns how many executions job still needs to reach its
+// redundancy, not counting executions lost with their node or preempted
+func unfilledSlots(job *models.Job, executions []*models.JobExecution) int {
+	counted := 0
+	for _, exec := range executions {
+		if !exec.ErrorClass.IsLost() {
+			counted++
+		}
+	}
+	return job.Redundancy - counted
+}
+
+// reclaimExpiredLeases takes back executions that were never claimed or whose
+// worker stopped renewing the lease, and hands them to another eligible node
+func (s *Scheduler) reclaimExpiredLeases() {
+	executions, err := s.db.GetExpiredExecutions()
+	if err != nil {
+		log.Errorf("Failed to get expired executions: %v", err)
+		return
+	}
+
+	for _, exec := range executions {
+		if err := s.reassignExecution(exec); err != nil {
+			log.Errorf("Failed to reassign execution %s: %v", exec.ID, err)
+		}
+	}
+}
+
+// reassignExecution moves an expired execution to a node that isn't already
+// running this job, falling back to the original node if none is available
+func (s *Scheduler) reassignExecution(exec *models.JobExecution) error {
+	job, err := s.db.GetJob(exec.JobID)
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	// Leftover replicas of a finished job are not worth running anywhere
+	if job.Status.IsFinished() {
+		now := time.Now()
+		exec.Status = models.JobStatusFailed
+		exec.CompletedAt = &now
+		exec.ErrorMessage = "Job finished before execution completed"
+		exec.LeaseExpiresAt = nil
+		return s.db.UpdateJobExecution(exec)
+	}
+
+	siblings, err := s.db.GetJobExecutions(job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get executions: %w", err)
+	}
+
+	assigned := make(map[string]bool)
+	var others []*models.JobExecution
+	for _, sibling := range siblings {
+		assigned[sibling.NodeID] = true
+		if sibling.ID != exec.ID {
+			others = append(others, sibling)
 		}
+	}
 
-		// Mark node as busy
-		if err := s.db.UpdateNodeStatus(node.ID, models.NodeStatusBusy); err != nil {
-			log.Warnf("Failed to update node status: %v", err)
+	nodes, err := s.db.GetAvailableNodes(job.RequiredCPU, job.RequiredMemory, job.RequiredGPU)
+	if err != nil {
+		return fmt.Errorf("failed to get available nodes: %w", err)
+	}
+
+	var candidates []*models.Node
+	for _, node := range nodes {
+		if !assigned[node.ID] {
+			candidates = append(candidates, node)
+		}
+	}
+
+	candidates, ranking := s.rankNodes(job, candidates)
+
+	target := ""
+	if placed, enforced := placeReplicas(job, candidates, s.replicaNodes(others), 1, time.Now()); len(placed) > 0 {
+		target = placed[0].ID
+		logRelaxedSpread(job, enforced)
+		ranking.logChoice(job, placed)
+	}
+
+	if target == "" {
+		// Nowhere else to go: give the original node another chance if it is
+		// still alive and in rotation, otherwise treat the execution as lost
+		// with its node
+		node, err := s.db.GetNode(exec.NodeID)
+		if err != nil || node.Status == models.NodeStatusOffline || node.Cordoned || node.Draining {
+			now := time.Now()
+			exec.Status = models.JobStatusFailed
+			exec.CompletedAt = &now
+			exec.ErrorClass = models.ErrorClassNodeLost
+			exec.ErrorMessage = "Lease expired and node is unavailable"
+			exec.LeaseExpiresAt = nil
+			return s.db.UpdateJobExecution(exec)
 		}
+		target = exec.NodeID
 	}
 
-	// Update job status to scheduled
-	if err := s.db.UpdateJobStatus(job.ID, models.JobStatusScheduled, "", ""); err != nil {
-		return fmt.Errorf("failed to update job status: %w", err)
+	err = s.db.ReassignJobExecution(exec.ID, target, time.Now().Add(claimTimeout))
+	switch {
+	case err == repository.ErrLeaseNotHeld:
+		// Renewed or finished since we looked; nothing to do
+		return nil
+	case errors.Is(err, repository.ErrLocked), errors.Is(err, repository.ErrNoCapacity):
+		// The target is busy or filled up; the lease stays expired, so the
+		// next tick tries again
+		log.Infof("Execution %s not reassigned to %s, will retry: %v", exec.ID, target, err)
+		return nil
+	case err != nil:
+		return err
 	}
 
+	log.Warnf("Lease on execution %s (job %s) expired on node %s, reassigned to %s",
+		exec.ID, job.ID, exec.NodeID, target)
 	return nil
 }
 
+// enforceExecutionTimeouts fails executions that kept running past their job's
+// timeout, e.g. on a worker that doesn't enforce it
+func (s *Scheduler) enforceExecutionTimeouts() {
+	nodeIDs, err := s.db.TimeOutOverrunExecutions(timeoutGrace, pullAllowance)
+	if err != nil {
+		log.Errorf("Failed to time out executions: %v", err)
+		return
+	}
+
+	for _, nodeID := range nodeIDs {
+		log.Warnf("Execution on node %s exceeded its job timeout", nodeID)
+	}
+}
+
+// timeOutJob ends a job as timed out and frees the nodes still working on it
+func (s *Scheduler) timeOutJob(job *models.Job, reason string) {
+	nodeIDs, err := s.db.TimeOutJob(job.ID, reason)
+	if !stopped(job, "time out", err) {
+		return
+	}
+	log.Warnf("Job %s timed out: %s (%d executions stopped)", job.ID, reason, len(nodeIDs))
+}
+
+// failJob ends a job that can't succeed any more as failed and cancels the
+// executions still outstanding, freeing their nodes
+func (s *Scheduler) failJob(job *models.Job, reason string) {
+	nodeIDs, err := s.db.FailJob(job.ID, reason)
+	if !stopped(job, "fail", err) {
+		return
+	}
+	log.Warnf("Job %s failed: %s (%d executions stopped)", job.ID, reason, len(nodeIDs))
+}
+
+// stopped reports whether stopping job succeeded, logging why not otherwise.
+// A job that finished in the meantime is left alone, and one another
+// coordinator holds is looked at again next round.
+func stopped(job *models.Job, action string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case err == sql.ErrNoRows, errors.Is(err, models.ErrInvalidTransition):
+	case errors.Is(err, repository.ErrLocked):
+		log.Infof("Job %s is locked, will try to %s it again: %v", job.ID, action, err)
+	default:
+		log.Errorf("Failed to %s job %s: %v", action, job.ID, err)
+	}
+	return false
+}
+
+// meetsDeadline reports whether a run of job started at now, taking its full
+// timeout, would still finish before the job's deadline
+func meetsDeadline(job *models.Job, now time.Time) bool {
+	if job.Deadline == nil {
+		return true
+	}
+	return !now.Add(time.Duration(job.TimeoutSeconds) * time.Second).After(*job.Deadline)
+}
+
 // checkRunningJobs monitors running jobs and performs verification
 func (s *Scheduler) checkRunningJobs() {
-	jobs, err := s.db.GetAllJobs()
+	jobs, err := s.db.GetActiveJobs()
 	if err != nil {
 		log.Errorf("Failed to get jobs: %v", err)
 		return
 	}
 
 	for _, job := range jobs {
-		// Skip non-active jobs
-		if job.Status == models.JobStatusCompleted || job.Status == models.JobStatusFailed {
+		if job.Deadline != nil && time.Now().After(*job.Deadline) {
+			s.timeOutJob(job, "Deadline passed before consensus was reached")
 			continue
 		}
 
@@ -135,48 +459,121 @@ func (s *Scheduler) checkRunningJobs() {
 			continue
 		}
 
-		// Count completed executions
+		// Adaptive jobs add replicas when one fails or a node they rely on
+		// isn't trusted
+		if job.Adaptive {
+			s.escalate(job, executions)
+		}
+
+		// Top up replicas lost to dead nodes that couldn't be replaced earlier
+		if err := s.replaceLostExecutions(job, executions); err != nil {
+			log.Errorf("Failed to replace executions for job %s: %v", job.ID, err)
+		}
+
+		// Count completed executions; lost executions have been replaced and
+		// don't count as failures
 		completedCount := 0
 		failedCount := 0
+		timedOutCount := 0
 
 		for _, exec := range executions {
 			if exec.Status == models.JobStatusCompleted {
 				completedCount++
-			} else if exec.Status == models.JobStatusFailed {
+			} else if exec.Status == models.JobStatusFailed && !exec.ErrorClass.IsLost() {
 				failedCount++
+				if exec.ErrorClass == models.ErrorClassTimedOut {
+					timedOutCount++
+				}
 			}
 		}
 
+		// Spot checks are judged against their known answer, not by consensus,
+		// once as many replicas finished as a real job would wait for
+		if job.CanaryID != "" && completedCount >= job.Consensus {
+			s.auditCanary(job, executions)
+			continue
+		}
+
 		// Check if we have enough completions to verify
 		if completedCount >= job.Consensus {
-			if err := s.verifier.CheckAndFinalizeJob(job.ID); err != nil {
+			finalized, err := s.verifier.CheckAndFinalizeJob(job.ID)
+			if err != nil {
 				log.Errorf("Failed to verify job %s: %v", job.ID, err)
 			}
+			if finalized {
+				continue
+			}
 		}
 
-		// Check for job failure (too many failed executions)
-		if failedCount > (job.Redundancy - job.Consensus) {
-			log.Warnf("Job %s failed: too many execution failures", job.ID)
-			s.db.UpdateJobStatus(job.ID, models.JobStatusFailed, "", "Too many execution failures")
+		// Check for job failure (too many failed executions). If every failure
+		// was a timeout the job timed out rather than failed.
+		if failedCount > s.failureBudget(job) {
+			if timedOutCount == failedCount {
+				s.timeOutJob(job, "Too many executions timed out")
+				continue
+			}
+			s.failJob(job, "Too many execution failures")
+			continue
 		}
 
-		// Handle stale jobs (scheduled but not progressing)
-		if job.Status == models.JobStatusScheduled && job.SubmittedAt.Before(time.Now().Add(-10*time.Minute)) {
-			// Check if any executions are actually running
-			hasRunning := false
-			for _, exec := range executions {
-				if exec.Status == models.JobStatusRunning {
-					hasRunning = true
-					break
-				}
-			}
+		s.resolveConsensusSplit(job, executions)
+	}
+}
 
-			if !hasRunning && completedCount == 0 {
-				log.Warnf("Job %s appears stale, rescheduling", job.ID)
-				s.db.UpdateJobStatus(job.ID, models.JobStatusPending, "", "")
-			}
+// resolveConsensusSplit handles a job whose results have split so that no
+// group can reach consensus any more. It schedules tie-breaker executions on
+// fresh nodes while the job's redundancy limit allows, then fails the job.
+func (s *Scheduler) resolveConsensusSplit(job *models.Job, executions []*models.JobExecution) {
+	// Executions still waiting for a node may yet decide it
+	if unfilledSlots(job, executions) > 0 {
+		return
+	}
+
+	shortfall, groups, err := s.verifier.ConsensusShortfall(job, executions)
+	if err != nil {
+		log.Errorf("Failed to assess consensus for job %s: %v", job.ID, err)
+		return
+	}
+	if shortfall == 0 {
+		return
+	}
+
+	if job.Redundancy+shortfall <= s.redundancyLimit(job) {
+		err := s.db.AddTieBreakers(job.ID, shortfall)
+		switch {
+		case err == sql.ErrNoRows:
+			// Finished since it was listed
+			return
+		case errors.Is(err, repository.ErrLocked):
+			log.Infof("Job %s is locked, will add tie-breakers later: %v", job.ID, err)
+			return
+		case err != nil:
+			log.Errorf("Failed to add tie-breakers to job %s: %v", job.ID, err)
+			return
 		}
+		job.Redundancy += shortfall
+		job.TieBreakers += shortfall
+
+		log.Warnf("Job %s results split %s, scheduling %d tie-breaker execution(s)",
+			job.ID, formatGroups(groups), shortfall)
+		if err := s.replaceLostExecutions(job, executions); err != nil {
+			log.Errorf("Failed to schedule tie-breakers for job %s: %v", job.ID, err)
+		}
+		return
 	}
+
+	reason := fmt.Sprintf("Consensus split: results split %s, %d of %d needed to agree",
+		formatGroups(groups), job.Consensus, job.Redundancy)
+	s.failJob(job, reason)
+}
+
+// formatGroups renders result group sizes as e.g. "1-1-1"
+func formatGroups(groups []int) string {
+	parts := make([]string, len(groups))
+	for i, size := range groups {
+		parts[i] = strconv.Itoa(size)
+	}
+	return strings.Join(parts, "-")
 }
 
 // detectStaleNodes marks nodes as offline if they haven't sent heartbeat
@@ -187,17 +584,79 @@ func (s *Scheduler) detectStaleNodes() {
 		return
 	}
 
-	staleThreshold := time.Now().Add(-2 * time.Minute)
+	now := time.Now()
+	staleThreshold := now.Add(-2 * time.Minute)
 
 	for _, node := range nodes {
-		if node.Status == models.NodeStatusOnline && node.LastHeartbeat.Before(staleThreshold) {
-			log.Warnf("Node %s is stale, marking offline", node.ID)
-			if err := s.db.UpdateNodeStatus(node.ID, models.NodeStatusOffline); err != nil {
-				log.Errorf("Failed to mark node offline: %v", err)
-			}
+		isActive := node.Status == models.NodeStatusOnline || node.Status == models.NodeStatusBusy
+		if !isActive || !node.LastHeartbeat.Before(staleThreshold) {
+			continue
+		}
+
+		// Penalize reputation for going offline, unless it was announced:
+		// a maintenance window that overlapped the silence counts even if
+		// it has ended since
+		penalty := staleNodePenalty
+		if node.Draining || node.InMaintenance(node.LastHeartbeat, now) {
+			penalty = 0
+		}
+
+		jobIDs, err := s.db.TakeNodeOffline(node.ID, staleThreshold, penalty, "Node went offline")
+		switch {
+		case err == sql.ErrNoRows:
+			continue // Heartbeat arrived, or another coordinator got there first
+		case errors.Is(err, repository.ErrLocked):
+			log.Infof("Node %s is stale but being updated, retrying next round", node.ID)
+			continue
+		case err != nil:
+			log.Errorf("Failed to mark node %s offline: %v", node.ID, err)
+			continue
+		}
+		if penalty == 0 {
+			log.Warnf("Node %s is stale, marked offline; draining or in maintenance, not penalized", node.ID)
+		} else {
+			log.Warnf("Node %s is stale, marked offline", node.ID)
+		}
+
+		s.replaceNodeExecutions(node.ID, jobIDs, "Node went offline")
+	}
+}
+
+// finishDrains takes draining nodes offline once their executions are done
+func (s *Scheduler) finishDrains() {
+	nodeIDs, err := s.db.FinishDrains()
+	if err != nil {
+		log.Errorf("Failed to finish drains: %v", err)
+		return
+	}
+	for _, nodeID := range nodeIDs {
+		log.Infof("Node %s drained, now offline", nodeID)
+	}
+}
+
+// replaceNodeExecutions immediately schedules replacements on other nodes
+// for the executions a node that went offline or was quarantined lost, given
+// the IDs of their jobs
+func (s *Scheduler) replaceNodeExecutions(nodeID string, jobIDs []string, reason string) {
+	for _, jobID := range jobIDs {
+		job, err := s.db.GetJob(jobID)
+		if err != nil {
+			log.Errorf("Failed to get job %s: %v", jobID, err)
+			continue
+		}
+		if job.Status.IsFinished() {
+			continue
+		}
+
+		executions, err := s.db.GetJobExecutions(jobID)
+		if err != nil {
+			log.Errorf("Failed to get executions for job %s: %v", jobID, err)
+			continue
+		}
 
-			// Penalize reputation for going offline
-			s.db.UpdateNodeReputation(node.ID, -20.0)
+		log.Warnf("Node %s lost job %s in flight (%s), replacing its execution", nodeID, jobID, reason)
+		if err := s.replaceLostExecutions(job, executions); err != nil {
+			log.Errorf("Failed to replace executions for job %s: %v", jobID, err)
 		}
 	}
 }
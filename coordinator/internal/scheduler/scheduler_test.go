@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+)
+
+func TestDetectStaleNodesSparesMaintenanceDuringSilence(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		start, end time.Duration // Maintenance window relative to now; zero for none
+		penalized  bool
+	}{
+		{"no window", 0, 0, true},
+		{"window still open", -4 * time.Minute, time.Hour, false},
+		{"window ended before the node was noticed", -4 * time.Minute, -3 * time.Minute, false},
+		{"window ended before the node went silent", -time.Hour, -10 * time.Minute, true},
+		{"window not started yet", time.Minute, time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		db := repository.NewMemoryStore()
+		s := newTestScheduler(t, db)
+		err := db.RegisterNode(&models.Node{
+			ID: "node-a", Name: "node-a", CPUCores: 4, MemoryGB: 8, Status: models.NodeStatusOnline,
+			ReputationScore: 100, LastHeartbeat: now.Add(-5 * time.Minute), RegisteredAt: now, MaxSlots: 1,
+		})
+		if err != nil {
+			t.Fatalf("RegisterNode: %v", err)
+		}
+		if tt.start != 0 || tt.end != 0 {
+			start, end := now.Add(tt.start), now.Add(tt.end)
+			if err := db.SetNodeMaintenance("node-a", &start, &end); err != nil {
+				t.Fatalf("SetNodeMaintenance: %v", err)
+			}
+		}
+
+		s.detectStaleNodes()
+
+		node, _ := db.GetNode("node-a")
+		if node.Status != models.NodeStatusOffline {
+			t.Errorf("%s: stale node is %s, want offline", tt.name, node.Status)
+		}
+		if penalized := node.ReputationScore < 100; penalized != tt.penalized {
+			t.Errorf("%s: reputation %.0f, penalized = %t, want %t", tt.name, node.ReputationScore, penalized, tt.penalized)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/selector"
+	log "github.com/sirupsen/logrus"
+)
+
+// Placement ranks the nodes that could run a job. Candidates come from the
+// database ordered by reputation, which also breaks ties between equal scores.
+type Placement interface {
+	Name() models.PlacementStrategy
+	// Score rates node for one more execution of job, higher is better, and
+	// explains the score for the logs
+	Score(job *models.Job, node *models.Node) (float64, string)
+}
+
+// NewPlacement returns the placement strategy with the given name
+func NewPlacement(name models.PlacementStrategy) (Placement, error) {
+	switch name {
+	case models.PlacementReputation:
+		return reputationPlacement{}, nil
+	case models.PlacementLeastLoaded:
+		return leastLoadedPlacement{}, nil
+	case models.PlacementBinPacking:
+		return binPackingPlacement{}, nil
+	case models.PlacementRandomWeighted:
+		return randomWeightedPlacement{draw: rand.Float64}, nil
+	case models.PlacementCost:
+		return costPlacement{}, nil
+	default:
+		return nil, fmt.Errorf("unknown placement strategy %q", name)
+	}
+}
+
+// ranking is the outcome of scoring candidates for one placement decision
+type ranking struct {
+	strategy    Placement
+	preferences map[string]int // Affinity preference, which outranks the score
+	scores      map[string]float64
+	reasons     map[string]string
+}
+
+// rankNodes drops the nodes job's selector, affinity, taints or a maintenance
+// window rule out and orders the rest by affinity preference, then by the
+// job's placement strategy or the scheduler's default
+func (s *Scheduler) rankNodes(job *models.Job, nodes []*models.Node) ([]*models.Node, *ranking) {
+	strategy := s.placement
+	if job.Placement != "" {
+		if p, err := NewPlacement(job.Placement); err == nil {
+			strategy = p
+		} else {
+			log.Warnf("Job %s: %v, using %s", job.ID, err, strategy.Name())
+		}
+	}
+
+	r := &ranking{
+		strategy:    strategy,
+		preferences: make(map[string]int),
+		scores:      make(map[string]float64),
+		reasons:     make(map[string]string),
+	}
+	now := time.Now()
+	var ranked []*models.Node
+	for _, node := range nodes {
+		if ok, why := admits(job, node, now); !ok {
+			log.Debugf("Job %s: node %s ruled out: %s", job.ID, node.ID, why)
+			continue
+		}
+		r.preferences[node.ID] = selector.Preference(job, node)
+		r.scores[node.ID], r.reasons[node.ID] = strategy.Score(job, node)
+		ranked = append(ranked, node)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i].ID, ranked[j].ID
+		if r.preferences[a] != r.preferences[b] {
+			return r.preferences[a] > r.preferences[b]
+		}
+		return r.scores[a] > r.scores[b]
+	})
+
+	if log.IsLevelEnabled(log.DebugLevel) {
+		log.Debugf("Job %s: %s ranking: %s", job.ID, strategy.Name(), r.explain(ranked))
+	}
+	return ranked, r
+}
+
+// explain renders the scores of the given nodes, e.g. for the ones chosen
+func (r *ranking) explain(nodes []*models.Node) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		reason := r.reasons[node.ID]
+		if pref := r.preferences[node.ID]; pref != 0 {
+			reason = fmt.Sprintf("%s, preference %d", reason, pref)
+		}
+		parts[i] = fmt.Sprintf("%s=%.3f (%s)", node.ID, r.scores[node.ID], reason)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// logChoice records which nodes a placement decision picked and why
+func (r *ranking) logChoice(job *models.Job, chosen []*models.Node) {
+	if len(chosen) == 0 {
+		return
+	}
+	log.Infof("Job %s: %s placement chose %s", job.ID, r.strategy.Name(), r.explain(chosen))
+}
+
+type reputationPlacement struct{}
+
+func (reputationPlacement) Name() models.PlacementStrategy { return models.PlacementReputation }
+
+func (reputationPlacement) Score(job *models.Job, node *models.Node) (float64, string) {
+	return node.ReputationScore, fmt.Sprintf("reputation %.1f", node.ReputationScore)
+}
+
+// capacity describes a node's load, optionally with one more execution of a job
+type capacity struct {
+	cpu, memory, slots float64 // Fraction in use
+	usedCPU, usedMem   int
+	usedSlots          int
+}
+
+func nodeCapacity(node *models.Node, job *models.Job) capacity {
+	c := capacity{usedCPU: node.UsedCPU, usedMem: node.UsedMemory, usedSlots: node.ActiveExecutions}
+	if job != nil {
+		c.usedCPU += job.RequiredCPU
+		c.usedMem += job.RequiredMemory
+		c.usedSlots++
+	}
+	c.cpu = fraction(c.usedCPU, node.CPUCores)
+	c.memory = fraction(c.usedMem, node.MemoryGB)
+	c.slots = fraction(c.usedSlots, node.MaxSlots)
+	return c
+}
+
+func (c capacity) mean() float64 {
+	return (c.cpu + c.memory + c.slots) / 3
+}
+
+func (c capacity) describe(node *models.Node) string {
+	return fmt.Sprintf("cpu %d/%d, memory %d/%d GB, slots %d/%d",
+		c.usedCPU, node.CPUCores, c.usedMem, node.MemoryGB, c.usedSlots, node.MaxSlots)
+}
+
+func fraction(used, total int) float64 {
+	if total <= 0 {
+		return 1
+	}
+	return float64(used) / float64(total)
+}
+
+// leastLoadedPlacement spreads work thin, so jobs start on idle nodes
+type leastLoadedPlacement struct{}
+
+func (leastLoadedPlacement) Name() models.PlacementStrategy { return models.PlacementLeastLoaded }
+
+func (leastLoadedPlacement) Score(job *models.Job, node *models.Node) (float64, string) {
+	load := nodeCapacity(node, nil)
+	free := 1 - load.mean()
+	return free, fmt.Sprintf("%.0f%% free: %s", free*100, load.describe(node))
+}
+
+// binPackingPlacement fills nodes up before touching empty ones, keeping whole
+// nodes free for large jobs
+type binPackingPlacement struct{}
+
+func (binPackingPlacement) Name() models.PlacementStrategy { return models.PlacementBinPacking }
+
+func (binPackingPlacement) Score(job *models.Job, node *models.Node) (float64, string) {
+	after := nodeCapacity(node, job)
+	fill := after.mean()
+	return fill, fmt.Sprintf("%.0f%% full after placing: %s", fill*100, after.describe(node))
+}
+
+// randomWeightedPlacement draws nodes at random with probability proportional
+// to reputation, so new nodes get work without the best ones being ignored.
+// Each node's score is u^(1/w), which sorts into a weighted random order.
+type randomWeightedPlacement struct {
+	draw func() float64 // Uniform in [0, 1)
+}
+
+func (randomWeightedPlacement) Name() models.PlacementStrategy { return models.PlacementRandomWeighted }
+
+func (p randomWeightedPlacement) Score(job *models.Job, node *models.Node) (float64, string) {
+	weight := math.Max(node.ReputationScore, 1)
+	draw := p.draw()
+	return math.Pow(draw, 1/weight), fmt.Sprintf("reputation %.1f, draw %.3f", node.ReputationScore, draw)
+}
+
+// costPlacement picks the node that charges least for the job's CPU over its
+// full timeout
+type costPlacement struct{}
+
+func (costPlacement) Name() models.PlacementStrategy { return models.PlacementCost }
+
+func (costPlacement) Score(job *models.Job, node *models.Node) (float64, string) {
+	hours := float64(job.TimeoutSeconds) / 3600
+	cost := node.Price * float64(job.RequiredCPU) * hours
+	return -cost, fmt.Sprintf("price %.2f/CPU-hour, at most %.3f credits", node.Price, cost)
+}
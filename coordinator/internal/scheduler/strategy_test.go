@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+// rankIDs ranks nodes for job with placement and returns their IDs in order
+func rankIDs(placement Placement, job *models.Job, nodes []*models.Node) []string {
+	s := &Scheduler{placement: placement}
+	ranked, _ := s.rankNodes(job, nodes)
+	var ids []string
+	for _, node := range ranked {
+		ids = append(ids, node.ID)
+	}
+	return ids
+}
+
+func TestPlacementOrders(t *testing.T) {
+	job := &models.Job{ID: "job-1", RequiredCPU: 2, RequiredMemory: 4, TimeoutSeconds: 3600}
+	// Listed by reputation, as the database returns candidates
+	nodes := func() []*models.Node {
+		return []*models.Node{
+			{ID: "busy", ReputationScore: 180, CPUCores: 8, MemoryGB: 16, MaxSlots: 4,
+				UsedCPU: 6, UsedMemory: 12, ActiveExecutions: 3, Price: 0.5},
+			{ID: "half", ReputationScore: 150, CPUCores: 8, MemoryGB: 16, MaxSlots: 4,
+				UsedCPU: 4, UsedMemory: 8, ActiveExecutions: 2, Price: 2},
+			{ID: "idle", ReputationScore: 120, CPUCores: 8, MemoryGB: 16, MaxSlots: 4, Price: 1},
+			{ID: "twin", ReputationScore: 120, CPUCores: 8, MemoryGB: 16, MaxSlots: 4, Price: 1},
+		}
+	}
+
+	tests := []struct {
+		strategy models.PlacementStrategy
+		want     []string
+	}{
+		{models.PlacementReputation, []string{"busy", "half", "idle", "twin"}},
+		// Equal scores keep the reputation order
+		{models.PlacementLeastLoaded, []string{"idle", "twin", "half", "busy"}},
+		{models.PlacementBinPacking, []string{"busy", "half", "idle", "twin"}},
+		{models.PlacementCost, []string{"busy", "idle", "twin", "half"}},
+	}
+
+	for _, tt := range tests {
+		placement, err := NewPlacement(tt.strategy)
+		if err != nil {
+			t.Fatalf("NewPlacement(%s): %v", tt.strategy, err)
+		}
+		if placement.Name() != tt.strategy {
+			t.Errorf("NewPlacement(%s) returned %s", tt.strategy, placement.Name())
+		}
+		if got := rankIDs(placement, job, nodes()); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s ranked %v, want %v", tt.strategy, got, tt.want)
+		}
+	}
+}
+
+func TestRandomWeightedPlacement(t *testing.T) {
+	job := &models.Job{ID: "job-1", RequiredCPU: 1, RequiredMemory: 1, TimeoutSeconds: 3600}
+	nodes := []*models.Node{
+		{ID: "veteran", ReputationScore: 300, CPUCores: 4, MemoryGB: 8, MaxSlots: 1},
+		{ID: "newcomer", ReputationScore: 100, CPUCores: 4, MemoryGB: 8, MaxSlots: 1},
+	}
+
+	// The same draws give the same order
+	first := rankIDs(randomWeightedPlacement{draw: rand.New(rand.NewSource(1)).Float64}, job, nodes)
+	again := rankIDs(randomWeightedPlacement{draw: rand.New(rand.NewSource(1)).Float64}, job, nodes)
+	if !reflect.DeepEqual(first, again) {
+		t.Errorf("seeded rankings differ: %v, then %v", first, again)
+	}
+
+	// A node with three times the reputation comes first three times as often
+	placement := randomWeightedPlacement{draw: rand.New(rand.NewSource(1)).Float64}
+	const rounds = 2000
+	veteranFirst := 0
+	for i := 0; i < rounds; i++ {
+		if rankIDs(placement, job, nodes)[0] == "veteran" {
+			veteranFirst++
+		}
+	}
+	if share := float64(veteranFirst) / rounds; share < 0.7 || share > 0.8 {
+		t.Errorf("veteran ranked first in %.2f of draws, want about 0.75", share)
+	}
+}
+
+func TestNewPlacementRejectsUnknownName(t *testing.T) {
+	for _, name := range []models.PlacementStrategy{"", "fastest", "Reputation"} {
+		if placement, err := NewPlacement(name); err == nil {
+			t.Errorf("NewPlacement(%q) = %s, want an error", name, placement.Name())
+		}
+	}
+}
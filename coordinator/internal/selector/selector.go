@@ -0,0 +1,221 @@
+package selector
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+// Admits reports whether job may run on node: the node has every label of the
+// job's node selector, matches all its required affinity expressions, and
+// every no_schedule taint on it is tolerated. If not, it says why.
+func Admits(job *models.Job, node *models.Node) (bool, string) {
+	for key, value := range job.NodeSelector {
+		if got, ok := node.Labels[key]; !ok || got != value {
+			return false, fmt.Sprintf("label %s is not %q", key, value)
+		}
+	}
+	for _, expr := range job.Affinity.Required {
+		if !Matches(expr, node.Labels) {
+			return false, fmt.Sprintf("label %s fails %s %v", expr.Key, expr.Operator, expr.Values)
+		}
+	}
+	for _, taint := range node.Taints {
+		if taint.Effect == models.TaintNoSchedule && !tolerated(taint, job.Tolerations) {
+			return false, fmt.Sprintf("taint %s is not tolerated", formatTaint(taint))
+		}
+	}
+	return true, ""
+}
+
+// Preference scores how much job would like to run on an admitted node: the
+// weight of the preferred expressions it matches, less one for every
+// prefer_no_schedule taint the job doesn't tolerate
+func Preference(job *models.Job, node *models.Node) int {
+	score := 0
+	for _, pref := range job.Affinity.Preferred {
+		if Matches(pref.Expression, node.Labels) {
+			score += pref.Weight
+		}
+	}
+	for _, taint := range node.Taints {
+		if taint.Effect == models.TaintPreferNoSchedule && !tolerated(taint, job.Tolerations) {
+			score--
+		}
+	}
+	return score
+}
+
+// Filter returns the nodes job may run on, in the same order
+func Filter(job *models.Job, nodes []*models.Node) []*models.Node {
+	var admitted []*models.Node
+	for _, node := range nodes {
+		if ok, _ := Admits(job, node); ok {
+			admitted = append(admitted, node)
+		}
+	}
+	return admitted
+}
+
+// Matches reports whether labels satisfy expr
+func Matches(expr models.LabelExpression, labels map[string]string) bool {
+	value, ok := labels[expr.Key]
+	switch expr.Operator {
+	case models.LabelIn:
+		return ok && contains(expr.Values, value)
+	case models.LabelNotIn:
+		return !ok || !contains(expr.Values, value)
+	case models.LabelExists:
+		return ok
+	case models.LabelDoesNotExist:
+		return !ok
+	case models.LabelGt, models.LabelLt:
+		if !ok || len(expr.Values) != 1 {
+			return false
+		}
+		got, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		want, err := strconv.ParseFloat(expr.Values[0], 64)
+		if err != nil {
+			return false
+		}
+		if expr.Operator == models.LabelGt {
+			return got > want
+		}
+		return got < want
+	default:
+		return false
+	}
+}
+
+func tolerated(taint models.Taint, tolerations []models.Toleration) bool {
+	for _, t := range tolerations {
+		if t.Effect != "" && t.Effect != taint.Effect {
+			continue
+		}
+		if t.Operator == models.TolerationExists {
+			if t.Key == "" || t.Key == taint.Key {
+				return true
+			}
+			continue
+		}
+		if t.Key == taint.Key && t.Value == taint.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func formatTaint(taint models.Taint) string {
+	if taint.Value == "" {
+		return fmt.Sprintf("%s:%s", taint.Key, taint.Effect)
+	}
+	return fmt.Sprintf("%s=%s:%s", taint.Key, taint.Value, taint.Effect)
+}
+
+// ValidateJob checks a job's selector, affinity and tolerations
+func ValidateJob(selector map[string]string, affinity models.NodeAffinity, tolerations []models.Toleration) error {
+	for key := range selector {
+		if key == "" {
+			return fmt.Errorf("node_selector: label keys must not be empty")
+		}
+	}
+	for _, expr := range affinity.Required {
+		if err := validateExpression(expr); err != nil {
+			return fmt.Errorf("affinity.required: %w", err)
+		}
+	}
+	for _, pref := range affinity.Preferred {
+		if pref.Weight <= 0 {
+			return fmt.Errorf("affinity.preferred: weight must be positive")
+		}
+		if err := validateExpression(pref.Expression); err != nil {
+			return fmt.Errorf("affinity.preferred: %w", err)
+		}
+	}
+	for _, t := range tolerations {
+		switch t.Operator {
+		case "", models.TolerationEqual:
+			if t.Key == "" {
+				return fmt.Errorf("tolerations: key is required with the equal operator")
+			}
+		case models.TolerationExists:
+			if t.Value != "" {
+				return fmt.Errorf("tolerations: exists takes no value")
+			}
+		default:
+			return fmt.Errorf("tolerations: unknown operator %q", t.Operator)
+		}
+		if t.Effect != "" {
+			if err := validateEffect(t.Effect); err != nil {
+				return fmt.Errorf("tolerations: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateNode checks a node's labels and taints
+func ValidateNode(labels map[string]string, taints []models.Taint) error {
+	for key := range labels {
+		if key == "" {
+			return fmt.Errorf("labels: keys must not be empty")
+		}
+	}
+	for _, taint := range taints {
+		if taint.Key == "" {
+			return fmt.Errorf("taints: key is required")
+		}
+		if err := validateEffect(taint.Effect); err != nil {
+			return fmt.Errorf("taints: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateExpression(expr models.LabelExpression) error {
+	if expr.Key == "" {
+		return fmt.Errorf("key is required")
+	}
+	switch expr.Operator {
+	case models.LabelIn, models.LabelNotIn:
+		if len(expr.Values) == 0 {
+			return fmt.Errorf("%s %s needs at least one value", expr.Key, expr.Operator)
+		}
+	case models.LabelExists, models.LabelDoesNotExist:
+		if len(expr.Values) > 0 {
+			return fmt.Errorf("%s %s takes no values", expr.Key, expr.Operator)
+		}
+	case models.LabelGt, models.LabelLt:
+		if len(expr.Values) != 1 {
+			return fmt.Errorf("%s %s needs exactly one value", expr.Key, expr.Operator)
+		}
+		if _, err := strconv.ParseFloat(expr.Values[0], 64); err != nil {
+			return fmt.Errorf("%s %s needs a number, got %q", expr.Key, expr.Operator, expr.Values[0])
+		}
+	default:
+		return fmt.Errorf("unknown operator %q", expr.Operator)
+	}
+	return nil
+}
+
+func validateEffect(effect models.TaintEffect) error {
+	switch effect {
+	case models.TaintNoSchedule, models.TaintPreferNoSchedule:
+		return nil
+	default:
+		return fmt.Errorf("unknown effect %q, use no_schedule or prefer_no_schedule", effect)
+	}
+}
@@ -0,0 +1,177 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+func TestMatches(t *testing.T) {
+	labels := map[string]string{"gpu": "a100", "zone": "us-west-1", "cores": "16", "arch": "arm64"}
+	expr := func(key string, op models.LabelOperator, values ...string) models.LabelExpression {
+		return models.LabelExpression{Key: key, Operator: op, Values: values}
+	}
+
+	tests := []struct {
+		name string
+		expr models.LabelExpression
+		want bool
+	}{
+		{"in, listed", expr("gpu", models.LabelIn, "h100", "a100"), true},
+		{"in, not listed", expr("gpu", models.LabelIn, "h100"), false},
+		{"in, unset", expr("disk", models.LabelIn, "ssd"), false},
+		{"not_in, listed", expr("gpu", models.LabelNotIn, "a100"), false},
+		{"not_in, not listed", expr("gpu", models.LabelNotIn, "h100"), true},
+		{"not_in, unset", expr("disk", models.LabelNotIn, "hdd"), true},
+		{"exists, set", expr("zone", models.LabelExists), true},
+		{"exists, unset", expr("disk", models.LabelExists), false},
+		{"does_not_exist, set", expr("zone", models.LabelDoesNotExist), false},
+		{"does_not_exist, unset", expr("disk", models.LabelDoesNotExist), true},
+		{"gt, above", expr("cores", models.LabelGt, "8"), true},
+		{"gt, equal", expr("cores", models.LabelGt, "16"), false},
+		{"gt, below", expr("cores", models.LabelGt, "32"), false},
+		{"gt, fractional", expr("cores", models.LabelGt, "15.5"), true},
+		{"gt, unset", expr("memory", models.LabelGt, "8"), false},
+		{"gt, non-numeric label", expr("arch", models.LabelGt, "8"), false},
+		{"gt, non-numeric value", expr("cores", models.LabelGt, "many"), false},
+		{"gt, no value", expr("cores", models.LabelGt), false},
+		{"gt, two values", expr("cores", models.LabelGt, "8", "9"), false},
+		{"lt, below", expr("cores", models.LabelLt, "32"), true},
+		{"lt, equal", expr("cores", models.LabelLt, "16"), false},
+		{"lt, above", expr("cores", models.LabelLt, "8"), false},
+		{"lt, non-numeric label", expr("gpu", models.LabelLt, "8"), false},
+		{"lt, non-numeric value", expr("cores", models.LabelLt, "few"), false},
+		{"unknown operator", expr("gpu", "like", "a100"), false},
+	}
+
+	for _, tt := range tests {
+		if got := Matches(tt.expr, labels); got != tt.want {
+			t.Errorf("%s: Matches(%+v) = %t, want %t", tt.name, tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestAdmitsTolerations(t *testing.T) {
+	dedicated := models.Taint{Key: "dedicated", Value: "ml", Effect: models.TaintNoSchedule}
+	flaky := models.Taint{Key: "flaky-network", Effect: models.TaintPreferNoSchedule}
+
+	tests := []struct {
+		name        string
+		taints      []models.Taint
+		tolerations []models.Toleration
+		admitted    bool
+		preference  int
+	}{
+		{"untainted", nil, nil, true, 0},
+		{"no_schedule untolerated", []models.Taint{dedicated}, nil, false, 0},
+		{"equal, same value", []models.Taint{dedicated},
+			[]models.Toleration{{Key: "dedicated", Value: "ml"}}, true, 0},
+		{"equal, other value", []models.Taint{dedicated},
+			[]models.Toleration{{Key: "dedicated", Value: "batch"}}, false, 0},
+		{"equal, other key", []models.Taint{dedicated},
+			[]models.Toleration{{Key: "reserved", Value: "ml"}}, false, 0},
+		{"exists, same key", []models.Taint{dedicated},
+			[]models.Toleration{{Key: "dedicated", Operator: models.TolerationExists}}, true, 0},
+		{"exists, no key tolerates everything", []models.Taint{dedicated, flaky},
+			[]models.Toleration{{Operator: models.TolerationExists}}, true, 0},
+		{"matching effect", []models.Taint{dedicated},
+			[]models.Toleration{{Key: "dedicated", Value: "ml", Effect: models.TaintNoSchedule}}, true, 0},
+		{"other effect", []models.Taint{dedicated},
+			[]models.Toleration{{Key: "dedicated", Value: "ml", Effect: models.TaintPreferNoSchedule}}, false, 0},
+		{"prefer_no_schedule untolerated", []models.Taint{flaky}, nil, true, -1},
+		{"prefer_no_schedule tolerated", []models.Taint{flaky},
+			[]models.Toleration{{Key: "flaky-network", Operator: models.TolerationExists}}, true, 0},
+	}
+
+	for _, tt := range tests {
+		job := &models.Job{ID: "job-1", Tolerations: tt.tolerations}
+		node := &models.Node{ID: "node-a", Taints: tt.taints}
+		if admitted, why := Admits(job, node); admitted != tt.admitted {
+			t.Errorf("%s: Admits = %t (%s), want %t", tt.name, admitted, why, tt.admitted)
+		}
+		if tt.admitted {
+			if got := Preference(job, node); got != tt.preference {
+				t.Errorf("%s: Preference = %d, want %d", tt.name, got, tt.preference)
+			}
+		}
+	}
+}
+
+func TestValidateJob(t *testing.T) {
+	tests := []struct {
+		name        string
+		selector    map[string]string
+		affinity    models.NodeAffinity
+		tolerations []models.Toleration
+		valid       bool
+	}{
+		{"empty", nil, models.NodeAffinity{}, nil, true},
+		{"selector", map[string]string{"gpu": "a100"}, models.NodeAffinity{}, nil, true},
+		{"selector with empty key", map[string]string{"": "a100"}, models.NodeAffinity{}, nil, false},
+		{"required in", nil, models.NodeAffinity{Required: []models.LabelExpression{
+			{Key: "zone", Operator: models.LabelIn, Values: []string{"us-west-1"}}}}, nil, true},
+		{"required in without values", nil, models.NodeAffinity{Required: []models.LabelExpression{
+			{Key: "zone", Operator: models.LabelIn}}}, nil, false},
+		{"required exists with values", nil, models.NodeAffinity{Required: []models.LabelExpression{
+			{Key: "zone", Operator: models.LabelExists, Values: []string{"x"}}}}, nil, false},
+		{"required gt", nil, models.NodeAffinity{Required: []models.LabelExpression{
+			{Key: "cores", Operator: models.LabelGt, Values: []string{"8"}}}}, nil, true},
+		{"required gt non-numeric", nil, models.NodeAffinity{Required: []models.LabelExpression{
+			{Key: "cores", Operator: models.LabelGt, Values: []string{"eight"}}}}, nil, false},
+		{"required lt with two values", nil, models.NodeAffinity{Required: []models.LabelExpression{
+			{Key: "cores", Operator: models.LabelLt, Values: []string{"8", "9"}}}}, nil, false},
+		{"required without key", nil, models.NodeAffinity{Required: []models.LabelExpression{
+			{Operator: models.LabelExists}}}, nil, false},
+		{"required unknown operator", nil, models.NodeAffinity{Required: []models.LabelExpression{
+			{Key: "zone", Operator: "like"}}}, nil, false},
+		{"preferred", nil, models.NodeAffinity{Preferred: []models.PreferredExpression{
+			{Weight: 10, Expression: models.LabelExpression{Key: "gpu", Operator: models.LabelExists}}}}, nil, true},
+		{"preferred without weight", nil, models.NodeAffinity{Preferred: []models.PreferredExpression{
+			{Expression: models.LabelExpression{Key: "gpu", Operator: models.LabelExists}}}}, nil, false},
+		{"preferred invalid expression", nil, models.NodeAffinity{Preferred: []models.PreferredExpression{
+			{Weight: 1, Expression: models.LabelExpression{Key: "gpu", Operator: models.LabelNotIn}}}}, nil, false},
+		{"toleration equal", nil, models.NodeAffinity{},
+			[]models.Toleration{{Key: "dedicated", Value: "ml"}}, true},
+		{"toleration equal without key", nil, models.NodeAffinity{},
+			[]models.Toleration{{Value: "ml"}}, false},
+		{"toleration exists without key", nil, models.NodeAffinity{},
+			[]models.Toleration{{Operator: models.TolerationExists}}, true},
+		{"toleration exists with value", nil, models.NodeAffinity{},
+			[]models.Toleration{{Key: "dedicated", Operator: models.TolerationExists, Value: "ml"}}, false},
+		{"toleration unknown operator", nil, models.NodeAffinity{},
+			[]models.Toleration{{Key: "dedicated", Operator: "matches"}}, false},
+		{"toleration unknown effect", nil, models.NodeAffinity{},
+			[]models.Toleration{{Key: "dedicated", Value: "ml", Effect: "evict"}}, false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateJob(tt.selector, tt.affinity, tt.tolerations)
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("%s: ValidateJob = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateNode(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		taints []models.Taint
+		valid  bool
+	}{
+		{"empty", nil, nil, true},
+		{"labels and taints", map[string]string{"gpu": "a100", "spot": ""},
+			[]models.Taint{{Key: "dedicated", Value: "ml", Effect: models.TaintNoSchedule}}, true},
+		{"label with empty key", map[string]string{"": "a100"}, nil, false},
+		{"taint without key", nil, []models.Taint{{Value: "ml", Effect: models.TaintNoSchedule}}, false},
+		{"taint without effect", nil, []models.Taint{{Key: "dedicated"}}, false},
+		{"taint unknown effect", nil, []models.Taint{{Key: "dedicated", Effect: "evict"}}, false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateNode(tt.labels, tt.taints)
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("%s: ValidateNode = %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
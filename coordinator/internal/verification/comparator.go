@@ -0,0 +1,247 @@
+package verification
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+)
+
+// Comparator decides whether two completed executions produced equivalent results
+type Comparator interface {
+	Equivalent(a, b *models.JobExecution) bool
+}
+
+// NewComparator builds the comparator a job asked for. An empty spec compares
+// result hashes exactly.
+func NewComparator(spec models.ComparatorSpec) (Comparator, error) {
+	switch spec.Type {
+	case "", models.ComparatorExact:
+		return exactComparator{}, nil
+	case models.ComparatorCanonicalJSON:
+		return canonicalJSONComparator{}, nil
+	case models.ComparatorSet:
+		return setComparator{}, nil
+	case models.ComparatorNumericTolerance:
+		if spec.AbsTolerance < 0 || spec.RelTolerance < 0 {
+			return nil, fmt.Errorf("comparator tolerances must not be negative")
+		}
+		switch spec.Format {
+		case "", "json", "csv":
+		default:
+			return nil, fmt.Errorf("unknown comparator format %q", spec.Format)
+		}
+		return numericComparator{abs: spec.AbsTolerance, rel: spec.RelTolerance, csv: spec.Format == "csv"}, nil
+	default:
+		return nil, fmt.Errorf("unknown comparator type %q", spec.Type)
+	}
+}
+
+// resultCluster is a group of executions whose results are equivalent to its
+// first member
+type resultCluster struct {
+	representative *models.JobExecution
+	members        []*models.JobExecution
+}
+
+// clusterResults groups executions by equivalence. Tolerance-based comparisons
+// aren't transitive, so each execution joins the first cluster whose
+// representative it matches rather than any member.
+func clusterResults(executions []*models.JobExecution, comparator Comparator) []*resultCluster {
+	var clusters []*resultCluster
+	for _, exec := range executions {
+		var home *resultCluster
+		for _, cluster := range clusters {
+			if comparator.Equivalent(cluster.representative, exec) {
+				home = cluster
+				break
+			}
+		}
+		if home == nil {
+			home = &resultCluster{representative: exec}
+			clusters = append(clusters, home)
+		}
+		home.members = append(home.members, exec)
+	}
+	return clusters
+}
+
+type exactComparator struct{}
+
+func (exactComparator) Equivalent(a, b *models.JobExecution) bool {
+	return a.ResultHash == b.ResultHash
+}
+
+type canonicalJSONComparator struct{}
+
+func (canonicalJSONComparator) Equivalent(a, b *models.JobExecution) bool {
+	if a.ResultHash == b.ResultHash {
+		return true
+	}
+	left, err := decodeJSONValues(a.Result, false)
+	if err != nil {
+		return false
+	}
+	right, err := decodeJSONValues(b.Result, false)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+type setComparator struct{}
+
+func (setComparator) Equivalent(a, b *models.JobExecution) bool {
+	if a.ResultHash == b.ResultHash {
+		return true
+	}
+	return reflect.DeepEqual(lineSet(a.Result), lineSet(b.Result))
+}
+
+// lineSet returns the distinct non-empty lines of a result
+func lineSet(result string) map[string]bool {
+	set := make(map[string]bool)
+	for _, line := range strings.Split(result, "\n") {
+		if line != "" {
+			set[line] = true
+		}
+	}
+	return set
+}
+
+type numericComparator struct {
+	abs, rel float64
+	csv      bool
+}
+
+func (c numericComparator) Equivalent(a, b *models.JobExecution) bool {
+	if a.ResultHash == b.ResultHash {
+		return true
+	}
+	if c.csv {
+		return c.csvEqual(a.Result, b.Result)
+	}
+
+	left, err := decodeJSONValues(a.Result, true)
+	if err != nil {
+		return false
+	}
+	right, err := decodeJSONValues(b.Result, true)
+	if err != nil {
+		return false
+	}
+	return c.jsonEqual(left, right)
+}
+
+func (c numericComparator) close(x, y float64) bool {
+	diff := math.Abs(x - y)
+	if diff <= c.abs {
+		return true
+	}
+	return diff <= c.rel*math.Max(math.Abs(x), math.Abs(y))
+}
+
+// jsonEqual compares two decoded JSON values structurally, allowing numbers
+// to differ within tolerance
+func (c numericComparator) jsonEqual(x, y interface{}) bool {
+	switch xv := x.(type) {
+	case json.Number:
+		yv, ok := y.(json.Number)
+		if !ok {
+			return false
+		}
+		xf, errX := xv.Float64()
+		yf, errY := yv.Float64()
+		return errX == nil && errY == nil && c.close(xf, yf)
+	case map[string]interface{}:
+		yv, ok := y.(map[string]interface{})
+		if !ok || len(xv) != len(yv) {
+			return false
+		}
+		for key, value := range xv {
+			other, ok := yv[key]
+			if !ok || !c.jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		yv, ok := y.([]interface{})
+		if !ok || len(xv) != len(yv) {
+			return false
+		}
+		for i := range xv {
+			if !c.jsonEqual(xv[i], yv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(x, y)
+	}
+}
+
+// csvEqual compares two CSV documents cell by cell. Cells that parse as
+// numbers on both sides are compared within tolerance, others exactly.
+func (c numericComparator) csvEqual(x, y string) bool {
+	left, err := csv.NewReader(strings.NewReader(x)).ReadAll()
+	if err != nil {
+		return false
+	}
+	right, err := csv.NewReader(strings.NewReader(y)).ReadAll()
+	if err != nil || len(left) != len(right) {
+		return false
+	}
+
+	for i := range left {
+		if len(left[i]) != len(right[i]) {
+			return false
+		}
+		for j := range left[i] {
+			lc, rc := strings.TrimSpace(left[i][j]), strings.TrimSpace(right[i][j])
+			lf, errL := strconv.ParseFloat(lc, 64)
+			rf, errR := strconv.ParseFloat(rc, 64)
+			if errL == nil && errR == nil {
+				if !c.close(lf, rf) {
+					return false
+				}
+			} else if lc != rc {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// decodeJSONValues decodes every JSON value in a result, which may be a single
+// document or JSON lines. useNumber keeps numbers as json.Number.
+func decodeJSONValues(result string, useNumber bool) ([]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(result))
+	if useNumber {
+		decoder.UseNumber()
+	}
+
+	var values []interface{}
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no JSON value")
+	}
+	return values, nil
+}
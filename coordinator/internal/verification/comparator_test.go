@@ -0,0 +1,166 @@
+package verification
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/normalize"
+)
+
+// result returns a completed execution reporting output, hashed as workers do
+func result(id, output string) *models.JobExecution {
+	return &models.JobExecution{
+		ID: id, NodeID: "node-" + id, Status: models.JobStatusCompleted,
+		Result: output, ResultHash: normalize.Hash(output),
+	}
+}
+
+func TestComparators(t *testing.T) {
+	tests := []struct {
+		name string
+		spec models.ComparatorSpec
+		a, b string
+		want bool
+	}{
+		{"exact same", models.ComparatorSpec{}, "42", "42", true},
+		{"exact different", models.ComparatorSpec{}, "42", "42.0", false},
+
+		{"json within abs", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 0.5},
+			`{"loss": 1}`, `{"loss": 1.25}`, true},
+		{"json on abs boundary", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 0.5},
+			`{"loss": 1}`, `{"loss": 1.5}`, true},
+		{"json past abs boundary", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 0.5},
+			`{"loss": 1}`, `{"loss": 1.5000001}`, false},
+		{"json on rel boundary", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, RelTolerance: 0.25},
+			`[100, 3]`, `[75, 3]`, true},
+		{"json past rel boundary", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, RelTolerance: 0.25},
+			`[100, 3]`, `[74, 3]`, false},
+		{"json no tolerance", models.ComparatorSpec{Type: models.ComparatorNumericTolerance},
+			`{"n": 1}`, `{"n": 1.0}`, true},
+		{"json key order", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 0.5},
+			`{"a": 1, "b": "x"}`, `{"b": "x", "a": 1.1}`, true},
+		{"json strings compared exactly", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 10},
+			`{"label": "1"}`, `{"label": "2"}`, false},
+		{"json number against string", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 10},
+			`{"n": 1}`, `{"n": "1"}`, false},
+		{"json missing key", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 10},
+			`{"a": 1, "b": 2}`, `{"a": 1, "c": 2}`, false},
+		{"json array length", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 10},
+			`[1, 2]`, `[1, 2, 3]`, false},
+		{"json lines", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 0.5},
+			"{\"n\": 1}\n{\"n\": 2}\n", "{\"n\": 1.1}\n{\"n\": 2.1}\n", true},
+		{"json lines count", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 0.5},
+			"{\"n\": 1}\n{\"n\": 2}\n", "{\"n\": 1}\n", false},
+		{"json malformed", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 10},
+			`{"n": 1}`, `{"n": 1`, false},
+		{"json empty", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 10},
+			`{"n": 1}`, ``, false},
+
+		{"csv within tolerance", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, Format: "csv", AbsTolerance: 0.5},
+			"id,score\na,1\nb,2\n", "id,score\na,1.5\nb, 2.25\n", true},
+		{"csv past tolerance", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, Format: "csv", AbsTolerance: 0.5},
+			"id,score\na,1\n", "id,score\na,1.75\n", false},
+		{"csv text cells compared exactly", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, Format: "csv", AbsTolerance: 0.5},
+			"id,score\na,1\n", "id,score\nb,1\n", false},
+		{"csv number against text", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, Format: "csv", AbsTolerance: 0.5},
+			"a,1\n", "a,one\n", false},
+		{"csv row count", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, Format: "csv", AbsTolerance: 0.5},
+			"a,1\nb,2\n", "a,1\n", false},
+		{"csv malformed", models.ComparatorSpec{Type: models.ComparatorNumericTolerance, Format: "csv", AbsTolerance: 0.5},
+			"a,1\n", "a,\"1\n", false},
+
+		{"set ignores order and duplicates", models.ComparatorSpec{Type: models.ComparatorSet},
+			"b\na\nc\n", "a\nc\nb\na\n", true},
+		{"set ignores blank lines", models.ComparatorSpec{Type: models.ComparatorSet},
+			"a\n\nb", "b\na\n", true},
+		{"set missing line", models.ComparatorSpec{Type: models.ComparatorSet},
+			"a\nb\n", "a\n", false},
+		{"set lines compared exactly", models.ComparatorSpec{Type: models.ComparatorSet},
+			"a\nb\n", "a\nb \n", false},
+
+		{"canonical json key order and spacing", models.ComparatorSpec{Type: models.ComparatorCanonicalJSON},
+			`{"a": 1, "b": [1, 2]}`, `{"b":[1,2],"a":1}`, true},
+		{"canonical json array order", models.ComparatorSpec{Type: models.ComparatorCanonicalJSON},
+			`[1, 2]`, `[2, 1]`, false},
+		{"canonical json values", models.ComparatorSpec{Type: models.ComparatorCanonicalJSON},
+			`{"a": 1}`, `{"a": 1.001}`, false},
+		{"canonical json lines", models.ComparatorSpec{Type: models.ComparatorCanonicalJSON},
+			"{\"a\": 1, \"b\": 2}\n[3]\n", "{\"b\":2,\"a\":1}\n[3]", true},
+		{"canonical json malformed", models.ComparatorSpec{Type: models.ComparatorCanonicalJSON},
+			`{"a": 1}`, `{"a": 1,}`, false},
+	}
+
+	for _, tt := range tests {
+		comparator, err := NewComparator(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: NewComparator: %v", tt.name, err)
+		}
+		a, b := result("a", tt.a), result("b", tt.b)
+		if got := comparator.Equivalent(a, b); got != tt.want {
+			t.Errorf("%s: Equivalent(%q, %q) = %t, want %t", tt.name, tt.a, tt.b, got, tt.want)
+		}
+		if got := comparator.Equivalent(b, a); got != tt.want {
+			t.Errorf("%s: Equivalent(%q, %q) = %t, want %t", tt.name, tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestNewComparatorRejectsInvalidSpecs(t *testing.T) {
+	tests := []models.ComparatorSpec{
+		{Type: "fuzzy"},
+		{Type: models.ComparatorNumericTolerance, AbsTolerance: -1},
+		{Type: models.ComparatorNumericTolerance, RelTolerance: -0.1},
+		{Type: models.ComparatorNumericTolerance, Format: "xml"},
+	}
+
+	for _, spec := range tests {
+		if _, err := NewComparator(spec); err == nil {
+			t.Errorf("NewComparator(%+v) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestClusterResultsJoinsFirstMatchingRepresentative(t *testing.T) {
+	// Tolerance isn't transitive: 0.8 is close to both 0 and 1.6, which are
+	// not close to each other, so the grouping depends on which comes first
+	comparator, err := NewComparator(models.ComparatorSpec{Type: models.ComparatorNumericTolerance, AbsTolerance: 1})
+	if err != nil {
+		t.Fatalf("NewComparator: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		results []string
+		want    [][]string // Member IDs of each cluster, in order
+	}{
+		{"low end first", []string{"0", "0.8", "1.6"}, [][]string{{"e0", "e1"}, {"e2"}}},
+		{"middle first", []string{"0.8", "0", "1.6"}, [][]string{{"e0", "e1", "e2"}}},
+		{"high end first", []string{"1.6", "0", "0.8"}, [][]string{{"e0", "e2"}, {"e1"}}},
+		{"ties join the earlier cluster", []string{"0", "2", "1"}, [][]string{{"e0", "e2"}, {"e1"}}},
+	}
+
+	for _, tt := range tests {
+		var executions []*models.JobExecution
+		for i, output := range tt.results {
+			executions = append(executions, result(fmt.Sprintf("e%d", i), output))
+		}
+
+		var got [][]string
+		for _, cluster := range clusterResults(executions, comparator) {
+			var ids []string
+			for _, exec := range cluster.members {
+				ids = append(ids, exec.ID)
+			}
+			if cluster.representative != cluster.members[0] {
+				t.Errorf("%s: cluster represented by %s, want its first member %s",
+					tt.name, cluster.representative.ID, cluster.members[0].ID)
+			}
+			got = append(got, ids)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: clusters %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,18 +1,23 @@
 package verification
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"time"
+
 	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/normalize"
 	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
 	log "github.com/sirupsen/logrus"
 )
 
 // Verifier handles k-of-n verification for job results
 type Verifier struct {
-	db *repository.Database
+	db repository.Store
 }
 
-func NewVerifier(db *repository.Database) *Verifier {
+func NewVerifier(db repository.Store) *Verifier {
 	return &Verifier{db: db}
 }
 
@@ -25,24 +30,27 @@ func (v *Verifier) VerifyJob(jobID string) (*models.VerificationResult, error) {
 		return nil, fmt.Errorf("failed to get job: %w", err)
 	}
 
+	// A cancelled or timed out job is never verified, so its nodes are neither
+	// rewarded nor penalized
+	if job.Status == models.JobStatusCancelled || job.Status == models.JobStatusTimedOut {
+		return &models.VerificationResult{JobID: jobID}, nil
+	}
+
 	// Get all executions for this job
 	executions, err := v.db.GetJobExecutions(jobID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get executions: %w", err)
 	}
 
-	// Filter only completed executions
-	var completedExecutions []*models.JobExecution
-	for _, exec := range executions {
-		if exec.Status == models.JobStatusCompleted && exec.ResultHash != "" {
-			completedExecutions = append(completedExecutions, exec)
-		}
-	}
+	completedExecutions := completedResults(executions)
 
 	log.Infof("Job %s: %d/%d executions completed", jobID, len(completedExecutions), job.Redundancy)
 
+	// Weighted jobs also count each vote by the node's track record
+	weighted := job.ConsensusWeight > 0
+
 	// Check if we have enough completed executions
-	if len(completedExecutions) < job.Consensus {
+	if len(completedExecutions) == 0 || len(completedExecutions) < job.Consensus {
 		return &models.VerificationResult{
 			JobID:            jobID,
 			TotalExecutions:  len(completedExecutions),
@@ -50,39 +58,57 @@ func (v *Verifier) VerifyJob(jobID string) (*models.VerificationResult, error) {
 		}, nil
 	}
 
-	// Count result hashes
-	resultCounts := make(map[string]int)
-	resultData := make(map[string]string) // hash -> actual result
-	hashToNodes := make(map[string][]string) // hash -> node IDs
+	comparator, err := NewComparator(job.Comparator)
+	if err != nil {
+		return nil, fmt.Errorf("job %s: %w", jobID, err)
+	}
+
+	// Group equivalent results; each group is counted under the hash of its
+	// first result
+	clusters := clusterResults(completedExecutions, comparator)
 
-	for _, exec := range completedExecutions {
-		resultCounts[exec.ResultHash]++
-		resultData[exec.ResultHash] = exec.Result
-		hashToNodes[exec.ResultHash] = append(hashToNodes[exec.ResultHash], exec.NodeID)
+	var nodeWeights map[string]float64
+	if weighted {
+		nodeWeights = v.nodeWeights(completedExecutions, time.Now())
 	}
 
-	// Find the result with most votes
-	var consensusHash string
-	maxVotes := 0
+	resultCounts := make(map[string]int)
+	resultWeights := make(map[string]float64)
+	var consensus *resultCluster
+	for _, cluster := range clusters {
+		hash := cluster.representative.ResultHash
+		resultCounts[hash] += len(cluster.members)
+		for _, exec := range cluster.members {
+			resultWeights[hash] += nodeWeights[exec.NodeID]
+		}
 
-	for hash, count := range resultCounts {
-		if count > maxVotes {
-			maxVotes = count
-			consensusHash = hash
+		if consensus == nil {
+			consensus = cluster
+		} else if weighted && resultWeights[hash] > resultWeights[consensus.representative.ResultHash] {
+			consensus = cluster
+		} else if !weighted && len(cluster.members) > len(consensus.members) {
+			consensus = cluster
 		}
 	}
 
-	// Check if consensus threshold is met
-	consensusReached := maxVotes >= job.Consensus
+	// Check if consensus threshold is met. Weighted jobs need their weight on
+	// top of the votes, so a single heavy node can't decide alone.
+	consensusHash := consensus.representative.ResultHash
+	consensusReached := len(consensus.members) >= job.Consensus
+	if weighted && resultWeights[consensusHash] < job.ConsensusWeight {
+		consensusReached = false
+	}
 
 	// Identify agreeing and disagreeing nodes
 	var agreementNodes, disagreementNodes []string
 
-	for hash, nodes := range hashToNodes {
-		if hash == consensusHash {
-			agreementNodes = append(agreementNodes, nodes...)
-		} else {
-			disagreementNodes = append(disagreementNodes, nodes...)
+	for _, cluster := range clusters {
+		for _, exec := range cluster.members {
+			if cluster == consensus {
+				agreementNodes = append(agreementNodes, exec.NodeID)
+			} else {
+				disagreementNodes = append(disagreementNodes, exec.NodeID)
+			}
 		}
 	}
 
@@ -90,66 +116,169 @@ func (v *Verifier) VerifyJob(jobID string) (*models.VerificationResult, error) {
 		JobID:             jobID,
 		TotalExecutions:   len(completedExecutions),
 		ResultCounts:      resultCounts,
-		ConsensusResult:   resultData[consensusHash],
+		ConsensusResult:   consensus.representative.Result,
 		ConsensusReached:  consensusReached,
 		AgreementNodes:    agreementNodes,
 		DisagreementNodes: disagreementNodes,
 	}
-
-	// Update node reputations based on agreement/disagreement
-	if consensusReached {
-		v.updateNodeReputations(agreementNodes, disagreementNodes)
+	if weighted {
+		result.NodeWeights = nodeWeights
+		result.ResultWeights = resultWeights
+		result.ConsensusWeight = resultWeights[consensusHash]
+		result.RequiredWeight = job.ConsensusWeight
 	}
 
 	return result, nil
 }
 
-// updateNodeReputations adjusts reputation scores based on verification results
-func (v *Verifier) updateNodeReputations(agreementNodes, disagreementNodes []string) {
-	// Reward nodes that agreed with consensus
-	for _, nodeID := range agreementNodes {
-		if err := v.db.UpdateNodeReputation(nodeID, 5.0); err != nil {
-			log.Warnf("Failed to update reputation for node %s: %v", nodeID, err)
+// completedResults returns the completed executions, each hashed from the
+// result it reported. Workers apply the job's normalization rules before
+// reporting, and they are not applied again: a rule such as a regex strip may
+// change an already normalized result. Hashing the result rather than
+// trusting each worker's hash keeps a node from claiming agreement with a
+// result it didn't return. The executions returned are copies; the caller's
+// keep the hashes their workers reported.
+func completedResults(executions []*models.JobExecution) []*models.JobExecution {
+	var completed []*models.JobExecution
+	for _, exec := range executions {
+		if exec.Status == models.JobStatusCompleted && exec.ResultHash != "" {
+			hashed := *exec
+			hashed.ResultHash = normalize.Hash(exec.Result)
+			completed = append(completed, &hashed)
 		}
-		if err := v.db.IncrementNodeStats(nodeID, true, 1); err != nil {
-			log.Warnf("Failed to update stats for node %s: %v", nodeID, err)
+	}
+	return completed
+}
+
+// ResultGroups groups the completed executions of job into sets of equivalent
+// results the way verification does, for analysis outside a single job's
+// consensus
+func ResultGroups(job *models.Job, executions []*models.JobExecution) ([][]*models.JobExecution, error) {
+	comparator, err := NewComparator(job.Comparator)
+	if err != nil {
+		return nil, fmt.Errorf("job %s: %w", job.ID, err)
+	}
+
+	var groups [][]*models.JobExecution
+	for _, cluster := range clusterResults(completedResults(executions), comparator) {
+		groups = append(groups, cluster.members)
+	}
+	return groups, nil
+}
+
+// ConsensusShortfall reports how many more agreeing votes job needs than its
+// outstanding executions could still deliver, assuming they all join the
+// leading result group. Zero means consensus is still possible. groups holds
+// the size of each group of equivalent results so far. Weighted jobs report a
+// shortfall of at least one while the weight in reach is below their threshold.
+func (v *Verifier) ConsensusShortfall(job *models.Job, executions []*models.JobExecution) (shortfall int, groups []int, err error) {
+	completed := completedResults(executions)
+	if len(completed) == 0 {
+		return 0, nil, nil
+	}
+
+	var outstanding []*models.JobExecution
+	for _, exec := range executions {
+		if exec.Status == models.JobStatusScheduled || exec.Status == models.JobStatusRunning {
+			outstanding = append(outstanding, exec)
 		}
 	}
 
-	// Penalize nodes that disagreed
-	for _, nodeID := range disagreementNodes {
-		if err := v.db.UpdateNodeReputation(nodeID, -10.0); err != nil {
-			log.Warnf("Failed to update reputation for node %s: %v", nodeID, err)
+	comparator, err := NewComparator(job.Comparator)
+	if err != nil {
+		return 0, nil, fmt.Errorf("job %s: %w", job.ID, err)
+	}
+
+	clusters := clusterResults(completed, comparator)
+	best := 0
+	for _, cluster := range clusters {
+		groups = append(groups, len(cluster.members))
+		best = maxInt(best, len(cluster.members))
+	}
+
+	shortfall = maxInt(job.Consensus-best-len(outstanding), 0)
+	if job.ConsensusWeight > 0 {
+		weights := v.nodeWeights(append(completed, outstanding...), time.Now())
+		bestWeight := 0.0
+		for _, cluster := range clusters {
+			clusterWeight := 0.0
+			for _, exec := range cluster.members {
+				clusterWeight += weights[exec.NodeID]
+			}
+			bestWeight = math.Max(bestWeight, clusterWeight)
+		}
+		for _, exec := range outstanding {
+			bestWeight += weights[exec.NodeID]
 		}
-		if err := v.db.IncrementNodeStats(nodeID, false, 0); err != nil {
-			log.Warnf("Failed to update stats for node %s: %v", nodeID, err)
+		if bestWeight < job.ConsensusWeight {
+			shortfall = maxInt(shortfall, 1)
 		}
 	}
 
-	log.Infof("Updated reputations: %d rewarded, %d penalized",
-		len(agreementNodes), len(disagreementNodes))
+	return shortfall, groups, nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
 }
 
-// CheckAndFinalizeJob checks if a job is ready for verification and finalizes it
-func (v *Verifier) CheckAndFinalizeJob(jobID string) error {
+// nodeRewards adjusts reputation based on a verification result: nodes that
+// agreed with consensus are rewarded, nodes that disagreed are penalized.
+// Only completed executions vote; cancelled or failed ones never move
+// reputation.
+func nodeRewards(result *models.VerificationResult) []models.NodeReward {
+	var rewards []models.NodeReward
+	for _, nodeID := range result.AgreementNodes {
+		rewards = append(rewards, models.NodeReward{NodeID: nodeID, Reputation: 5.0, Success: true, Credits: 1})
+	}
+	for _, nodeID := range result.DisagreementNodes {
+		rewards = append(rewards, models.NodeReward{NodeID: nodeID, Reputation: -10.0})
+	}
+	return rewards
+}
+
+// CheckAndFinalizeJob checks if a job is ready for verification and finalizes
+// it, reporting whether consensus was reached. The job's result and the
+// nodes' reputations are saved together; if another coordinator is
+// finalizing the job, or already has, this one leaves it to them.
+func (v *Verifier) CheckAndFinalizeJob(jobID string) (bool, error) {
 	result, err := v.VerifyJob(jobID)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if !result.ConsensusReached {
 		log.Infof("Job %s: Consensus not yet reached (%d/%d executions)",
 			jobID, result.TotalExecutions, len(result.ResultCounts))
-		return nil
+		return false, nil
 	}
 
 	// Finalize the job with the consensus result
-	log.Infof("Job %s: Consensus reached! %d nodes agreed", jobID, len(result.AgreementNodes))
+	if result.RequiredWeight > 0 {
+		log.Infof("Job %s: Consensus reached! %d nodes agreed with weight %.2f of %.2f required",
+			jobID, len(result.AgreementNodes), result.ConsensusWeight, result.RequiredWeight)
+	} else {
+		log.Infof("Job %s: Consensus reached! %d nodes agreed", jobID, len(result.AgreementNodes))
+	}
 
-	err = v.db.UpdateJobStatus(jobID, models.JobStatusCompleted, result.ConsensusResult, "")
+	err = v.db.FinalizeJob(jobID, &models.JobOutcome{
+		Status:       models.JobStatusCompleted,
+		Result:       result.ConsensusResult,
+		Verification: result,
+		Rewards:      nodeRewards(result),
+	})
+	if errors.Is(err, repository.ErrLocked) || errors.Is(err, models.ErrInvalidTransition) {
+		log.Infof("Job %s: left to the coordinator already finalizing it (%v)", jobID, err)
+		return true, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to finalize job: %w", err)
+		return false, fmt.Errorf("failed to finalize job: %w", err)
 	}
 
-	return nil
+	log.Infof("Updated reputations: %d rewarded, %d penalized",
+		len(result.AgreementNodes), len(result.DisagreementNodes))
+	return true, nil
 }
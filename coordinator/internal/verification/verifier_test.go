@@ -0,0 +1,158 @@
+package verification
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	"github.com/HildaPosada/distributeai/coordinator/internal/normalize"
+	"github.com/HildaPosada/distributeai/coordinator/internal/repository"
+)
+
+func TestVerifyJobDoesNotNormalizeTwice(t *testing.T) {
+	db := repository.NewMemoryStore()
+	now := time.Now()
+	for _, id := range []string{"node-a", "node-b"} {
+		err := db.RegisterNode(&models.Node{
+			ID: id, Name: id, CPUCores: 4, MemoryGB: 8, Status: models.NodeStatusOnline,
+			ReputationScore: 100, LastHeartbeat: now, RegisteredAt: now, MaxSlots: 1,
+		})
+		if err != nil {
+			t.Fatalf("RegisterNode(%s): %v", id, err)
+		}
+	}
+
+	// Workers strip "ab" from "aabb" and report "ab"; stripping again would
+	// leave ""
+	job := &models.Job{
+		ID: "job-1", Name: "build", DockerImage: "alpine:3", Command: []string{"echo", "aabb"},
+		RequiredCPU: 1, RequiredMemory: 1, Redundancy: 2, Consensus: 2,
+		Normalize: []models.NormalizationRule{{Type: models.NormalizeStripRegex, Pattern: "ab"}},
+		Status:    models.JobStatusPending, SubmittedAt: now,
+	}
+	if err := db.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	deadline := now.Add(time.Minute)
+	var executions []*models.JobExecution
+	for _, nodeID := range []string{"node-a", "node-b"} {
+		executions = append(executions, &models.JobExecution{
+			ID: "exec-" + nodeID, JobID: job.ID, NodeID: nodeID, Status: models.JobStatusScheduled,
+			StartedAt: now, LeaseExpiresAt: &deadline,
+		})
+	}
+	if err := db.ScheduleJob(job.ID, executions); err != nil {
+		t.Fatalf("ScheduleJob: %v", err)
+	}
+	for _, exec := range executions {
+		if _, err := db.ClaimJobExecution(exec.ID, exec.NodeID, time.Minute); err != nil {
+			t.Fatalf("ClaimJobExecution: %v", err)
+		}
+		exec.Status, exec.CompletedAt = models.JobStatusCompleted, &now
+		exec.Result, exec.ResultHash = "ab", normalize.Hash("ab")
+		if err := db.FinishJobExecution(exec); err != nil {
+			t.Fatalf("FinishJobExecution: %v", err)
+		}
+	}
+
+	result, err := NewVerifier(db).VerifyJob(job.ID)
+	if err != nil {
+		t.Fatalf("VerifyJob: %v", err)
+	}
+	if !result.ConsensusReached || result.ConsensusResult != "ab" {
+		t.Errorf("consensus %v on %q, want reached on the reported result %q",
+			result.ConsensusReached, result.ConsensusResult, "ab")
+	}
+	if result.ResultCounts[normalize.Hash("ab")] != 2 {
+		t.Errorf("result counts %v, want both votes under the workers' hash", result.ResultCounts)
+	}
+}
+
+func TestWeightedConsensusNeedsVotesAndWeight(t *testing.T) {
+	now := time.Now()
+	veteran, newcomer := now.Add(-60*24*time.Hour), now
+	tests := []struct {
+		name       string
+		registered []time.Time // One agreeing node each
+		reached    bool
+	}{
+		{"one veteran outweighs the threshold alone", []time.Time{veteran}, false},
+		{"two newcomers fall short of the weight", []time.Time{newcomer, newcomer}, false},
+		{"two veterans", []time.Time{veteran, veteran}, true},
+	}
+
+	for _, tt := range tests {
+		db := repository.NewMemoryStore()
+		job := &models.Job{
+			ID: "job-1", Name: "build", DockerImage: "alpine:3", Command: []string{"echo", "ok"},
+			RequiredCPU: 1, RequiredMemory: 1, Redundancy: 3, Consensus: 2, ConsensusWeight: 2,
+			Status: models.JobStatusPending, SubmittedAt: now,
+		}
+		if err := db.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		deadline := now.Add(time.Minute)
+		var executions []*models.JobExecution
+		for i, registeredAt := range tt.registered {
+			nodeID := fmt.Sprintf("node-%d", i)
+			err := db.RegisterNode(&models.Node{
+				ID: nodeID, Name: nodeID, CPUCores: 4, MemoryGB: 8, Status: models.NodeStatusOnline,
+				ReputationScore: 200, LastHeartbeat: now, RegisteredAt: registeredAt, MaxSlots: 1,
+			})
+			if err != nil {
+				t.Fatalf("RegisterNode(%s): %v", nodeID, err)
+			}
+			executions = append(executions, &models.JobExecution{
+				ID: "exec-" + nodeID, JobID: job.ID, NodeID: nodeID, Status: models.JobStatusScheduled,
+				StartedAt: now, LeaseExpiresAt: &deadline,
+			})
+		}
+		if err := db.ScheduleJob(job.ID, executions); err != nil {
+			t.Fatalf("ScheduleJob: %v", err)
+		}
+		for _, exec := range executions {
+			if _, err := db.ClaimJobExecution(exec.ID, exec.NodeID, time.Minute); err != nil {
+				t.Fatalf("ClaimJobExecution: %v", err)
+			}
+			exec.Status, exec.CompletedAt = models.JobStatusCompleted, &now
+			exec.Result, exec.ResultHash = "ok", normalize.Hash("ok")
+			if err := db.FinishJobExecution(exec); err != nil {
+				t.Fatalf("FinishJobExecution: %v", err)
+			}
+		}
+
+		result, err := NewVerifier(db).VerifyJob(job.ID)
+		if err != nil {
+			t.Fatalf("%s: VerifyJob: %v", tt.name, err)
+		}
+		if result.ConsensusReached != tt.reached {
+			t.Errorf("%s: consensus reached = %t with weight %.2f, want %t",
+				tt.name, result.ConsensusReached, result.ConsensusWeight, tt.reached)
+		}
+	}
+}
+
+func TestResultGroupsLeavesExecutionsUntouched(t *testing.T) {
+	job := &models.Job{ID: "job-1"}
+	executions := []*models.JobExecution{
+		{ID: "exec-a", NodeID: "node-a", Status: models.JobStatusCompleted, Result: "ok", ResultHash: "forged"},
+		{ID: "exec-b", NodeID: "node-b", Status: models.JobStatusCompleted, Result: "ok", ResultHash: normalize.Hash("ok")},
+	}
+
+	groups, err := ResultGroups(job, executions)
+	if err != nil {
+		t.Fatalf("ResultGroups: %v", err)
+	}
+	if len(groups) != 1 || len(groups[0]) != 2 {
+		t.Fatalf("ResultGroups = %d groups, want both results in one", len(groups))
+	}
+	if executions[0].ResultHash != "forged" {
+		t.Errorf("caller's execution hash rewritten to %q, want the reported hash kept", executions[0].ResultHash)
+	}
+	for _, exec := range groups[0] {
+		if exec.ResultHash != normalize.Hash("ok") {
+			t.Errorf("grouped execution %s has hash %q, want the recomputed hash", exec.ID, exec.ResultHash)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package verification
+
+import (
+	"math"
+	"time"
+
+	"github.com/HildaPosada/distributeai/coordinator/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Vote weighting for weighted consensus. A node that has been around for
+// tenureRamp with the starting reputation casts a vote of weight 1.
+const (
+	baseReputation  = 100.0 // Reputation of a newly registered node
+	tenureRamp      = 30 * 24 * time.Hour
+	minTenureFactor = 0.25 // Weight multiplier for a brand-new node
+)
+
+// MaxVoteWeight caps how much one veteran can outvote others. A job can never
+// gather more weight than this times the number of nodes it may run on.
+const MaxVoteWeight = 2.0
+
+// voteWeight scores a node's vote by its reputation relative to a new node's,
+// scaled from minTenureFactor up to 1 over its first tenureRamp in the network
+func voteWeight(node *models.Node, now time.Time) float64 {
+	reputation := math.Min(node.ReputationScore/baseReputation, MaxVoteWeight)
+	if reputation < 0 {
+		reputation = 0
+	}
+
+	tenure := float64(now.Sub(node.RegisteredAt)) / float64(tenureRamp)
+	tenureFactor := minTenureFactor + (1-minTenureFactor)*math.Min(math.Max(tenure, 0), 1)
+
+	return reputation * tenureFactor
+}
+
+// nodeWeights returns the vote weight of every node that ran one of executions.
+// Nodes that can't be loaded get no weight.
+func (v *Verifier) nodeWeights(executions []*models.JobExecution, now time.Time) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, exec := range executions {
+		if _, ok := weights[exec.NodeID]; ok {
+			continue
+		}
+		node, err := v.db.GetNode(exec.NodeID)
+		if err != nil {
+			log.Warnf("Failed to load node %s for weighting: %v", exec.NodeID, err)
+			weights[exec.NodeID] = 0
+			continue
+		}
+		weights[exec.NodeID] = voteWeight(node, now)
+	}
+	return weights
+}
@@ -2,30 +2,69 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/HildaPosada/distributeai/worker/internal/client"
 	"github.com/HildaPosada/distributeai/worker/internal/executor"
 	"github.com/HildaPosada/distributeai/worker/internal/monitor"
+	"github.com/HildaPosada/distributeai/worker/internal/pool"
 	log "github.com/sirupsen/logrus"
 )
 
 type Worker struct {
-	id              string
-	name            string
-	region          string
-	cpuCores        int
-	memoryGB        int
-	gpuEnabled      bool
-	client          *client.CoordinatorClient
-	executor        *executor.DockerExecutor
-	monitor         *monitor.SystemMonitor
-	activeJobs      int
-	stopChan        chan struct{}
+	id         string
+	name       string
+	region     string
+	owner      string
+	host       string
+	price      float64
+	labels     map[string]string
+	taints     []client.Taint
+	cpuCores   int
+	memoryGB   int
+	gpuEnabled bool
+	client     *client.CoordinatorClient
+	executor   *executor.DockerExecutor
+	monitor    *monitor.SystemMonitor
+	slots      *pool.ResourcePool
+	stopChan   chan struct{}
+	pollStop   chan struct{}  // Closed to stop taking new work
+	pollDone   chan struct{}  // Closed once the polling loop has returned
+	inflight   sync.WaitGroup // Executions started and not yet reported
+
+	mu      sync.Mutex
+	running map[string]*runningExecution // by execution ID
+}
+
+// runningExecution tracks an execution in flight so the coordinator can revoke it
+type runningExecution struct {
+	cancel  context.CancelFunc
+	revoked chan struct{}
+	once    sync.Once
+}
+
+// revoke stops the execution; its result will be discarded
+func (r *runningExecution) revoke() {
+	r.once.Do(func() {
+		close(r.revoked)
+		r.cancel()
+	})
+}
+
+func (r *runningExecution) isRevoked() bool {
+	select {
+	case <-r.revoked:
+		return true
+	default:
+		return false
+	}
 }
 
 func main() {
@@ -38,15 +77,26 @@ func main() {
 	coordinatorURL := getEnv("COORDINATOR_URL", "http://localhost:8080")
 	workerID := getEnv("WORKER_ID", "worker-"+monitor.GetHostname())
 	workerName := getEnv("WORKER_NAME", "Worker Node")
-	region := getEnv("WORKER_REGION", "unknown")
+	region := getEnv("WORKER_REGION", "")
+	owner := getEnv("WORKER_OWNER", "")
+	host := getEnv("WORKER_HOST", "")
+	price := getEnvFloat("WORKER_PRICE", 0)
+	labels := parseLabels(getEnv("WORKER_LABELS", ""))
+	taints, err := parseTaints(getEnv("WORKER_TAINTS", ""))
+	if err != nil {
+		log.Fatalf("Invalid WORKER_TAINTS: %v", err)
+	}
 	cpuCores := getEnvInt("CPU_CORES", 4)
 	memoryGB := getEnvInt("MEMORY_GB", 8)
 	gpuEnabled := getEnvBool("GPU_ENABLED", false)
+	maxSlots := getEnvInt("MAX_SLOTS", pool.SlotsFor(cpuCores, memoryGB))
+	pidsLimit := getEnvInt("PIDS_LIMIT", 0)
+	drainTimeout := getEnvDuration("DRAIN_TIMEOUT", 10*time.Minute)
 
 	// Initialize components
 	coordinatorClient := client.NewCoordinatorClient(coordinatorURL)
 
-	dockerExecutor, err := executor.NewDockerExecutor()
+	dockerExecutor, err := executor.NewDockerExecutor(int64(pidsLimit))
 	if err != nil {
 		log.Fatalf("Failed to initialize Docker executor: %v", err)
 	}
@@ -58,13 +108,22 @@ func main() {
 		id:         workerID,
 		name:       workerName,
 		region:     region,
+		owner:      owner,
+		host:       host,
+		price:      price,
+		labels:     labels,
+		taints:     taints,
 		cpuCores:   cpuCores,
 		memoryGB:   memoryGB,
 		gpuEnabled: gpuEnabled,
 		client:     coordinatorClient,
 		executor:   dockerExecutor,
 		monitor:    systemMonitor,
+		slots:      pool.NewResourcePool(maxSlots, cpuCores, memoryGB),
 		stopChan:   make(chan struct{}),
+		pollStop:   make(chan struct{}),
+		pollDone:   make(chan struct{}),
+		running:    make(map[string]*runningExecution),
 	}
 
 	// Register with coordinator
@@ -83,12 +142,47 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Info("Shutting down worker...")
+	log.Info("Shutting down worker, draining...")
+	worker.drain(quit, drainTimeout)
 	close(worker.stopChan)
-	time.Sleep(2 * time.Second)
 	log.Info("Worker stopped")
 }
 
+// drain stops taking work and tells the coordinator, which moves executions
+// not claimed yet to other nodes, then waits for the running ones to finish
+// and report. Heartbeats carry on meanwhile. After timeout or a second signal
+// whatever is still running is killed and left to expire its lease.
+func (w *Worker) drain(quit <-chan os.Signal, timeout time.Duration) {
+	close(w.pollStop)
+	<-w.pollDone
+
+	if err := w.client.DrainNode(w.id); err != nil {
+		log.Warnf("Failed to announce drain to coordinator: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.inflight.Wait()
+		close(done)
+	}()
+
+	if active := len(w.activeExecutionIDs()); active > 0 {
+		log.Infof("Waiting up to %s for %d execution(s) to finish", timeout, active)
+	}
+
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+		log.Warn("Drain timed out")
+	case <-quit:
+		log.Warn("Received second signal, stopping now")
+	}
+	for _, executionID := range w.activeExecutionIDs() {
+		w.revokeExecution(executionID, "worker shutting down")
+	}
+}
+
 func (w *Worker) register() error {
 	log.Infof("Registering worker %s with coordinator...", w.id)
 
@@ -96,16 +190,22 @@ func (w *Worker) register() error {
 		ID:         w.id,
 		Name:       w.name,
 		Region:     w.region,
+		Owner:      w.owner,
+		Host:       w.host,
+		Price:      w.price,
+		Labels:     w.labels,
+		Taints:     w.taints,
 		CPUCores:   w.cpuCores,
 		MemoryGB:   w.memoryGB,
 		GPUEnabled: w.gpuEnabled,
+		MaxSlots:   w.slots.Usage().TotalSlots,
 	}
 
 	if err := w.client.RegisterNode(req); err != nil {
 		return err
 	}
 
-	log.Info("Worker registered successfully")
+	log.Infof("Worker registered successfully with %d slots", req.MaxSlots)
 	return nil
 }
 
@@ -124,20 +224,77 @@ func (w *Worker) heartbeatLoop() {
 }
 
 func (w *Worker) sendHeartbeat() {
+	usage := w.slots.Usage()
 	heartbeat := &client.Heartbeat{
-		CPUUsage:    w.monitor.GetCPUUsage(),
-		MemoryUsage: w.monitor.GetMemoryUsage(),
-		ActiveJobs:  w.activeJobs,
+		CPUUsage:         w.monitor.GetCPUUsage(),
+		MemoryUsage:      w.monitor.GetMemoryUsage(),
+		ActiveJobs:       usage.UsedSlots,
+		TotalSlots:       usage.TotalSlots,
+		UsedCPU:          usage.UsedCPU,
+		UsedMemory:       usage.UsedMemory,
+		ActiveExecutions: w.activeExecutionIDs(),
 	}
 
-	if err := w.client.SendHeartbeat(w.id, heartbeat); err != nil {
+	resp, err := w.client.SendHeartbeat(w.id, heartbeat)
+	if err != nil {
 		log.Warnf("Failed to send heartbeat: %v", err)
-	} else {
-		log.Debug("Heartbeat sent")
+		return
+	}
+	log.Debug("Heartbeat sent")
+
+	for _, executionID := range resp.CancelledExecutions {
+		w.revokeExecution(executionID, "cancelled by coordinator")
+	}
+}
+
+func (w *Worker) trackExecution(executionID string, cancel context.CancelFunc) *runningExecution {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	run := &runningExecution{cancel: cancel, revoked: make(chan struct{})}
+	w.running[executionID] = run
+	return run
+}
+
+func (w *Worker) untrackExecution(executionID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.running, executionID)
+}
+
+func (w *Worker) isRunning(executionID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.running[executionID]
+	return ok
+}
+
+func (w *Worker) activeExecutionIDs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ids := make([]string, 0, len(w.running))
+	for id := range w.running {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// revokeExecution kills a running execution's container and drops its result
+func (w *Worker) revokeExecution(executionID, reason string) {
+	w.mu.Lock()
+	run, ok := w.running[executionID]
+	w.mu.Unlock()
+
+	if ok {
+		log.Warnf("Stopping execution %s: %s", executionID, reason)
+		run.revoke()
 	}
 }
 
 func (w *Worker) jobPollingLoop() {
+	defer close(w.pollDone)
+
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
@@ -145,7 +302,7 @@ func (w *Worker) jobPollingLoop() {
 		select {
 		case <-ticker.C:
 			w.checkForJobs()
-		case <-w.stopChan:
+		case <-w.pollStop:
 			return
 		}
 	}
@@ -165,37 +322,84 @@ func (w *Worker) checkForJobs() {
 
 	log.Infof("Received %d pending job(s)", len(jobs))
 
-	// Execute each job
+	// Run each job in the background as long as there is room for it. Jobs
+	// that don't fit stay scheduled and are offered again on the next poll.
 	for _, pendingJob := range jobs {
-		w.executeJob(pendingJob)
+		if w.isRunning(pendingJob.ExecutionID) {
+			continue
+		}
+
+		job := pendingJob.Job
+		if !w.slots.TryAcquire(job.RequiredCPU, job.RequiredMemory) {
+			log.Debugf("No capacity for execution %s, deferring", pendingJob.ExecutionID)
+			continue
+		}
+
+		w.inflight.Add(1)
+		go func(pendingJob client.PendingJob) {
+			defer w.inflight.Done()
+			defer w.slots.Release(pendingJob.Job.RequiredCPU, pendingJob.Job.RequiredMemory)
+			w.executeJob(pendingJob)
+		}(pendingJob)
 	}
 }
 
 func (w *Worker) executeJob(pendingJob client.PendingJob) {
-	job := pendingJob.Job
-	executionID := pendingJob.ExecutionID
+	// Claim the execution first so no other poll (or node) runs it concurrently
+	lease, err := w.client.ClaimExecution(pendingJob.ExecutionID, w.id)
+	if err != nil {
+		if err != client.ErrLeaseLost {
+			log.Warnf("Failed to claim execution %s: %v", pendingJob.ExecutionID, err)
+		}
+		return
+	}
+
+	job := lease.Job
+	executionID := lease.ExecutionID
 
 	log.Infof("Executing job %s (%s)", job.ID, job.Name)
 
-	w.activeJobs++
-	defer func() { w.activeJobs-- }()
+	// Keep the lease alive while the container runs; losing the lease or a
+	// cancellation from the coordinator revokes the run
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	run := w.trackExecution(executionID, cancel)
+	defer w.untrackExecution(executionID)
+
+	go w.renewLease(ctx, executionID, leaseInterval(lease.LeaseSeconds))
 
 	// Execute the job
-	ctx := context.Background()
-	result := w.executor.ExecuteJob(
-		ctx,
-		job.DockerImage,
-		job.Command,
-		job.Environment,
-		job.InputData,
-	)
+	result := w.executor.ExecuteJob(ctx, executor.JobSpec{
+		DockerImage: job.DockerImage,
+		Command:     job.Command,
+		Environment: job.Environment,
+		InputData:   job.InputData,
+		CPUCores:    job.RequiredCPU,
+		MemoryGB:    job.RequiredMemory,
+		DiskQuotaGB: job.DiskQuotaGB,
+		Timeout:     time.Duration(job.TimeoutSeconds) * time.Second,
+		OutputFile:  job.OutputFile,
+		Normalize:   job.Normalize,
+		OnStart: func() {
+			if err := w.client.ReportStarted(executionID, w.id); err != nil {
+				log.Warnf("Failed to report execution %s started: %v", executionID, err)
+			}
+		},
+	})
+
+	if run.isRevoked() {
+		log.Warnf("Execution %s was revoked, discarding result", executionID)
+		return
+	}
 
 	// Prepare result submission
 	submission := &client.JobResultSubmission{
 		ExecutionID: executionID,
 		JobID:       job.ID,
 		NodeID:      w.id,
-		Logs:        result.Logs,
+		Stdout:      result.Stdout,
+		Stderr:      result.Stderr,
 	}
 
 	if result.Success {
@@ -204,6 +408,7 @@ func (w *Worker) executeJob(pendingJob client.PendingJob) {
 		log.Infof("Job %s completed successfully. Hash: %s", job.ID, result.OutputHash[:16])
 	} else {
 		submission.ErrorMessage = result.Error
+		submission.ErrorClass = result.ErrorClass
 		log.Errorf("Job %s failed: %s", job.ID, result.Error)
 	}
 
@@ -215,6 +420,69 @@ func (w *Worker) executeJob(pendingJob client.PendingJob) {
 	}
 }
 
+// renewLease renews the execution lease until ctx is done. If the coordinator
+// reports the lease lost (reassigned or cancelled), the execution is revoked.
+func (w *Worker) renewLease(ctx context.Context, executionID string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := w.client.RenewLease(executionID, w.id)
+			if err == client.ErrLeaseLost {
+				w.revokeExecution(executionID, "lease lost")
+				return
+			}
+			if err != nil {
+				log.Warnf("Failed to renew lease on execution %s: %v", executionID, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// leaseInterval renews three times per lease so a single failed request doesn't lose it
+func leaseInterval(leaseSeconds int) time.Duration {
+	if leaseSeconds <= 0 {
+		leaseSeconds = 60
+	}
+	return time.Duration(leaseSeconds) * time.Second / 3
+}
+
+// parseLabels reads comma-separated key=value labels, e.g. "arch=arm64,disk=ssd".
+// A bare key is a label with an empty value.
+func parseLabels(value string) map[string]string {
+	labels := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		key, val, _ := strings.Cut(item, "=")
+		labels[key] = val
+	}
+	return labels
+}
+
+// parseTaints reads comma-separated key[=value]:effect taints, e.g.
+// "dedicated=ml:no_schedule,flaky:prefer_no_schedule"
+func parseTaints(value string) ([]client.Taint, error) {
+	var taints []client.Taint
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		keyValue, effect, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("taint %q has no effect", item)
+		}
+		key, val, _ := strings.Cut(keyValue, "=")
+		taints = append(taints, client.Taint{Key: key, Value: val, Effect: effect})
+	}
+	return taints, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -231,6 +499,24 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		return value == "true" || value == "1"
@@ -3,10 +3,13 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/HildaPosada/distributeai/worker/internal/normalize"
 )
 
 type CoordinatorClient struct {
@@ -25,20 +28,44 @@ func NewCoordinatorClient(baseURL string) *CoordinatorClient {
 
 // NodeRegisterRequest matches coordinator model
 type NodeRegisterRequest struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	Region     string `json:"region"`
-	CPUCores   int    `json:"cpu_cores"`
-	MemoryGB   int    `json:"memory_gb"`
-	GPUEnabled bool   `json:"gpu_enabled"`
-	GPUModel   string `json:"gpu_model"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Region     string            `json:"region"`
+	Owner      string            `json:"owner"`
+	Host       string            `json:"host"`
+	Price      float64           `json:"price,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Taints     []Taint           `json:"taints,omitempty"`
+	CPUCores   int               `json:"cpu_cores"`
+	MemoryGB   int               `json:"memory_gb"`
+	GPUEnabled bool              `json:"gpu_enabled"`
+	GPUModel   string            `json:"gpu_model"`
+	MaxSlots   int               `json:"max_slots"`
+}
+
+// Taint matches coordinator model
+type Taint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
 }
 
 // Heartbeat matches coordinator model
 type Heartbeat struct {
 	CPUUsage    float64 `json:"cpu_usage"`
 	MemoryUsage float64 `json:"memory_usage"`
-	ActiveJobs  int     `json:"active_jobs"`
+	ActiveJobs  int     `json:"active_jobs"` // Slots in use
+	TotalSlots  int     `json:"total_slots"`
+	UsedCPU     int     `json:"used_cpu"`
+	UsedMemory  int     `json:"used_memory"`
+	// ActiveExecutions lets the coordinator report which ones to stop
+	ActiveExecutions []string `json:"active_executions"`
+}
+
+// HeartbeatResponse is the coordinator's reply to a heartbeat
+type HeartbeatResponse struct {
+	Status              string   `json:"status"`
+	CancelledExecutions []string `json:"cancelled_executions"`
 }
 
 // Job matches coordinator model (simplified)
@@ -51,6 +78,10 @@ type Job struct {
 	InputData      string            `json:"input_data"`
 	RequiredCPU    int               `json:"required_cpu"`
 	RequiredMemory int               `json:"required_memory"`
+	DiskQuotaGB    int               `json:"disk_quota_gb"`
+	TimeoutSeconds int               `json:"timeout_seconds"`
+	OutputFile     string            `json:"output_file"`
+	Normalize      []normalize.Rule  `json:"normalize"`
 }
 
 // PendingJob wraps job with execution ID
@@ -59,6 +90,21 @@ type PendingJob struct {
 	Job         Job    `json:"job"`
 }
 
+// Lease is the coordinator's grant of an execution to this node
+type Lease struct {
+	ExecutionID    string    `json:"execution_id"`
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+	LeaseSeconds   int       `json:"lease_seconds"`
+	Job            Job       `json:"job"`
+}
+
+// ErrLeaseLost means the execution is no longer assigned to this node
+var ErrLeaseLost = errors.New("execution lease lost")
+
+type leaseRequest struct {
+	NodeID string `json:"node_id"`
+}
+
 // JobResultSubmission matches coordinator model
 type JobResultSubmission struct {
 	ExecutionID  string `json:"execution_id"`
@@ -67,7 +113,9 @@ type JobResultSubmission struct {
 	Result       string `json:"result"`
 	ResultHash   string `json:"result_hash"`
 	ErrorMessage string `json:"error_message"`
-	Logs         string `json:"logs"`
+	ErrorClass   string `json:"error_class,omitempty"`
+	Stdout       string `json:"stdout"`
+	Stderr       string `json:"stderr"`
 }
 
 // RegisterNode registers this worker with the coordinator
@@ -96,10 +144,10 @@ func (c *CoordinatorClient) RegisterNode(req *NodeRegisterRequest) error {
 }
 
 // SendHeartbeat sends a heartbeat to the coordinator
-func (c *CoordinatorClient) SendHeartbeat(nodeID string, heartbeat *Heartbeat) error {
+func (c *CoordinatorClient) SendHeartbeat(nodeID string, heartbeat *Heartbeat) (*HeartbeatResponse, error) {
 	data, err := json.Marshal(heartbeat)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	resp, err := c.httpClient.Post(
@@ -107,13 +155,39 @@ func (c *CoordinatorClient) SendHeartbeat(nodeID string, heartbeat *Heartbeat) e
 		"application/json",
 		bytes.NewBuffer(data),
 	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("heartbeat failed: %s", resp.Status)
+	}
+
+	var result HeartbeatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// DrainNode tells the coordinator this worker is shutting down: it gets no
+// new executions, and the ones it hasn't claimed yet go to other nodes
+func (c *CoordinatorClient) DrainNode(nodeID string) error {
+	resp, err := c.httpClient.Post(
+		fmt.Sprintf("%s/api/v1/nodes/%s/drain", c.baseURL, nodeID),
+		"application/json",
+		nil,
+	)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("heartbeat failed: %s", resp.Status)
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("drain failed: %s - %s", resp.Status, string(body))
 	}
 
 	return nil
@@ -144,6 +218,72 @@ func (c *CoordinatorClient) GetPendingJobs(nodeID string) ([]PendingJob, error)
 	return result.PendingJobs, nil
 }
 
+// ClaimExecution atomically claims a scheduled execution for this node.
+// Returns ErrLeaseLost if the execution was already claimed or reassigned.
+func (c *CoordinatorClient) ClaimExecution(executionID, nodeID string) (*Lease, error) {
+	resp, err := c.postLease(executionID, "claim", nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var lease Lease
+	if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+		return nil, err
+	}
+
+	return &lease, nil
+}
+
+// RenewLease extends this node's lease on a running execution
+func (c *CoordinatorClient) RenewLease(executionID, nodeID string) error {
+	resp, err := c.postLease(executionID, "renew", nodeID)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ReportStarted tells the coordinator the execution's container has started,
+// so it enforces the job timeout from now rather than from the claim
+func (c *CoordinatorClient) ReportStarted(executionID, nodeID string) error {
+	resp, err := c.postLease(executionID, "start", nodeID)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *CoordinatorClient) postLease(executionID, action, nodeID string) (*http.Response, error) {
+	data, err := json.Marshal(&leaseRequest{NodeID: nodeID})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Post(
+		fmt.Sprintf("%s/api/v1/worker/executions/%s/%s", c.baseURL, executionID, action),
+		"application/json",
+		bytes.NewBuffer(data),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusConflict:
+		resp.Body.Close()
+		return nil, ErrLeaseLost
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("lease %s failed: %s - %s", action, resp.Status, string(body))
+	}
+}
+
 // SubmitJobResult submits the result of a completed job
 func (c *CoordinatorClient) SubmitJobResult(result *JobResultSubmission) error {
 	data, err := json.Marshal(result)
@@ -1,54 +1,122 @@
 package executor
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"io"
-	"strings"
 	"time"
 
+	"github.com/HildaPosada/distributeai/worker/internal/normalize"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	log "github.com/sirupsen/logrus"
 )
 
+// Error classes reported to the coordinator alongside the error message
+const (
+	// ErrorClassOOMKilled marks executions the kernel killed for exceeding their memory limit
+	ErrorClassOOMKilled = "oom_killed"
+	// ErrorClassTimedOut marks executions stopped for running past the job's timeout
+	ErrorClassTimedOut = "timed_out"
+	// ErrorClassInternal marks executions the worker lost track of, e.g. when
+	// Docker stopped reporting on the container
+	ErrorClassInternal = "internal_error"
+)
+
+// Limits applied when a job doesn't request resources
+const (
+	defaultMemoryBytes = 512 * 1024 * 1024 // 512MB
+	defaultPidsLimit   = 256
+	defaultTimeout     = 5 * time.Minute
+)
+
+// maxOutputFileBytes caps the size of a declared output file
+const maxOutputFileBytes = 64 * 1024 * 1024
+
 type DockerExecutor struct {
-	client *client.Client
+	client    *client.Client
+	pidsLimit int64
+}
+
+// JobSpec describes a container run and the resources the job requested
+type JobSpec struct {
+	DockerImage string
+	Command     []string
+	Environment map[string]string
+	InputData   string
+	CPUCores    int
+	MemoryGB    int
+	DiskQuotaGB int
+	Timeout     time.Duration // Zero uses the default
+	// OutputFile is a path inside the container whose contents are the job's
+	// result; when empty, the result is whatever the job writes to stdout
+	OutputFile string
+	// Normalize is applied to the output before hashing
+	Normalize []normalize.Rule
+	// OnStart, if set, is called once the container has started, after the
+	// image pull, when the timeout starts counting
+	OnStart func()
 }
 
 type ExecutionResult struct {
 	Output     string
 	OutputHash string
-	Logs       string
+	Stdout     string
+	Stderr     string
 	Error      string
+	ErrorClass string
 	Success    bool
 }
 
-func NewDockerExecutor() (*DockerExecutor, error) {
+// NewDockerExecutor connects to the local Docker daemon. pidsLimit caps the
+// number of processes in each job container; zero uses the default.
+func NewDockerExecutor(pidsLimit int64) (*DockerExecutor, error) {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create docker client: %w", err)
 	}
 
-	return &DockerExecutor{client: cli}, nil
+	if pidsLimit <= 0 {
+		pidsLimit = defaultPidsLimit
+	}
+
+	return &DockerExecutor{client: cli, pidsLimit: pidsLimit}, nil
+}
+
+// resources converts a job's resource request into container cgroup limits.
+// Swap is capped at the memory limit so a job can't grow past its request.
+func (e *DockerExecutor) resources(spec JobSpec) container.Resources {
+	cpus := int64(spec.CPUCores)
+	if cpus <= 0 {
+		cpus = 1
+	}
+
+	memory := int64(defaultMemoryBytes)
+	if spec.MemoryGB > 0 {
+		memory = int64(spec.MemoryGB) * 1024 * 1024 * 1024
+	}
+
+	pidsLimit := e.pidsLimit
+
+	return container.Resources{
+		NanoCPUs:   cpus * 1000000000,
+		Memory:     memory,
+		MemorySwap: memory,
+		PidsLimit:  &pidsLimit,
+	}
 }
 
 // ExecuteJob runs a job in a Docker container
-func (e *DockerExecutor) ExecuteJob(
-	ctx context.Context,
-	dockerImage string,
-	command []string,
-	environment map[string]string,
-	inputData string,
-) *ExecutionResult {
+func (e *DockerExecutor) ExecuteJob(ctx context.Context, spec JobSpec) *ExecutionResult {
 	result := &ExecutionResult{}
 
 	// Pull the image
-	log.Infof("Pulling Docker image: %s", dockerImage)
-	reader, err := e.client.ImagePull(ctx, dockerImage, types.ImagePullOptions{})
+	log.Infof("Pulling Docker image: %s", spec.DockerImage)
+	reader, err := e.client.ImagePull(ctx, spec.DockerImage, types.ImagePullOptions{})
 	if err != nil {
 		result.Error = fmt.Sprintf("Failed to pull image: %v", err)
 		return result
@@ -58,26 +126,28 @@ func (e *DockerExecutor) ExecuteJob(
 
 	// Prepare environment variables
 	var envVars []string
-	for key, value := range environment {
+	for key, value := range spec.Environment {
 		envVars = append(envVars, fmt.Sprintf("%s=%s", key, value))
 	}
 
 	// Create container config
 	containerConfig := &container.Config{
-		Image:        dockerImage,
-		Cmd:          command,
+		Image:        spec.DockerImage,
+		Cmd:          spec.Command,
 		Env:          envVars,
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          false,
 	}
 
+	// The container is removed explicitly once its state has been inspected,
+	// otherwise an OOM kill can't be told apart from any other exit
 	hostConfig := &container.HostConfig{
-		AutoRemove: true,
-		Resources: container.Resources{
-			Memory:   512 * 1024 * 1024, // 512MB limit
-			NanoCPUs: 1000000000,        // 1 CPU
-		},
+		Resources: e.resources(spec),
+	}
+	if spec.DiskQuotaGB > 0 {
+		// Requires a storage driver with quota support (e.g. overlay2 on xfs with pquota)
+		hostConfig.StorageOpt = map[string]string{"size": fmt.Sprintf("%dG", spec.DiskQuotaGB)}
 	}
 
 	// Create container
@@ -88,6 +158,7 @@ func (e *DockerExecutor) ExecuteJob(
 	}
 
 	containerID := resp.ID
+	defer e.removeContainer(containerID)
 
 	// Start container
 	if err := e.client.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
@@ -96,74 +167,172 @@ func (e *DockerExecutor) ExecuteJob(
 	}
 
 	log.Infof("Container started: %s", containerID[:12])
+	if spec.OnStart != nil {
+		spec.OnStart()
+	}
+
+	timeout := spec.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
 	// Wait for container to finish (with timeout)
 	statusCh, errCh := e.client.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
 
 	select {
 	case err := <-errCh:
+		if ctx.Err() != nil {
+			e.killContainer(containerID)
+			result.Error = fmt.Sprintf("Execution aborted: %v", ctx.Err())
+			return result
+		}
+		// The wait ended without the container's exit status, so whether the
+		// job ran to completion is unknown
+		e.killContainer(containerID)
+		result.ErrorClass = ErrorClassInternal
 		if err != nil {
 			result.Error = fmt.Sprintf("Container wait error: %v", err)
-			return result
+		} else {
+			result.Error = "Container wait ended without an exit status"
 		}
+		return result
+	case <-ctx.Done():
+		e.killContainer(containerID)
+		result.Error = fmt.Sprintf("Execution aborted: %v", ctx.Err())
+		return result
 	case status := <-statusCh:
 		log.Infof("Container finished with status: %d", status.StatusCode)
 
-		// Get container logs
-		out, err := e.client.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
-			ShowStdout: true,
-			ShowStderr: true,
-		})
+		stdout, stderr, err := e.collectOutput(ctx, containerID)
 		if err != nil {
 			result.Error = fmt.Sprintf("Failed to get logs: %v", err)
 			return result
 		}
-		defer out.Close()
+		result.Stdout = stdout
+		result.Stderr = stderr
 
-		// Read logs
-		logBytes, err := io.ReadAll(out)
-		if err != nil {
-			result.Error = fmt.Sprintf("Failed to read logs: %v", err)
-			return result
+		// Only stdout (or the declared output file) is the job's result; stderr
+		// carries diagnostics that may legitimately differ between nodes
+		result.Output = stdout
+		if spec.OutputFile != "" && status.StatusCode == 0 {
+			output, err := e.readOutputFile(ctx, containerID, spec.OutputFile)
+			if err != nil {
+				result.Error = fmt.Sprintf("Failed to read output file %s: %v", spec.OutputFile, err)
+				return result
+			}
+			result.Output = output
 		}
 
-		result.Logs = string(logBytes)
-		result.Output = cleanDockerLogs(string(logBytes))
+		// Strip the job's declared non-determinism so honest nodes agree
+		if status.StatusCode == 0 && len(spec.Normalize) > 0 {
+			normalized, err := normalize.Apply(result.Output, spec.Normalize)
+			if err != nil {
+				result.Error = fmt.Sprintf("Failed to normalize output: %v", err)
+				return result
+			}
+			result.Output = normalized
+		}
 
 		// Generate hash of output for verification
-		hash := sha256.Sum256([]byte(result.Output))
-		result.OutputHash = hex.EncodeToString(hash[:])
+		result.OutputHash = normalize.Hash(result.Output)
 
 		if status.StatusCode == 0 {
 			result.Success = true
+		} else if e.wasOOMKilled(containerID) {
+			result.Error = fmt.Sprintf("Container exceeded its memory limit (exit code %d)", status.StatusCode)
+			result.ErrorClass = ErrorClassOOMKilled
 		} else {
 			result.Error = fmt.Sprintf("Container exited with code %d", status.StatusCode)
 		}
-	case <-time.After(5 * time.Minute):
+	case <-timer.C:
 		// Timeout - kill container
-		e.client.ContainerKill(ctx, containerID, "SIGKILL")
-		result.Error = "Execution timeout (5 minutes)"
+		e.killContainer(containerID)
+		result.Error = fmt.Sprintf("Execution timed out after %s", timeout)
+		result.ErrorClass = ErrorClassTimedOut
 		return result
 	}
 
 	return result
 }
 
-// cleanDockerLogs removes Docker's stream headers from logs
-func cleanDockerLogs(logs string) string {
-	// Docker adds 8-byte headers to each line, remove them
-	lines := strings.Split(logs, "\n")
-	var cleaned []string
-
-	for _, line := range lines {
-		if len(line) > 8 {
-			cleaned = append(cleaned, line[8:])
-		} else if len(line) > 0 {
-			cleaned = append(cleaned, line)
-		}
+// collectOutput reads the container's log stream and splits it back into
+// stdout and stderr
+func (e *DockerExecutor) collectOutput(ctx context.Context, containerID string) (string, string, error) {
+	out, err := e.client.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	defer out.Close()
+
+	// Without a TTY Docker multiplexes both streams into frames with an 8-byte
+	// header each; frames don't line up with lines, so they must be decoded
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, out); err != nil {
+		return "", "", fmt.Errorf("failed to demultiplex logs: %w", err)
+	}
+
+	return stdout.String(), stderr.String(), nil
+}
+
+// readOutputFile copies a single file out of the stopped container
+func (e *DockerExecutor) readOutputFile(ctx context.Context, containerID, path string) (string, error) {
+	reader, stat, err := e.client.CopyFromContainer(ctx, containerID, path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	if !stat.Mode.IsRegular() {
+		return "", fmt.Errorf("not a regular file")
+	}
+	if stat.Size > maxOutputFileBytes {
+		return "", fmt.Errorf("file is %d bytes, limit is %d", stat.Size, maxOutputFileBytes)
+	}
+
+	// The file arrives as a single-entry tar archive
+	archive := tar.NewReader(reader)
+	if _, err := archive.Next(); err != nil {
+		return "", fmt.Errorf("failed to read archive: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(archive, maxOutputFileBytes))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// killContainer stops a container even when the execution context is already done
+func (e *DockerExecutor) killContainer(containerID string) {
+	if err := e.client.ContainerKill(context.Background(), containerID, "SIGKILL"); err != nil {
+		log.Warnf("Failed to kill container %s: %v", containerID[:12], err)
 	}
+}
 
-	return strings.Join(cleaned, "\n")
+// wasOOMKilled reports whether the kernel OOM killer stopped the container
+func (e *DockerExecutor) wasOOMKilled(containerID string) bool {
+	info, err := e.client.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		log.Warnf("Failed to inspect container %s: %v", containerID[:12], err)
+		return false
+	}
+	return info.State != nil && info.State.OOMKilled
+}
+
+// removeContainer deletes a finished or killed container and its writable layer
+func (e *DockerExecutor) removeContainer(containerID string) {
+	err := e.client.ContainerRemove(context.Background(), containerID, types.ContainerRemoveOptions{
+		Force:         true,
+		RemoveVolumes: true,
+	})
+	if err != nil {
+		log.Warnf("Failed to remove container %s: %v", containerID[:12], err)
+	}
 }
 
 func (e *DockerExecutor) Close() error {
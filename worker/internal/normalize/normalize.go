@@ -0,0 +1,134 @@
+package normalize
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule types, matching the coordinator's NormalizationRuleType values
+const (
+	StripRegex     = "strip_regex"
+	IgnoreLines    = "ignore_lines"
+	TrimWhitespace = "trim_whitespace"
+	SortLines      = "sort_lines"
+	CanonicalJSON  = "canonical_json"
+)
+
+// Rule is one step of a job's output normalization
+type Rule struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// Apply runs the rules over output in order. Results are compared as reported,
+// so this is the only place a job's rules run; spot-check answers normalized
+// by the coordinator only match if its copy gives the same output.
+func Apply(output string, rules []Rule) (string, error) {
+	for _, rule := range rules {
+		var err error
+		switch rule.Type {
+		case StripRegex:
+			var re *regexp.Regexp
+			if re, err = regexp.Compile(rule.Pattern); err == nil {
+				output = re.ReplaceAllString(output, "")
+			}
+		case IgnoreLines:
+			var re *regexp.Regexp
+			if re, err = regexp.Compile(rule.Pattern); err == nil {
+				output = ignoreLines(output, re)
+			}
+		case TrimWhitespace:
+			output = trimWhitespace(output)
+		case SortLines:
+			output = sortLines(output)
+		case CanonicalJSON:
+			output, err = canonicalJSON(output)
+		default:
+			err = fmt.Errorf("unknown type %q", rule.Type)
+		}
+		if err != nil {
+			return "", fmt.Errorf("normalize %s: %w", rule.Type, err)
+		}
+	}
+	return output, nil
+}
+
+// Hash returns the hex SHA256 of a (normalized) result
+func Hash(result string) string {
+	sum := sha256.Sum256([]byte(result))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitLines splits output into lines, ignoring a single trailing newline
+func splitLines(output string) []string {
+	if output == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func ignoreLines(output string, re *regexp.Regexp) string {
+	var kept []string
+	for _, line := range splitLines(output) {
+		if !re.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	return joinLines(kept)
+}
+
+func trimWhitespace(output string) string {
+	lines := splitLines(output)
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func sortLines(output string) string {
+	lines := splitLines(output)
+	sort.Strings(lines)
+	return joinLines(lines)
+}
+
+// canonicalJSON re-encodes each JSON value in output (a single document or
+// JSON lines) with sorted object keys and no insignificant whitespace
+func canonicalJSON(output string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(output))
+	decoder.UseNumber()
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		// Encode writes one value per line
+		if err := encoder.Encode(value); err != nil {
+			return "", err
+		}
+	}
+
+	return buf.String(), nil
+}
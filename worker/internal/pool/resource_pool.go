@@ -0,0 +1,99 @@
+package pool
+
+import "sync"
+
+// ResourcePool bounds concurrent executions by slot count and by the CPU cores
+// and memory the running jobs requested
+type ResourcePool struct {
+	mu         sync.Mutex
+	slots      int
+	cpuCores   int
+	memoryGB   int
+	usedSlots  int
+	usedCPU    int
+	usedMemory int
+}
+
+// Usage is a snapshot of what the pool has handed out
+type Usage struct {
+	TotalSlots int
+	UsedSlots  int
+	UsedCPU    int
+	UsedMemory int
+}
+
+func NewResourcePool(slots, cpuCores, memoryGB int) *ResourcePool {
+	return &ResourcePool{
+		slots:    slots,
+		cpuCores: cpuCores,
+		memoryGB: memoryGB,
+	}
+}
+
+// SlotsFor derives how many executions a machine can run side by side,
+// assuming the smallest job takes one core and one GB
+func SlotsFor(cpuCores, memoryGB int) int {
+	slots := cpuCores
+	if memoryGB < slots {
+		slots = memoryGB
+	}
+	if slots < 1 {
+		slots = 1
+	}
+	return slots
+}
+
+// TryAcquire reserves a slot plus the requested resources, or returns false
+// without blocking if they aren't free
+func (p *ResourcePool) TryAcquire(cpu, memory int) bool {
+	cpu, memory = normalize(cpu, memory)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.usedSlots >= p.slots ||
+		p.usedCPU+cpu > p.cpuCores ||
+		p.usedMemory+memory > p.memoryGB {
+		return false
+	}
+
+	p.usedSlots++
+	p.usedCPU += cpu
+	p.usedMemory += memory
+	return true
+}
+
+// Release returns resources reserved by TryAcquire
+func (p *ResourcePool) Release(cpu, memory int) {
+	cpu, memory = normalize(cpu, memory)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.usedSlots--
+	p.usedCPU -= cpu
+	p.usedMemory -= memory
+}
+
+func (p *ResourcePool) Usage() Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Usage{
+		TotalSlots: p.slots,
+		UsedSlots:  p.usedSlots,
+		UsedCPU:    p.usedCPU,
+		UsedMemory: p.usedMemory,
+	}
+}
+
+// normalize applies the coordinator's minimum of one core and one GB per job
+func normalize(cpu, memory int) (int, int) {
+	if cpu < 1 {
+		cpu = 1
+	}
+	if memory < 1 {
+		memory = 1
+	}
+	return cpu, memory
+}
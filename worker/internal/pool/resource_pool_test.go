@@ -0,0 +1,167 @@
+package pool
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestTryAcquire(t *testing.T) {
+	type request struct {
+		cpu, memory int
+		ok          bool
+	}
+	tests := []struct {
+		name               string
+		slots, cpu, memory int
+		requests           []request
+		want               Usage
+	}{
+		{"slots run out", 2, 8, 16,
+			[]request{{1, 1, true}, {1, 1, true}, {1, 1, false}},
+			Usage{TotalSlots: 2, UsedSlots: 2, UsedCPU: 2, UsedMemory: 2}},
+		{"cpu runs out", 4, 4, 16,
+			[]request{{3, 1, true}, {2, 1, false}, {1, 1, true}},
+			Usage{TotalSlots: 4, UsedSlots: 2, UsedCPU: 4, UsedMemory: 2}},
+		{"memory runs out", 4, 8, 8,
+			[]request{{1, 6, true}, {1, 3, false}, {1, 2, true}},
+			Usage{TotalSlots: 4, UsedSlots: 2, UsedCPU: 2, UsedMemory: 8}},
+		{"larger than the machine", 4, 4, 8,
+			[]request{{5, 1, false}, {1, 9, false}},
+			Usage{TotalSlots: 4}},
+		{"zero requests count as one core and one GB", 4, 2, 2,
+			[]request{{0, 0, true}, {-1, 0, true}, {0, 0, false}},
+			Usage{TotalSlots: 4, UsedSlots: 2, UsedCPU: 2, UsedMemory: 2}},
+	}
+
+	for _, tt := range tests {
+		p := NewResourcePool(tt.slots, tt.cpu, tt.memory)
+		for i, req := range tt.requests {
+			if ok := p.TryAcquire(req.cpu, req.memory); ok != req.ok {
+				t.Errorf("%s: request %d (%d CPU, %d GB) acquired = %t, want %t",
+					tt.name, i, req.cpu, req.memory, ok, req.ok)
+			}
+		}
+		if got := p.Usage(); got != tt.want {
+			t.Errorf("%s: usage %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReleaseFreesResources(t *testing.T) {
+	p := NewResourcePool(2, 4, 8)
+	if !p.TryAcquire(3, 6) || !p.TryAcquire(1, 2) {
+		t.Fatal("couldn't fill the pool")
+	}
+	if p.TryAcquire(1, 1) {
+		t.Fatal("acquired from a full pool")
+	}
+
+	p.Release(3, 6)
+	if got, want := p.Usage(), (Usage{TotalSlots: 2, UsedSlots: 1, UsedCPU: 1, UsedMemory: 2}); got != want {
+		t.Errorf("usage after release %+v, want %+v", got, want)
+	}
+	if !p.TryAcquire(3, 6) {
+		t.Error("couldn't reacquire released resources")
+	}
+
+	// Releases are normalized like acquisitions
+	p = NewResourcePool(1, 1, 1)
+	if !p.TryAcquire(0, 0) {
+		t.Fatal("couldn't acquire a minimal job")
+	}
+	p.Release(0, 0)
+	if got, want := p.Usage(), (Usage{TotalSlots: 1}); got != want {
+		t.Errorf("usage after release %+v, want %+v", got, want)
+	}
+}
+
+func TestSlotsFor(t *testing.T) {
+	tests := []struct {
+		cpu, memory, want int
+	}{
+		{8, 16, 8},
+		{8, 4, 4},
+		{0, 16, 1},
+		{4, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := SlotsFor(tt.cpu, tt.memory); got != tt.want {
+			t.Errorf("SlotsFor(%d, %d) = %d, want %d", tt.cpu, tt.memory, got, tt.want)
+		}
+	}
+}
+
+func TestConcurrentAcquireNeverOvercommits(t *testing.T) {
+	const (
+		slots   = 4
+		workers = 32
+		rounds  = 200
+	)
+	p := NewResourcePool(slots, 6, 6)
+
+	var mu sync.Mutex
+	held, peak := 0, 0
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(cpu int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if !p.TryAcquire(cpu, 1) {
+					continue
+				}
+				mu.Lock()
+				held++
+				if held > peak {
+					peak = held
+				}
+				mu.Unlock()
+
+				usage := p.Usage()
+				if usage.UsedSlots > slots || usage.UsedCPU > 6 || usage.UsedMemory > 6 {
+					t.Errorf("pool overcommitted: %+v", usage)
+				}
+
+				mu.Lock()
+				held--
+				mu.Unlock()
+				p.Release(cpu, 1)
+			}
+		}(w%2 + 1)
+	}
+	wg.Wait()
+
+	if peak > slots {
+		t.Errorf("%d executions held at once, want at most %d", peak, slots)
+	}
+	if got, want := p.Usage(), (Usage{TotalSlots: slots}); got != want {
+		t.Errorf("usage after every release %+v, want %+v", got, want)
+	}
+}
+
+func TestConcurrentAcquireFillsPoolExactly(t *testing.T) {
+	p := NewResourcePool(10, 20, 20)
+
+	var mu sync.Mutex
+	acquired := 0
+	var wg sync.WaitGroup
+	for w := 0; w < 50; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.TryAcquire(2, 2) {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 10 {
+		t.Errorf("%d of 50 concurrent requests acquired, want exactly 10", acquired)
+	}
+	if got, want := p.Usage(), (Usage{TotalSlots: 10, UsedSlots: 10, UsedCPU: 20, UsedMemory: 20}); got != want {
+		t.Errorf("usage %+v, want %+v", got, want)
+	}
+}